@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/Rafli-Dewanto/go-template/internal/config"
 	"github.com/Rafli-Dewanto/go-template/internal/router"
@@ -17,6 +19,9 @@ import (
 
 const serverAddr = ":8080"
 
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Load database configuration
 	configPath := filepath.Join("config", "database.ini")
@@ -25,6 +30,13 @@ func main() {
 		log.Fatalf("cannot load database config: %v", err)
 	}
 
+	// Load application configuration
+	appConfigPath := filepath.Join("config", "app.ini")
+	appConfig, err := config.LoadAppConfig(appConfigPath)
+	if err != nil {
+		log.Fatalf("cannot load app config: %v", err)
+	}
+
 	// Connect to database using the configuration
 	db, err := sqlx.Connect(dbConfig.Driver, dbConfig.GetDSN())
 	if err != nil {
@@ -36,7 +48,12 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	router := router.NewRouter(db)
+	router := router.NewRouter(db, dbConfig, appConfig)
+
+	// Background jobs stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	router.StartWorkers(workerCtx)
 
 	server := &http.Server{
 		Addr:    serverAddr,
@@ -52,9 +69,14 @@ func main() {
 
 	<-sigChan
 	fmt.Println("\nShutting down server...")
+	// Stopping the workers also ends the open event streams
+	stopWorkers()
 
 	// Gracefully shutdown the server
-	if err := server.Close(); err != nil {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Error during server shutdown: %v", err)
+		server.Close()
 	}
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Rafli-Dewanto/go-template/internal/config"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Reports users whose usernames or emails collide once normalized, and usernames
+// that imitate other scripts. Run it before the case-insensitive unique index
+// migration, which fails while conflicts remain. Exits 1 when conflicts exist.
+//
+//	go run ./cmd/useridentifiers
+func main() {
+	dbConfig, err := config.LoadDatabaseConfig(filepath.Join("config", "database.ini"))
+	if err != nil {
+		log.Fatalf("cannot load database config: %v", err)
+	}
+
+	db, err := sqlx.Connect(dbConfig.Driver, dbConfig.GetDSN())
+	if err != nil {
+		log.Fatalf("cannot connect to db: %v", err)
+	}
+	defer db.Close()
+
+	logger, err := utils.NewLogger("files/log/app.log")
+	if err != nil {
+		log.Fatalf("cannot open log file: %v", err)
+	}
+	defer logger.Close()
+
+	// The report only reads users, renames, their rules and auditing are not involved
+	userService := service.NewUserService(repository.NewUserRepository(db, logger), repository.NewUsernameHistoryRepository(db, logger),
+		repository.NewTransactor(db, logger), service.NewAuditService(repository.NewAuditRepository(db, logger), logger), service.UsernameRules{}, false, logger)
+
+	report, err := userService.IdentifierReport(context.Background())
+	if err != nil {
+		log.Fatalf("identifier scan failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if len(report.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
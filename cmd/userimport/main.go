@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/config"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Imports users from a CSV or JSON Lines file and prints the report as JSON.
+//
+//	go run ./cmd/userimport -file users.csv -mode atomic -dry-run
+//
+// The exit code is 1 when any row failed and 2 for usage errors.
+func main() {
+	os.Exit(run())
+}
+
+// run does the import and returns the exit code, so deferred cleanup runs
+// before the process exits
+func run() int {
+	filePath := flag.String("file", "", "CSV or JSON Lines file to import, - reads stdin")
+	format := flag.String("format", "", "csv or jsonl, guessed from the file extension when empty")
+	mode := flag.String("mode", model.ImportModeBestEffort, "atomic or best_effort")
+	dryRun := flag.Bool("dry-run", false, "validate without writing anything")
+	batchSize := flag.Int("batch-size", 500, "rows per COPY batch")
+	flag.Parse()
+
+	if *filePath == "" {
+		flag.Usage()
+		return 2
+	}
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(*filePath)) {
+		case ".csv":
+			*format = model.ImportFormatCSV
+		case ".jsonl", ".ndjson":
+			*format = model.ImportFormatJSONL
+		default:
+			log.Printf("cannot guess format of %s, pass -format", *filePath)
+			return 2
+		}
+	}
+
+	input := os.Stdin
+	if *filePath != "-" {
+		file, err := os.Open(*filePath)
+		if err != nil {
+			log.Printf("cannot open import file: %v", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	dbConfig, err := config.LoadDatabaseConfig(filepath.Join("config", "database.ini"))
+	if err != nil {
+		log.Printf("cannot load database config: %v", err)
+		return 1
+	}
+
+	db, err := sqlx.Connect(dbConfig.Driver, dbConfig.GetDSN())
+	if err != nil {
+		log.Printf("cannot connect to db: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	logger, err := utils.NewLogger("files/log/app.log")
+	if err != nil {
+		log.Printf("cannot open log file: %v", err)
+		return 1
+	}
+	defer logger.Close()
+
+	appConfig, err := config.LoadAppConfig(filepath.Join("config", "app.ini"))
+	if err != nil {
+		log.Printf("cannot load app config: %v", err)
+		return 1
+	}
+
+	attributeSchema, err := utils.LoadJSONSchema(appConfig.Attributes.SchemaFile)
+	if err != nil {
+		log.Printf("cannot load attribute schema: %v", err)
+		return 1
+	}
+
+	userRepo := repository.NewUserRepository(db, logger)
+	historyRepo := repository.NewUsernameHistoryRepository(db, logger)
+	auditService := service.NewAuditService(repository.NewAuditRepository(db, logger), logger)
+	importService := service.NewUserImportService(userRepo, historyRepo, repository.NewTransactor(db, logger), auditService, service.UsernameRules{
+		Reserved:        appConfig.Usernames.Reserved,
+		ReleaseCooldown: appConfig.Usernames.ReleaseCooldown,
+	}, attributeSchema, logger)
+
+	report, err := importService.Import(context.Background(), input, model.ImportOptions{
+		Format:    *format,
+		Mode:      *mode,
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	})
+	if err != nil {
+		log.Printf("import failed: %v", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("cannot write report: %v", err)
+		return 1
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,13 @@
+CREATE TABLE user_data_exports (
+    exp_id UUID PRIMARY KEY,
+    exp_usr_id INTEGER NOT NULL REFERENCES users (usr_id),
+    exp_requested_by INTEGER NOT NULL REFERENCES users (usr_id),
+    exp_format VARCHAR(10) NOT NULL,
+    exp_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    exp_file_path TEXT DEFAULT NULL,
+    exp_error TEXT DEFAULT NULL,
+    exp_created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    exp_completed_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX idx_user_data_exports_usr_id ON user_data_exports (exp_usr_id);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN usr_display_name VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN usr_bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN usr_locale VARCHAR(35) NOT NULL DEFAULT 'en',
+    ADD COLUMN usr_timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN usr_avatar_url TEXT NOT NULL DEFAULT '';
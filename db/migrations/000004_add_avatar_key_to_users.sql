@@ -0,0 +1,2 @@
+-- Blob store key of the uploaded original, thumbnails live next to it
+ALTER TABLE users ADD COLUMN usr_avatar_key TEXT DEFAULT NULL;
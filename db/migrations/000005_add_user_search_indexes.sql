@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Full-text search over identifying fields, the expression must match userSearchDocument in the repository
+CREATE INDEX idx_users_search_document ON users USING GIN (
+    to_tsvector('simple', usr_username || ' ' || usr_display_name || ' ' || usr_email)
+);
+
+-- Trigram indexes for partial and misspelled names
+CREATE INDEX idx_users_username_trgm ON users USING GIN (usr_username gin_trgm_ops);
+CREATE INDEX idx_users_display_name_trgm ON users USING GIN (usr_display_name gin_trgm_ops);
+CREATE INDEX idx_users_email_trgm ON users USING GIN (usr_email gin_trgm_ops);
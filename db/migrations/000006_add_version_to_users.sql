@@ -0,0 +1,2 @@
+-- Row version for optimistic concurrency, bumped by every write and exposed as the ETag
+ALTER TABLE users ADD COLUMN usr_version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+CREATE TABLE user_email_changes (
+    ech_id UUID PRIMARY KEY,
+    ech_usr_id INTEGER NOT NULL REFERENCES users (usr_id),
+    ech_old_email VARCHAR(255) NOT NULL,
+    ech_new_email VARCHAR(255) NOT NULL,
+    ech_confirm_token_hash CHAR(64) NOT NULL UNIQUE,
+    ech_revert_token_hash CHAR(64) NOT NULL UNIQUE,
+    ech_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    ech_expires_at TIMESTAMP NOT NULL,
+    ech_revert_expires_at TIMESTAMP NOT NULL,
+    ech_created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ech_confirmed_at TIMESTAMP DEFAULT NULL,
+    ech_reverted_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX idx_user_email_changes_usr_id ON user_email_changes (ech_usr_id);
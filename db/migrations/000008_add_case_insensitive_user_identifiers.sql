@@ -0,0 +1,6 @@
+-- The application stores usernames and emails NFKC normalized, trimmed and
+-- lowercased. These indexes make uniqueness case-insensitive for rows written
+-- before that too. Building them fails while conflicting accounts exist, list
+-- them with `go run ./cmd/useridentifiers` and resolve them first.
+CREATE UNIQUE INDEX idx_users_username_lower ON users (lower(usr_username));
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(usr_email));
@@ -0,0 +1,12 @@
+-- Usernames a user has given up. The name stays held for the user until
+-- unh_released_until and keeps redirecting to them after that, until claimed.
+CREATE TABLE user_username_history (
+    unh_id BIGSERIAL PRIMARY KEY,
+    unh_usr_id INTEGER NOT NULL REFERENCES users (usr_id),
+    unh_username VARCHAR(255) NOT NULL,
+    unh_changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    unh_released_until TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_user_username_history_username ON user_username_history (lower(unh_username), unh_changed_at DESC);
+CREATE INDEX idx_user_username_history_usr_id ON user_username_history (unh_usr_id);
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN usr_status VARCHAR(20) NOT NULL DEFAULT 'active'
+    CHECK (usr_status IN ('pending', 'active', 'suspended', 'banned'));
+
+-- Every status change of a user, with who made it and why
+CREATE TABLE user_status_transitions (
+    ust_id BIGSERIAL PRIMARY KEY,
+    ust_usr_id INTEGER NOT NULL REFERENCES users (usr_id),
+    ust_from_status VARCHAR(20) NOT NULL,
+    ust_to_status VARCHAR(20) NOT NULL,
+    ust_reason TEXT NOT NULL,
+    ust_actor_id INTEGER DEFAULT NULL REFERENCES users (usr_id),
+    ust_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_status_transitions_usr_id ON user_status_transitions (ust_usr_id, ust_created_at DESC);
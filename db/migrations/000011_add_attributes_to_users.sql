@@ -0,0 +1,5 @@
+-- Deployment specific attributes, their shape is defined by the schema in config/app.ini
+ALTER TABLE users ADD COLUMN usr_attributes JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- jsonb_path_ops serves the @> containment used by attribute filters
+CREATE INDEX idx_users_attributes ON users USING GIN (usr_attributes jsonb_path_ops);
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN usr_last_login_at TIMESTAMP DEFAULT NULL;
+
+-- Every login attempt, successful or not. lev_usr_id is NULL when the email
+-- matched no user. Rows older than the retention period are purged.
+CREATE TABLE user_login_events (
+    lev_id BIGSERIAL PRIMARY KEY,
+    lev_usr_id INTEGER DEFAULT NULL REFERENCES users (usr_id),
+    lev_email VARCHAR(255) NOT NULL,
+    lev_success BOOLEAN NOT NULL,
+    lev_failure_reason VARCHAR(50) DEFAULT NULL,
+    lev_method VARCHAR(20) NOT NULL,
+    lev_ip VARCHAR(45) NOT NULL,
+    lev_user_agent VARCHAR(512) NOT NULL,
+    lev_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_login_events_usr_id ON user_login_events (lev_usr_id, lev_created_at DESC);
+CREATE INDEX idx_user_login_events_created_at ON user_login_events (lev_created_at);
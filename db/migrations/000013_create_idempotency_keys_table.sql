@@ -0,0 +1,17 @@
+-- Responses of POST requests sent with an Idempotency-Key, replayed to retries.
+-- idk_scope is the method, path and caller the key was used by.
+CREATE TABLE idempotency_keys (
+    idk_scope VARCHAR(512) NOT NULL,
+    idk_key VARCHAR(255) NOT NULL,
+    idk_fingerprint CHAR(64) NOT NULL,
+    idk_status VARCHAR(20) NOT NULL,
+    idk_response_status INTEGER DEFAULT NULL,
+    idk_response_headers JSONB DEFAULT NULL,
+    idk_response_body BYTEA DEFAULT NULL,
+    idk_locked_until TIMESTAMP NOT NULL,
+    idk_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    idk_expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (idk_scope, idk_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (idk_expires_at);
@@ -0,0 +1,17 @@
+-- Who changed what. aud_actor_id is NULL for unauthenticated or system changes,
+-- aud_changes maps each changed field to its before and after values.
+CREATE TABLE audit_log (
+    aud_id BIGSERIAL PRIMARY KEY,
+    aud_actor_id INTEGER DEFAULT NULL,
+    aud_action VARCHAR(50) NOT NULL,
+    aud_target_type VARCHAR(50) NOT NULL,
+    aud_target_id BIGINT DEFAULT NULL,
+    aud_api_id VARCHAR(64) NOT NULL DEFAULT '',
+    aud_changes JSONB NOT NULL DEFAULT '{}'::jsonb,
+    aud_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_target ON audit_log (aud_target_type, aud_target_id, aud_created_at DESC);
+CREATE INDEX idx_audit_log_actor_id ON audit_log (aud_actor_id, aud_created_at DESC);
+CREATE INDEX idx_audit_log_action ON audit_log (aud_action, aud_created_at DESC);
+CREATE INDEX idx_audit_log_created_at ON audit_log (aud_created_at);
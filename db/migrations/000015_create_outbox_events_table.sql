@@ -0,0 +1,23 @@
+-- Transactional outbox: events are inserted in the same transaction as the change
+-- they describe and published afterwards by the relay. obx_available_at is when
+-- the event may next be claimed, it doubles as the lease of the relay holding it.
+CREATE TABLE outbox_events (
+    obx_id BIGSERIAL PRIMARY KEY,
+    obx_aggregate_type VARCHAR(50) NOT NULL,
+    obx_aggregate_id BIGINT NOT NULL,
+    obx_event_type VARCHAR(50) NOT NULL,
+    obx_payload JSONB NOT NULL,
+    obx_attempts INTEGER NOT NULL DEFAULT 0,
+    obx_last_error TEXT DEFAULT NULL,
+    obx_available_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    obx_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    obx_published_at TIMESTAMP DEFAULT NULL
+);
+
+-- Finds the oldest pending event of each aggregate, which alone may be published
+CREATE INDEX idx_outbox_events_pending ON outbox_events (obx_aggregate_type, obx_aggregate_id, obx_id)
+    WHERE obx_published_at IS NULL;
+CREATE INDEX idx_outbox_events_available_at ON outbox_events (obx_available_at)
+    WHERE obx_published_at IS NULL;
+CREATE INDEX idx_outbox_events_published_at ON outbox_events (obx_published_at)
+    WHERE obx_published_at IS NOT NULL;
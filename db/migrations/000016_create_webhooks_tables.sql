@@ -0,0 +1,39 @@
+-- Webhook endpoints. An empty whk_events receives every event type. Endpoints
+-- failing whk_consecutive_failures times in a row are disabled automatically.
+CREATE TABLE webhook_subscriptions (
+    whk_id BIGSERIAL PRIMARY KEY,
+    whk_url VARCHAR(2048) NOT NULL,
+    whk_secret VARCHAR(255) NOT NULL,
+    whk_events TEXT[] NOT NULL DEFAULT '{}',
+    whk_active BOOLEAN NOT NULL DEFAULT TRUE,
+    whk_consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    whk_disabled_at TIMESTAMP DEFAULT NULL,
+    whk_disabled_reason TEXT DEFAULT NULL,
+    whk_created_by INTEGER DEFAULT NULL,
+    whk_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    whk_updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One delivery per endpoint and outbox event, so an event the relay publishes
+-- twice is still delivered once. wdl_next_attempt_at doubles as the lease of
+-- the worker sending it.
+CREATE TABLE webhook_deliveries (
+    wdl_id BIGSERIAL PRIMARY KEY,
+    wdl_whk_id BIGINT NOT NULL REFERENCES webhook_subscriptions (whk_id) ON DELETE CASCADE,
+    wdl_event_id BIGINT NOT NULL,
+    wdl_event_type VARCHAR(50) NOT NULL,
+    wdl_payload JSONB NOT NULL,
+    wdl_status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (wdl_status IN ('pending', 'succeeded', 'failed')),
+    wdl_attempts INTEGER NOT NULL DEFAULT 0,
+    wdl_next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    wdl_response_status INTEGER DEFAULT NULL,
+    wdl_last_error TEXT DEFAULT NULL,
+    wdl_created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    wdl_delivered_at TIMESTAMP DEFAULT NULL,
+    UNIQUE (wdl_whk_id, wdl_event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (wdl_next_attempt_at)
+    WHERE wdl_status = 'pending';
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (wdl_whk_id, wdl_created_at DESC);
@@ -0,0 +1,28 @@
+-- Announces every write to a user on the user_changes channel, so each instance
+-- listening can drop state it holds about that user. Notifications are sent when
+-- the transaction commits and carry only the key, listeners read the row again.
+CREATE OR REPLACE FUNCTION notify_user_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed users;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    PERFORM pg_notify('user_changes', json_build_object(
+        'op', TG_OP,
+        'id', changed.usr_id,
+        'version', changed.usr_version,
+        'deleted', changed.usr_deleted_at IS NOT NULL
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notify_user_change
+AFTER INSERT OR UPDATE OR DELETE ON users
+FOR EACH ROW
+EXECUTE FUNCTION notify_user_change();
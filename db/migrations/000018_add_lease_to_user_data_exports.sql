@@ -0,0 +1,6 @@
+-- Exports are generated by a worker that claims them. exp_lease_until is when a
+-- running export is considered abandoned, e.g. after a restart, and is claimed again.
+ALTER TABLE user_data_exports ADD COLUMN exp_lease_until TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX idx_user_data_exports_claim ON user_data_exports (exp_created_at)
+    WHERE exp_status IN ('pending', 'running');
@@ -0,0 +1,16 @@
+-- Announces every user event recorded in the outbox on the user_events channel,
+-- so each instance can push it to the event streams it serves. Notifications are
+-- sent when the transaction commits and carry only the event ID.
+CREATE OR REPLACE FUNCTION notify_user_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('user_events', NEW.obx_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notify_user_event
+AFTER INSERT ON outbox_events
+FOR EACH ROW
+WHEN (NEW.obx_aggregate_type = 'user')
+EXECUTE FUNCTION notify_user_event();
@@ -0,0 +1,12 @@
+-- Archives are kept in the blob store shared by all instances instead of on the
+-- disk of the instance that generated them. exp_file_key is the blob key and
+-- exp_expires_at is when the archive is deleted. Exports generated before this
+-- have no blob and are expired, the files they left in the export directory can
+-- be removed.
+ALTER TABLE user_data_exports RENAME COLUMN exp_file_path TO exp_file_key;
+ALTER TABLE user_data_exports ADD COLUMN exp_expires_at TIMESTAMP DEFAULT NULL;
+
+UPDATE user_data_exports SET exp_status = 'expired', exp_file_key = NULL WHERE exp_status = 'completed';
+
+CREATE INDEX idx_user_data_exports_expiry ON user_data_exports (exp_expires_at)
+    WHERE exp_file_key IS NOT NULL;
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"errors"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// AccessPolicy decides which users may act on which resources.
+type AccessPolicy struct {
+	adminIDs map[int64]struct{}
+}
+
+func NewAccessPolicy(adminUserIDs []int64) *AccessPolicy {
+	adminIDs := make(map[int64]struct{}, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		adminIDs[id] = struct{}{}
+	}
+	return &AccessPolicy{adminIDs: adminIDs}
+}
+
+// IsAdmin reports whether the claims belong to an administrator
+func (p *AccessPolicy) IsAdmin(claims *Claims) bool {
+	if claims == nil {
+		return false
+	}
+	_, ok := p.adminIDs[claims.UserID]
+	return ok
+}
+
+// CanAccessUser reports whether the claims may read or act on the given user's data.
+// Users may always access their own data, administrators may access anyone's.
+func (p *AccessPolicy) CanAccessUser(claims *Claims, userID int64) bool {
+	if claims == nil {
+		return false
+	}
+	return claims.UserID == userID || p.IsAdmin(claims)
+}
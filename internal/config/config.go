@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
@@ -48,3 +50,331 @@ func (c *DatabaseConfig) GetDSN() string {
 		c.SSLMode,
 	)
 }
+
+type AuthConfig struct {
+	SecretKey    string
+	AdminUserIDs []int64
+}
+
+type ExportConfig struct {
+	// PollInterval is how often the worker looks for exports to generate
+	PollInterval time.Duration
+	// Retention is how long a generated archive can be downloaded before it is deleted
+	Retention time.Duration
+}
+
+type StorageConfig struct {
+	Driver         string
+	LocalDirectory string
+	PublicBaseURL  string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+}
+
+type AvatarConfig struct {
+	MaxBytes       int64
+	MaxWidth       int
+	MaxHeight      int
+	ThumbnailSizes []int
+}
+
+type MailConfig struct {
+	From string
+	// LinkBaseURL is the public base URL used in links sent by email
+	LinkBaseURL string
+}
+
+// CacheConfig holds the Cache-Control value of each cacheable route, empty sends none
+type CacheConfig struct {
+	UserGet    string
+	UserList   string
+	UserSearch string
+}
+
+type UsernameConfig struct {
+	Reserved []string
+	// ReleaseCooldown is how long a username given up by a rename stays unavailable to others
+	ReleaseCooldown time.Duration
+}
+
+type AttributeConfig struct {
+	// SchemaFile is the JSON Schema custom user attributes must match, none allows no attributes
+	SchemaFile string
+}
+
+type LoginEventConfig struct {
+	// Retention is how long login events are kept
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long responses are replayed to retries
+	TTL time.Duration
+	// LockTimeout is how long a request may hold its key before a retry takes it over
+	LockTimeout time.Duration
+	// WaitTimeout is how long a retry waits for a request holding the same key
+	WaitTimeout time.Duration
+	// PurgeInterval is how often expired keys are deleted
+	PurgeInterval time.Duration
+}
+
+type UserConfig struct {
+	// BatchMaxIDs caps the IDs one batch lookup may ask for
+	BatchMaxIDs int
+	// SignupRequiresActivation keeps self-registered users pending until an
+	// administrator activates them
+	SignupRequiresActivation bool
+}
+
+type OutboxConfig struct {
+	// Publisher is where events are published: log, http or memory
+	Publisher   string
+	HTTPURL     string
+	HTTPTimeout time.Duration
+	// PollInterval is how often the relay looks for pending events
+	PollInterval time.Duration
+	BatchSize    int
+	// Lease is how long a claimed event is reserved for the relay publishing it
+	Lease     time.Duration
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// Retention is how long published events are kept
+	Retention time.Duration
+}
+
+type WebhookConfig struct {
+	// PollInterval is how often due deliveries are looked for
+	PollInterval time.Duration
+	BatchSize    int
+	Timeout      time.Duration
+	// Lease is how long a claimed delivery is reserved for the worker sending it
+	Lease       time.Duration
+	MaxAttempts int
+	RetryBase   time.Duration
+	RetryMax    time.Duration
+	// DisableAfter consecutive failed attempts disable an endpoint
+	DisableAfter int
+}
+
+type EventStreamConfig struct {
+	// BufferSize is how many recent events are kept for clients resuming a stream
+	BufferSize int
+	// ClientQueueSize is how far a client may fall behind before it is disconnected
+	ClientQueueSize int
+	Heartbeat       time.Duration
+}
+
+type ChangeFeedConfig struct {
+	MinReconnect time.Duration
+	MaxReconnect time.Duration
+	PingInterval time.Duration
+}
+
+type AppConfig struct {
+	Auth        AuthConfig
+	Export      ExportConfig
+	Storage     StorageConfig
+	Avatar      AvatarConfig
+	Cache       CacheConfig
+	Mail        MailConfig
+	Usernames   UsernameConfig
+	Attributes  AttributeConfig
+	LoginEvents LoginEventConfig
+	Idempotency IdempotencyConfig
+	Users       UserConfig
+	Outbox      OutboxConfig
+	Webhooks    WebhookConfig
+	Events      EventStreamConfig
+	ChangeFeed  ChangeFeedConfig
+}
+
+func LoadAppConfig(filePath string) (*AppConfig, error) {
+	cfg, err := ini.Load(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ini file: %v", err)
+	}
+
+	authSection := cfg.Section("auth")
+	exportSection := cfg.Section("export")
+	storageSection := cfg.Section("storage")
+	avatarSection := cfg.Section("avatar")
+	cacheSection := cfg.Section("cache")
+	mailSection := cfg.Section("mail")
+	usernameSection := cfg.Section("usernames")
+	attributeSection := cfg.Section("attributes")
+	loginEventSection := cfg.Section("login_events")
+	idempotencySection := cfg.Section("idempotency")
+	userSection := cfg.Section("users")
+	outboxSection := cfg.Section("outbox")
+	webhookSection := cfg.Section("webhooks")
+	eventSection := cfg.Section("events")
+	changeFeedSection := cfg.Section("change_feed")
+
+	config := &AppConfig{
+		Auth: AuthConfig{
+			SecretKey:    authSection.Key("secret_key").String(),
+			AdminUserIDs: authSection.Key("admin_user_ids").Int64s(","),
+		},
+		Export: ExportConfig{
+			PollInterval: time.Duration(exportSection.Key("poll_interval_seconds").MustInt(5)) * time.Second,
+			Retention:    time.Duration(exportSection.Key("retention_hours").MustInt(168)) * time.Hour,
+		},
+		Storage: StorageConfig{
+			Driver:         storageSection.Key("driver").MustString("local"),
+			LocalDirectory: storageSection.Key("local_directory").MustString("files/uploads"),
+			PublicBaseURL:  storageSection.Key("public_base_url").String(),
+			S3Endpoint:     storageSection.Key("s3_endpoint").String(),
+			S3Region:       storageSection.Key("s3_region").MustString("us-east-1"),
+			S3Bucket:       storageSection.Key("s3_bucket").String(),
+			S3AccessKey:    storageSection.Key("s3_access_key").String(),
+			S3SecretKey:    storageSection.Key("s3_secret_key").String(),
+		},
+		Avatar: AvatarConfig{
+			MaxBytes:       avatarSection.Key("max_bytes").MustInt64(5 << 20),
+			MaxWidth:       avatarSection.Key("max_width").MustInt(4096),
+			MaxHeight:      avatarSection.Key("max_height").MustInt(4096),
+			ThumbnailSizes: avatarSection.Key("thumbnail_sizes").Ints(","),
+		},
+		Cache: CacheConfig{
+			UserGet:    cacheSection.Key("user_get").MustString("private, no-cache"),
+			UserList:   cacheSection.Key("user_list").MustString("private, no-cache"),
+			UserSearch: cacheSection.Key("user_search").MustString("private, no-cache"),
+		},
+		Mail: MailConfig{
+			From:        mailSection.Key("from").MustString("no-reply@localhost"),
+			LinkBaseURL: strings.TrimSuffix(mailSection.Key("link_base_url").MustString("http://localhost:8080"), "/"),
+		},
+		Attributes: AttributeConfig{
+			SchemaFile: attributeSection.Key("schema_file").String(),
+		},
+		LoginEvents: LoginEventConfig{
+			Retention:     time.Duration(loginEventSection.Key("retention_days").MustInt(180)) * 24 * time.Hour,
+			PurgeInterval: time.Duration(loginEventSection.Key("purge_interval_minutes").MustInt(60)) * time.Minute,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:           time.Duration(idempotencySection.Key("ttl_hours").MustInt(24)) * time.Hour,
+			LockTimeout:   time.Duration(idempotencySection.Key("lock_timeout_seconds").MustInt(30)) * time.Second,
+			WaitTimeout:   time.Duration(idempotencySection.Key("wait_timeout_seconds").MustInt(10)) * time.Second,
+			PurgeInterval: time.Duration(idempotencySection.Key("purge_interval_minutes").MustInt(60)) * time.Minute,
+		},
+		Users: UserConfig{
+			BatchMaxIDs:              userSection.Key("batch_max_ids").MustInt(100),
+			SignupRequiresActivation: userSection.Key("signup_requires_activation").MustBool(false),
+		},
+		Outbox: OutboxConfig{
+			Publisher:    outboxSection.Key("publisher").MustString("log"),
+			HTTPURL:      outboxSection.Key("http_url").String(),
+			HTTPTimeout:  time.Duration(outboxSection.Key("http_timeout_seconds").MustInt(10)) * time.Second,
+			PollInterval: time.Duration(outboxSection.Key("poll_interval_ms").MustInt(1000)) * time.Millisecond,
+			BatchSize:    outboxSection.Key("batch_size").MustInt(100),
+			Lease:        time.Duration(outboxSection.Key("lease_seconds").MustInt(30)) * time.Second,
+			RetryBase:    time.Duration(outboxSection.Key("retry_base_seconds").MustInt(1)) * time.Second,
+			RetryMax:     time.Duration(outboxSection.Key("retry_max_seconds").MustInt(300)) * time.Second,
+			Retention:    time.Duration(outboxSection.Key("retention_hours").MustInt(168)) * time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			PollInterval: time.Duration(webhookSection.Key("poll_interval_ms").MustInt(1000)) * time.Millisecond,
+			BatchSize:    webhookSection.Key("batch_size").MustInt(20),
+			Timeout:      time.Duration(webhookSection.Key("timeout_seconds").MustInt(10)) * time.Second,
+			Lease:        time.Duration(webhookSection.Key("lease_seconds").MustInt(60)) * time.Second,
+			MaxAttempts:  webhookSection.Key("max_attempts").MustInt(10),
+			RetryBase:    time.Duration(webhookSection.Key("retry_base_seconds").MustInt(10)) * time.Second,
+			RetryMax:     time.Duration(webhookSection.Key("retry_max_seconds").MustInt(3600)) * time.Second,
+			DisableAfter: webhookSection.Key("disable_after_failures").MustInt(20),
+		},
+		Events: EventStreamConfig{
+			BufferSize:      eventSection.Key("buffer_size").MustInt(1000),
+			ClientQueueSize: eventSection.Key("client_queue_size").MustInt(100),
+			Heartbeat:       time.Duration(eventSection.Key("heartbeat_seconds").MustInt(15)) * time.Second,
+		},
+		ChangeFeed: ChangeFeedConfig{
+			MinReconnect: time.Duration(changeFeedSection.Key("min_reconnect_seconds").MustInt(1)) * time.Second,
+			MaxReconnect: time.Duration(changeFeedSection.Key("max_reconnect_seconds").MustInt(60)) * time.Second,
+			PingInterval: time.Duration(changeFeedSection.Key("ping_interval_seconds").MustInt(90)) * time.Second,
+		},
+		Usernames: UsernameConfig{
+			Reserved:        usernameSection.Key("reserved").Strings(","),
+			ReleaseCooldown: time.Duration(usernameSection.Key("release_cooldown_days").MustInt(90)) * 24 * time.Hour,
+		},
+	}
+
+	if config.Auth.SecretKey == "" {
+		return nil, fmt.Errorf("auth.secret_key must be set")
+	}
+
+	if len(config.Avatar.ThumbnailSizes) == 0 {
+		config.Avatar.ThumbnailSizes = []int{64, 256}
+	}
+
+	// Zero or negative values would spin workers, panic tickers or reject everything
+	err = checkPositive(
+		positive{"export.poll_interval_seconds", int64(config.Export.PollInterval)},
+		positive{"export.retention_hours", int64(config.Export.Retention)},
+		positive{"avatar.max_bytes", config.Avatar.MaxBytes},
+		positive{"avatar.max_width", int64(config.Avatar.MaxWidth)},
+		positive{"avatar.max_height", int64(config.Avatar.MaxHeight)},
+		positive{"login_events.retention_days", int64(config.LoginEvents.Retention)},
+		positive{"login_events.purge_interval_minutes", int64(config.LoginEvents.PurgeInterval)},
+		positive{"idempotency.ttl_hours", int64(config.Idempotency.TTL)},
+		positive{"idempotency.lock_timeout_seconds", int64(config.Idempotency.LockTimeout)},
+		positive{"idempotency.wait_timeout_seconds", int64(config.Idempotency.WaitTimeout)},
+		positive{"idempotency.purge_interval_minutes", int64(config.Idempotency.PurgeInterval)},
+		positive{"users.batch_max_ids", int64(config.Users.BatchMaxIDs)},
+		positive{"outbox.http_timeout_seconds", int64(config.Outbox.HTTPTimeout)},
+		positive{"outbox.poll_interval_ms", int64(config.Outbox.PollInterval)},
+		positive{"outbox.batch_size", int64(config.Outbox.BatchSize)},
+		positive{"outbox.lease_seconds", int64(config.Outbox.Lease)},
+		positive{"outbox.retry_base_seconds", int64(config.Outbox.RetryBase)},
+		positive{"outbox.retry_max_seconds", int64(config.Outbox.RetryMax)},
+		positive{"outbox.retention_hours", int64(config.Outbox.Retention)},
+		positive{"webhooks.poll_interval_ms", int64(config.Webhooks.PollInterval)},
+		positive{"webhooks.batch_size", int64(config.Webhooks.BatchSize)},
+		positive{"webhooks.timeout_seconds", int64(config.Webhooks.Timeout)},
+		positive{"webhooks.lease_seconds", int64(config.Webhooks.Lease)},
+		positive{"webhooks.max_attempts", int64(config.Webhooks.MaxAttempts)},
+		positive{"webhooks.retry_base_seconds", int64(config.Webhooks.RetryBase)},
+		positive{"webhooks.retry_max_seconds", int64(config.Webhooks.RetryMax)},
+		positive{"events.buffer_size", int64(config.Events.BufferSize)},
+		positive{"events.client_queue_size", int64(config.Events.ClientQueueSize)},
+		positive{"events.heartbeat_seconds", int64(config.Events.Heartbeat)},
+		positive{"change_feed.min_reconnect_seconds", int64(config.ChangeFeed.MinReconnect)},
+		positive{"change_feed.max_reconnect_seconds", int64(config.ChangeFeed.MaxReconnect)},
+		positive{"change_feed.ping_interval_seconds", int64(config.ChangeFeed.PingInterval)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Zero is allowed here and never disables an endpoint
+	if config.Webhooks.DisableAfter < 0 {
+		return nil, fmt.Errorf("webhooks.disable_after_failures must not be negative")
+	}
+	if config.ChangeFeed.MaxReconnect < config.ChangeFeed.MinReconnect {
+		return nil, fmt.Errorf("change_feed.max_reconnect_seconds must not be less than change_feed.min_reconnect_seconds")
+	}
+	for _, size := range config.Avatar.ThumbnailSizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("avatar.thumbnail_sizes must all be greater than 0")
+		}
+	}
+
+	return config, nil
+}
+
+// positive is a setting that must be greater than zero, key as written in the ini file
+type positive struct {
+	key   string
+	value int64
+}
+
+func checkPositive(settings ...positive) error {
+	for _, setting := range settings {
+		if setting.value <= 0 {
+			return fmt.Errorf("%s must be greater than 0", setting.key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAppConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.ini")
+	if err := os.WriteFile(path, []byte("[auth]\nsecret_key = secret\n"+content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAppConfigDefaults(t *testing.T) {
+	config, err := LoadAppConfig(writeAppConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadAppConfig() = %v", err)
+	}
+	if config.Outbox.BatchSize != 100 || config.LoginEvents.PurgeInterval <= 0 || config.Users.SignupRequiresActivation {
+		t.Errorf("defaults not applied: %+v", config)
+	}
+}
+
+func TestLoadAppConfigShippedFile(t *testing.T) {
+	if _, err := LoadAppConfig(filepath.Join("..", "..", "config", "app.ini")); err != nil {
+		t.Fatalf("LoadAppConfig() of config/app.ini = %v", err)
+	}
+}
+
+func TestLoadAppConfigRejectsNonPositiveSettings(t *testing.T) {
+	tests := []struct {
+		section string
+		key     string
+		value   string
+	}{
+		{section: "export", key: "poll_interval_seconds", value: "0"},
+		{section: "export", key: "retention_hours", value: "0"},
+		{section: "avatar", key: "max_bytes", value: "0"},
+		{section: "login_events", key: "retention_days", value: "0"},
+		{section: "login_events", key: "purge_interval_minutes", value: "0"},
+		{section: "idempotency", key: "lock_timeout_seconds", value: "-1"},
+		{section: "idempotency", key: "purge_interval_minutes", value: "0"},
+		{section: "users", key: "batch_max_ids", value: "0"},
+		{section: "outbox", key: "poll_interval_ms", value: "0"},
+		{section: "outbox", key: "batch_size", value: "0"},
+		{section: "outbox", key: "lease_seconds", value: "-5"},
+		{section: "outbox", key: "retry_max_seconds", value: "0"},
+		{section: "webhooks", key: "poll_interval_ms", value: "0"},
+		{section: "webhooks", key: "batch_size", value: "0"},
+		{section: "webhooks", key: "lease_seconds", value: "0"},
+		{section: "webhooks", key: "max_attempts", value: "0"},
+		{section: "webhooks", key: "disable_after_failures", value: "-1"},
+		{section: "events", key: "buffer_size", value: "0"},
+		{section: "events", key: "client_queue_size", value: "0"},
+		{section: "events", key: "heartbeat_seconds", value: "0"},
+		{section: "change_feed", key: "min_reconnect_seconds", value: "0"},
+		{section: "change_feed", key: "max_reconnect_seconds", value: "-1"},
+		{section: "change_feed", key: "ping_interval_seconds", value: "0"},
+	}
+
+	for _, tt := range tests {
+		name := tt.section + "." + tt.key
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadAppConfig(writeAppConfig(t, "["+tt.section+"]\n"+tt.key+" = "+tt.value+"\n"))
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("LoadAppConfig() = %v, want an error naming %s", err, name)
+			}
+		})
+	}
+
+	_, err := LoadAppConfig(writeAppConfig(t, "[avatar]\nthumbnail_sizes = 64,0\n"))
+	if err == nil || !strings.Contains(err.Error(), "avatar.thumbnail_sizes") {
+		t.Errorf("LoadAppConfig() with a zero thumbnail size = %v", err)
+	}
+
+	_, err = LoadAppConfig(writeAppConfig(t, "[change_feed]\nmin_reconnect_seconds = 30\nmax_reconnect_seconds = 10\n"))
+	if err == nil || !strings.Contains(err.Error(), "change_feed.max_reconnect_seconds") {
+		t.Errorf("LoadAppConfig() with max_reconnect below min_reconnect = %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	AuditActionUserCreate        = "user.create"
+	AuditActionUserUpdate        = "user.update"
+	AuditActionUserDelete        = "user.delete"
+	AuditActionUserImport        = "user.import"
+	AuditActionAvatarUpdate      = "user.avatar_update"
+	AuditActionAvatarDelete      = "user.avatar_delete"
+	AuditActionStatusChange      = "user.status_change"
+	AuditActionEmailChange       = "user.email_change"
+	AuditActionEmailChangeRevert = "user.email_change_revert"
+
+	AuditTargetUser = "user"
+)
+
+// AuditLog records one change. ActorID is nil when nobody was signed in, TargetID
+// is nil for changes to many targets at once such as imports.
+type AuditLog struct {
+	ID         int64          `db:"aud_id"`
+	ActorID    *int64         `db:"aud_actor_id"`
+	Action     string         `db:"aud_action"`
+	TargetType string         `db:"aud_target_type"`
+	TargetID   *int64         `db:"aud_target_id"`
+	APIID      string         `db:"aud_api_id"`
+	Changes    types.JSONText `db:"aud_changes"`
+	CreatedAt  time.Time      `db:"aud_created_at"`
+}
+
+func (a *AuditLog) TableName() string {
+	return "audit_log"
+}
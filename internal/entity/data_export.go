@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	DataExportStatusPending   = "pending"
+	DataExportStatusRunning   = "running"
+	DataExportStatusCompleted = "completed"
+	DataExportStatusFailed    = "failed"
+	// DataExportStatusExpired is a completed export whose archive was deleted
+	DataExportStatusExpired = "expired"
+)
+
+const (
+	DataExportFormatJSON = "json"
+	DataExportFormatZIP  = "zip"
+)
+
+type DataExport struct {
+	ID          string     `db:"exp_id"`
+	UserID      int64      `db:"exp_usr_id"`
+	RequestedBy int64      `db:"exp_requested_by"`
+	Format      string     `db:"exp_format"`
+	Status      string     `db:"exp_status"`
+	FileKey     *string    `db:"exp_file_key"`
+	Error       *string    `db:"exp_error"`
+	CreatedAt   time.Time  `db:"exp_created_at"`
+	CompletedAt *time.Time `db:"exp_completed_at"`
+	LeaseUntil  *time.Time `db:"exp_lease_until"`
+	ExpiresAt   *time.Time `db:"exp_expires_at"`
+}
+
+func (e *DataExport) TableName() string {
+	return "user_data_exports"
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	EmailChangeStatusPending    = "pending"
+	EmailChangeStatusConfirmed  = "confirmed"
+	EmailChangeStatusReverted   = "reverted"
+	EmailChangeStatusSuperseded = "superseded"
+)
+
+// EmailChange is a request to move a user to a new email address. Only hashes
+// of the confirmation and revert tokens are stored.
+type EmailChange struct {
+	ID               string     `db:"ech_id"`
+	UserID           int64      `db:"ech_usr_id"`
+	OldEmail         string     `db:"ech_old_email"`
+	NewEmail         string     `db:"ech_new_email"`
+	ConfirmTokenHash string     `db:"ech_confirm_token_hash"`
+	RevertTokenHash  string     `db:"ech_revert_token_hash"`
+	Status           string     `db:"ech_status"`
+	ExpiresAt        time.Time  `db:"ech_expires_at"`
+	RevertExpiresAt  time.Time  `db:"ech_revert_expires_at"`
+	CreatedAt        time.Time  `db:"ech_created_at"`
+	ConfirmedAt      *time.Time `db:"ech_confirmed_at"`
+	RevertedAt       *time.Time `db:"ech_reverted_at"`
+}
+
+func (e *EmailChange) TableName() string {
+	return "user_email_changes"
+}
@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	IdempotencyStatusProcessing = "processing"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+// IdempotencyKey is a request made with an Idempotency-Key. While processing,
+// LockedUntil bounds how long the request may hold the key before a retry can
+// take it over. Once completed the response is kept until ExpiresAt.
+type IdempotencyKey struct {
+	Scope           string         `db:"idk_scope"`
+	Key             string         `db:"idk_key"`
+	Fingerprint     string         `db:"idk_fingerprint"`
+	Status          string         `db:"idk_status"`
+	ResponseStatus  *int           `db:"idk_response_status"`
+	ResponseHeaders types.JSONText `db:"idk_response_headers"`
+	ResponseBody    []byte         `db:"idk_response_body"`
+	LockedUntil     time.Time      `db:"idk_locked_until"`
+	CreatedAt       time.Time      `db:"idk_created_at"`
+	ExpiresAt       time.Time      `db:"idk_expires_at"`
+}
+
+func (k *IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
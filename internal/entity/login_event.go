@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	LoginMethodPassword = "password"
+
+	LoginFailureUnknownEmail    = "unknown_email"
+	LoginFailureInvalidPassword = "invalid_password"
+	LoginFailureSuspended       = "account_suspended"
+	LoginFailureBanned          = "account_banned"
+	LoginFailurePending         = "account_pending"
+	LoginFailureDeleted         = "account_deleted"
+)
+
+// LoginEvent is one login attempt. UserID is nil when the email matched no user.
+type LoginEvent struct {
+	ID            int64     `db:"lev_id"`
+	UserID        *int64    `db:"lev_usr_id"`
+	Email         string    `db:"lev_email"`
+	Success       bool      `db:"lev_success"`
+	FailureReason *string   `db:"lev_failure_reason"`
+	Method        string    `db:"lev_method"`
+	IP            string    `db:"lev_ip"`
+	UserAgent     string    `db:"lev_user_agent"`
+	CreatedAt     time.Time `db:"lev_created_at"`
+}
+
+func (e *LoginEvent) TableName() string {
+	return "user_login_events"
+}
@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+
+	AggregateUser = "user"
+)
+
+// OutboxEvent is a domain event waiting to be published, or already published
+// when PublishedAt is set
+type OutboxEvent struct {
+	ID            int64          `db:"obx_id"`
+	AggregateType string         `db:"obx_aggregate_type"`
+	AggregateID   int64          `db:"obx_aggregate_id"`
+	EventType     string         `db:"obx_event_type"`
+	Payload       types.JSONText `db:"obx_payload"`
+	Attempts      int            `db:"obx_attempts"`
+	LastError     *string        `db:"obx_last_error"`
+	AvailableAt   time.Time      `db:"obx_available_at"`
+	CreatedAt     time.Time      `db:"obx_created_at"`
+	PublishedAt   *time.Time     `db:"obx_published_at"`
+}
+
+func (e *OutboxEvent) TableName() string {
+	return "outbox_events"
+}
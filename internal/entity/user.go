@@ -2,18 +2,38 @@ package entity
 
 import (
 	"time"
+
+	"github.com/jmoiron/sqlx/types"
 )
 
 type User struct {
-	ID        int64     `db:"usr_id"`
-	Username  string    `db:"usr_username"`
-	Email     string    `db:"usr_email"`
-	Password  string    `db:"usr_password"`
-	CreatedAt time.Time `db:"usr_created_at"`
-	UpdatedAt time.Time `db:"usr_updated_at"`
-	DeletedAt *time.Time `db:"usr_deleted_at"`
+	ID          int64          `db:"usr_id"`
+	Username    string         `db:"usr_username"`
+	Email       string         `db:"usr_email"`
+	Password    string         `db:"usr_password"`
+	DisplayName string         `db:"usr_display_name"`
+	Bio         string         `db:"usr_bio"`
+	Locale      string         `db:"usr_locale"`
+	Timezone    string         `db:"usr_timezone"`
+	AvatarURL   string         `db:"usr_avatar_url"`
+	AvatarKey   *string        `db:"usr_avatar_key"`
+	Status      string         `db:"usr_status"`
+	Attributes  types.JSONText `db:"usr_attributes"`
+	Version     int64          `db:"usr_version"`
+	LastLoginAt *time.Time     `db:"usr_last_login_at"`
+	CreatedAt   time.Time      `db:"usr_created_at"`
+	UpdatedAt   time.Time      `db:"usr_updated_at"`
+	DeletedAt   *time.Time     `db:"usr_deleted_at"`
 }
 
 func (u *User) TableName() string {
 	return "users"
 }
+
+// UserSearchResult is a user matched by search along with its relevance and highlighted fields
+type UserSearchResult struct {
+	User
+	Rank                 float64 `db:"search_rank"`
+	UsernameHighlight    string  `db:"search_username_highlight"`
+	DisplayNameHighlight string  `db:"search_display_name_highlight"`
+}
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	UserStatusPending   = "pending"
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+)
+
+// userStatusTransitions is the user lifecycle, the statuses each status may move to.
+// Every status change goes through CanTransitionUserStatus.
+var userStatusTransitions = map[string][]string{
+	UserStatusPending:   {UserStatusActive, UserStatusBanned},
+	UserStatusActive:    {UserStatusSuspended, UserStatusBanned},
+	UserStatusSuspended: {UserStatusActive, UserStatusBanned},
+	UserStatusBanned:    {UserStatusActive},
+}
+
+func IsUserStatus(status string) bool {
+	_, ok := userStatusTransitions[status]
+	return ok
+}
+
+func CanTransitionUserStatus(from string, to string) bool {
+	return slices.Contains(userStatusTransitions[from], to)
+}
+
+// NextUserStatuses returns the statuses a user in status may move to
+func NextUserStatuses(status string) []string {
+	return slices.Clone(userStatusTransitions[status])
+}
+
+// UserStatusTransition records one status change of a user. ActorID is nil for
+// changes made by the system.
+type UserStatusTransition struct {
+	ID         int64     `db:"ust_id"`
+	UserID     int64     `db:"ust_usr_id"`
+	FromStatus string    `db:"ust_from_status"`
+	ToStatus   string    `db:"ust_to_status"`
+	Reason     string    `db:"ust_reason"`
+	ActorID    *int64    `db:"ust_actor_id"`
+	CreatedAt  time.Time `db:"ust_created_at"`
+}
+
+func (t *UserStatusTransition) TableName() string {
+	return "user_status_transitions"
+}
@@ -0,0 +1,19 @@
+package entity
+
+import (
+	"time"
+)
+
+// UsernameHistory records a username a user gave up. Nobody else may claim it
+// before ReleasedUntil.
+type UsernameHistory struct {
+	ID            int64     `db:"unh_id"`
+	UserID        int64     `db:"unh_usr_id"`
+	Username      string    `db:"unh_username"`
+	ChangedAt     time.Time `db:"unh_changed_at"`
+	ReleasedUntil time.Time `db:"unh_released_until"`
+}
+
+func (h *UsernameHistory) TableName() string {
+	return "user_username_history"
+}
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEventTypes are the events webhooks can subscribe to
+var WebhookEventTypes = []string{EventUserCreated, EventUserUpdated, EventUserDeleted}
+
+// WebhookSubscription is an endpoint receiving signed event callbacks. An empty
+// Events list subscribes to every event type.
+type WebhookSubscription struct {
+	ID                  int64          `db:"whk_id"`
+	URL                 string         `db:"whk_url"`
+	Secret              string         `db:"whk_secret"`
+	Events              pq.StringArray `db:"whk_events"`
+	Active              bool           `db:"whk_active"`
+	ConsecutiveFailures int            `db:"whk_consecutive_failures"`
+	DisabledAt          *time.Time     `db:"whk_disabled_at"`
+	DisabledReason      *string        `db:"whk_disabled_reason"`
+	CreatedBy           *int64         `db:"whk_created_by"`
+	CreatedAt           time.Time      `db:"whk_created_at"`
+	UpdatedAt           time.Time      `db:"whk_updated_at"`
+}
+
+func (w *WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// WebhookDelivery is one event sent, or to be sent, to one subscription
+type WebhookDelivery struct {
+	ID             int64          `db:"wdl_id"`
+	WebhookID      int64          `db:"wdl_whk_id"`
+	EventID        int64          `db:"wdl_event_id"`
+	EventType      string         `db:"wdl_event_type"`
+	Payload        types.JSONText `db:"wdl_payload"`
+	Status         string         `db:"wdl_status"`
+	Attempts       int            `db:"wdl_attempts"`
+	NextAttemptAt  time.Time      `db:"wdl_next_attempt_at"`
+	ResponseStatus *int           `db:"wdl_response_status"`
+	LastError      *string        `db:"wdl_last_error"`
+	CreatedAt      time.Time      `db:"wdl_created_at"`
+	DeliveredAt    *time.Time     `db:"wdl_delivered_at"`
+}
+
+func (d *WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
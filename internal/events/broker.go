@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+var ErrBrokerClosed = errors.New("event broker is closed")
+
+// EventReset is the type of the event a Reset hands to subscribers. It has no
+// ID and tells them events were missed, so what they built from earlier events
+// must be reloaded.
+const EventReset = "reset"
+
+// Broker is a Publisher that hands events to live subscribers in this process,
+// such as server-sent event streams. It keeps the most recent events so a
+// subscriber that reconnects with the ID of the last event it saw can catch up
+// on what it missed. Following a UserChangeFeed, it gets the events recorded
+// through every instance, whichever relays them.
+type Broker struct {
+	mu          sync.Mutex
+	recent      []Event
+	recentIDs   map[int64]bool
+	size        int
+	queueSize   int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// NewBroker keeps the last size events for resuming subscribers. Each
+// subscriber may fall queueSize events behind before it is dropped.
+func NewBroker(size int, queueSize int) *Broker {
+	return &Broker{
+		recentIDs:   map[int64]bool{},
+		size:        max(size, 1),
+		queueSize:   max(queueSize, 1),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives the events published after it was made. Its channel is
+// closed when the subscription is closed, when the broker shuts down or when
+// the subscriber fell too far behind, which it can tell apart with Dropped.
+type Subscription struct {
+	broker  *Broker
+	events  chan Event
+	dropped bool
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped reports whether the subscription ended because the subscriber did not
+// keep up. It is only meaningful once Events is closed.
+func (s *Subscription) Dropped() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes, it is safe to call more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+// Publish never fails. An event already seen, as redelivered by the outbox, is
+// ignored.
+func (b *Broker) Publish(_ context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.recentIDs[event.ID] {
+		return nil
+	}
+
+	if len(b.recent) == b.size {
+		delete(b.recentIDs, b.recent[0].ID)
+		b.recent = append(b.recent[:0], b.recent[1:]...)
+	}
+	b.recent = append(b.recent, event)
+	b.recentIDs[event.ID] = true
+
+	for subscription := range b.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped = true
+			b.remove(subscription)
+		}
+	}
+	return nil
+}
+
+// Reset forgets the buffered events and hands subscribers an EventReset, for
+// when events may have been missed. A subscriber too far behind to take it is
+// dropped, and reconnecting with an ID no longer buffered it is reset as well.
+func (b *Broker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.recent = nil
+	b.recentIDs = map[int64]bool{}
+
+	for subscription := range b.subscribers {
+		select {
+		case subscription.events <- Event{Type: EventReset}:
+		default:
+			subscription.dropped = true
+			b.remove(subscription)
+		}
+	}
+}
+
+// Follow publishes every user event announced on feed, read with load, until
+// ctx is done. Events are published in the order they were committed, and the
+// broker is reset when the feed resyncs after missing some.
+func (b *Broker) Follow(ctx context.Context, feed *UserChangeFeed, load func(ctx context.Context, id int64) (Event, error), logger *utils.Logger) {
+	unsubscribeEvents := feed.SubscribeEvents(func(eventID int64) {
+		event, err := load(ctx, eventID)
+		if err != nil {
+			logger.Warning("Failed to load user event %d for event streams: %v", eventID, err)
+			return
+		}
+		b.Publish(ctx, event)
+	})
+	unsubscribeChanges := feed.Subscribe(func(change UserChange) {
+		if change.Operation == UserChangeResync {
+			b.Reset()
+		}
+	})
+
+	go func() {
+		<-ctx.Done()
+		unsubscribeEvents()
+		unsubscribeChanges()
+	}()
+}
+
+// Subscribe starts a subscription. With lastEventID set, the buffered events
+// after it are returned for replay; complete is false when that event is no
+// longer buffered, so some events in between may have been missed.
+func (b *Broker) Subscribe(lastEventID *int64) (subscription *Subscription, replay []Event, complete bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, false, ErrBrokerClosed
+	}
+
+	complete = true
+	if lastEventID != nil {
+		complete = false
+		for i, event := range b.recent {
+			if event.ID == *lastEventID {
+				replay = append([]Event(nil), b.recent[i+1:]...)
+				complete = true
+				break
+			}
+		}
+	}
+
+	subscription = &Subscription{broker: b, events: make(chan Event, b.queueSize)}
+	b.subscribers[subscription] = struct{}{}
+	return subscription, replay, complete, nil
+}
+
+// Close ends all subscriptions and refuses new ones
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for subscription := range b.subscribers {
+		b.remove(subscription)
+	}
+}
+
+// remove must be called with mu held
+func (b *Broker) remove(subscription *Subscription) {
+	if _, ok := b.subscribers[subscription]; !ok {
+		return
+	}
+	delete(b.subscribers, subscription)
+	close(subscription.events)
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func publishIDs(t *testing.T, b *Broker, ids ...int64) {
+	t.Helper()
+	for _, id := range ids {
+		if err := b.Publish(context.Background(), Event{ID: id, Type: "user.updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func eventIDs(events []Event) []int64 {
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func drain(subscription *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestBrokerResumesFromABufferedEvent(t *testing.T) {
+	b := NewBroker(10, 10)
+	publishIDs(t, b, 1, 2, 3)
+
+	lastEventID := int64(1)
+	subscription, replay, complete, err := b.Subscribe(&lastEventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Close()
+
+	if got := eventIDs(replay); !complete || len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("replayed %v, complete %v, want [2 3] complete", got, complete)
+	}
+
+	publishIDs(t, b, 4)
+	if got := eventIDs(drain(subscription)); len(got) != 1 || got[0] != 4 {
+		t.Errorf("live events %v, want [4]", got)
+	}
+}
+
+func TestBrokerResumeFromAnEvictedEventIsIncomplete(t *testing.T) {
+	b := NewBroker(2, 10)
+	publishIDs(t, b, 1, 2, 3)
+
+	lastEventID := int64(1)
+	subscription, replay, complete, err := b.Subscribe(&lastEventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Close()
+
+	if complete || len(replay) != 0 {
+		t.Errorf("replayed %v, complete %v, want nothing and incomplete", eventIDs(replay), complete)
+	}
+}
+
+func TestBrokerIgnoresRedeliveredEvents(t *testing.T) {
+	b := NewBroker(10, 10)
+	subscription, _, _, err := b.Subscribe(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Close()
+
+	publishIDs(t, b, 1, 2, 1)
+
+	if got := eventIDs(drain(subscription)); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("delivered %v, want [1 2]", got)
+	}
+}
+
+func TestBrokerDropsASubscriberThatFallsBehind(t *testing.T) {
+	b := NewBroker(10, 2)
+	slow, _, _, err := b.Subscribe(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, _, _, err := b.Subscribe(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	publishIDs(t, b, 1, 2)
+	drain(fast)
+	publishIDs(t, b, 3)
+
+	if got := eventIDs(drain(slow)); len(got) != 2 {
+		t.Errorf("slow subscriber got %v, want the 2 queued events", got)
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Fatal("slow subscriber is still open")
+	}
+	if !slow.Dropped() {
+		t.Error("slow subscriber is not marked dropped")
+	}
+	if got := eventIDs(drain(fast)); fast.Dropped() || len(got) != 1 || got[0] != 3 {
+		t.Errorf("fast subscriber got %v, dropped %v, want [3] and still subscribed", got, fast.Dropped())
+	}
+}
+
+func TestBrokerCloseEndsEverySubscription(t *testing.T) {
+	b := NewBroker(10, 10)
+	var subscriptions []*Subscription
+	for i := 0; i < 3; i++ {
+		subscription, _, _, err := b.Subscribe(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	b.Close()
+
+	for i, subscription := range subscriptions {
+		if _, ok := <-subscription.Events(); ok {
+			t.Errorf("subscription %d is still open", i)
+		}
+		if subscription.Dropped() {
+			t.Errorf("subscription %d is marked dropped", i)
+		}
+		// Closing after the broker did is a no-op
+		subscription.Close()
+	}
+	if _, _, _, err := b.Subscribe(nil); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("subscribe after close returned %v, want ErrBrokerClosed", err)
+	}
+}
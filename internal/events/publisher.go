@@ -0,0 +1,130 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+// Event is a domain event as handed to publishers. ID increases with every event
+// recorded, so consumers can use it to drop duplicates of at-least-once delivery.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// Publisher delivers events to other systems. An error means the event was not
+// delivered and will be retried.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// LogPublisher writes events to the log instead of sending them, for development
+type LogPublisher struct {
+	logger *utils.Logger
+}
+
+func NewLogPublisher(logger *utils.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(_ context.Context, event Event) error {
+	p.logger.Info("Event %d %s for %s %d: %s", event.ID, event.Type, event.AggregateType, event.AggregateID, event.Payload)
+	return nil
+}
+
+// HTTPPublisher POSTs each event as JSON to a URL, any status other than 2xx is a failure
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPPublisher(url string, client *http.Client) *HTTPPublisher {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &HTTPPublisher{url: url, client: client}
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event endpoint responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FanoutPublisher hands every event to all of its publishers in order and fails
+// if any of them does. The event is then retried for all of them, so each must
+// tolerate receiving an event again.
+type FanoutPublisher struct {
+	publishers []Publisher
+}
+
+func NewFanoutPublisher(publishers ...Publisher) *FanoutPublisher {
+	return &FanoutPublisher{publishers: publishers}
+}
+
+func (p *FanoutPublisher) Publish(ctx context.Context, event Event) error {
+	for _, publisher := range p.publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryPublisher keeps published events in memory, for tests and local tools
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns a copy of the events published so far, oldest first
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
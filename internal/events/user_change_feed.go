@@ -0,0 +1,207 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/lib/pq"
+)
+
+// UserChangesChannel is the channel the users table trigger notifies on
+const UserChangesChannel = "user_changes"
+
+// UserEventsChannel is the channel the outbox trigger notifies on with the ID of
+// every user event recorded
+const UserEventsChannel = "user_events"
+
+// UserChangeResync is sent instead of a change after the listener lost its
+// connection, changes made meanwhile were missed and any state derived from
+// users must be dropped
+const UserChangeResync = "RESYNC"
+
+// UserChange is a committed write to a user, by any instance. Operation is
+// INSERT, UPDATE or DELETE, a soft delete is an UPDATE with Deleted set.
+type UserChange struct {
+	Operation string `json:"op"`
+	UserID    int64  `json:"id"`
+	Version   int64  `json:"version"`
+	Deleted   bool   `json:"deleted"`
+}
+
+type UserChangeFeedOptions struct {
+	// MinReconnect is the delay before reconnecting a lost connection, doubling
+	// with every failed attempt up to MaxReconnect
+	MinReconnect time.Duration
+	MaxReconnect time.Duration
+	// PingInterval is how often an idle connection is checked, so a silently
+	// dropped one is noticed and reconnected
+	PingInterval time.Duration
+}
+
+// UserChangeFeed listens for the user changes and user events the database
+// announces and hands them to its subscribers. Each instance runs one, so state
+// it keeps about users follows writes made by the other instances too.
+type UserChangeFeed struct {
+	dsn     string
+	options UserChangeFeedOptions
+	logger  *utils.Logger
+
+	mu               sync.Mutex
+	subscribers      map[int]func(UserChange)
+	eventSubscribers map[int]func(int64)
+	nextID           int
+}
+
+func NewUserChangeFeed(dsn string, options UserChangeFeedOptions, logger *utils.Logger) *UserChangeFeed {
+	return &UserChangeFeed{
+		dsn:              dsn,
+		options:          options,
+		logger:           logger,
+		subscribers:      map[int]func(UserChange){},
+		eventSubscribers: map[int]func(int64){},
+	}
+}
+
+// Subscribe calls handler with every change until unsubscribe is called.
+// Handlers run one after another on the listening goroutine, in the order the
+// changes were committed, so they must return quickly.
+func (f *UserChangeFeed) Subscribe(handler func(UserChange)) (unsubscribe func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID
+	f.nextID++
+	f.subscribers[id] = handler
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subscribers, id)
+	}
+}
+
+// SubscribeEvents calls handler with the ID of every user event recorded in the
+// outbox until unsubscribe is called. Like changes, IDs arrive in commit order
+// on the listening goroutine, and events announced while the connection was
+// lost are missed, Subscribe handlers get a resync change then.
+func (f *UserChangeFeed) SubscribeEvents(handler func(eventID int64)) (unsubscribe func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID
+	f.nextID++
+	f.eventSubscribers[id] = handler
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.eventSubscribers, id)
+	}
+}
+
+// Run listens until ctx is done, reconnecting whenever the connection is lost
+func (f *UserChangeFeed) Run(ctx context.Context) {
+	listener := pq.NewListener(f.dsn, f.options.MinReconnect, f.options.MaxReconnect, f.logListenerEvent)
+
+	// Listen blocks while the database is unreachable, closing unblocks it
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+		}
+		listener.Close()
+	}()
+
+	for _, channel := range []string{UserChangesChannel, UserEventsChannel} {
+		if err := listener.Listen(channel); err != nil {
+			if ctx.Err() == nil {
+				f.logger.Error("Failed to listen on %s: %v", channel, err)
+			}
+			return
+		}
+	}
+
+	ping := time.NewTicker(f.options.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification, ok := <-listener.Notify:
+			if !ok {
+				return
+			}
+			f.dispatch(notification)
+		case <-ping.C:
+			// Errors surface as a reconnect, which is logged
+			listener.Ping()
+		}
+	}
+}
+
+// dispatch hands a notification to the subscribers of its channel. A nil
+// notification follows a reconnect.
+func (f *UserChangeFeed) dispatch(notification *pq.Notification) {
+	switch {
+	case notification == nil:
+		f.publish(UserChange{Operation: UserChangeResync})
+	case notification.Channel == UserEventsChannel:
+		eventID, err := strconv.ParseInt(notification.Extra, 10, 64)
+		if err != nil {
+			f.logger.Warning("Ignoring malformed user event ID %q: %v", notification.Extra, err)
+			return
+		}
+		f.publishEvent(eventID)
+	default:
+		var change UserChange
+		if err := json.Unmarshal([]byte(notification.Extra), &change); err != nil {
+			f.logger.Warning("Ignoring malformed user change %q: %v", notification.Extra, err)
+			return
+		}
+		f.publish(change)
+	}
+}
+
+func (f *UserChangeFeed) publish(change UserChange) {
+	f.mu.Lock()
+	handlers := make([]func(UserChange), 0, len(f.subscribers))
+	for _, handler := range f.subscribers {
+		handlers = append(handlers, handler)
+	}
+	f.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(change)
+	}
+}
+
+func (f *UserChangeFeed) publishEvent(eventID int64) {
+	f.mu.Lock()
+	handlers := make([]func(int64), 0, len(f.eventSubscribers))
+	for _, handler := range f.eventSubscribers {
+		handlers = append(handlers, handler)
+	}
+	f.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(eventID)
+	}
+}
+
+func (f *UserChangeFeed) logListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		f.logger.Warning("User change feed lost its connection: %v", err)
+	case pq.ListenerEventReconnected:
+		f.logger.Info("User change feed reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		f.logger.Warning("User change feed failed to connect: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/lib/pq"
+)
+
+func newTestFeed(t *testing.T) (*UserChangeFeed, *utils.Logger) {
+	t.Helper()
+	logger, err := utils.NewLogger(filepath.Join(t.TempDir(), "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(logger.Close)
+	return NewUserChangeFeed("", UserChangeFeedOptions{}, logger), logger
+}
+
+func TestUserChangeFeedSubscribeAndUnsubscribe(t *testing.T) {
+	feed, _ := newTestFeed(t)
+
+	var first, second []UserChange
+	unsubscribeFirst := feed.Subscribe(func(change UserChange) { first = append(first, change) })
+	feed.Subscribe(func(change UserChange) { second = append(second, change) })
+
+	feed.dispatch(&pq.Notification{Channel: UserChangesChannel, Extra: `{"op":"UPDATE","id":7,"version":3,"deleted":false}`})
+	unsubscribeFirst()
+	unsubscribeFirst()
+	feed.dispatch(&pq.Notification{Channel: UserChangesChannel, Extra: `{"op":"UPDATE","id":7,"version":4,"deleted":true}`})
+
+	want := UserChange{Operation: "UPDATE", UserID: 7, Version: 3}
+	if len(first) != 1 || first[0] != want {
+		t.Errorf("unsubscribed handler got %+v, want only %+v", first, want)
+	}
+	if len(second) != 2 || second[1] != (UserChange{Operation: "UPDATE", UserID: 7, Version: 4, Deleted: true}) {
+		t.Errorf("subscribed handler got %+v, want both changes", second)
+	}
+}
+
+func TestUserChangeFeedDispatch(t *testing.T) {
+	feed, _ := newTestFeed(t)
+
+	var changes []UserChange
+	var eventIDs []int64
+	feed.Subscribe(func(change UserChange) { changes = append(changes, change) })
+	unsubscribeEvents := feed.SubscribeEvents(func(eventID int64) { eventIDs = append(eventIDs, eventID) })
+
+	feed.dispatch(&pq.Notification{Channel: UserEventsChannel, Extra: "42"})
+	feed.dispatch(&pq.Notification{Channel: UserEventsChannel, Extra: "not an id"})
+	feed.dispatch(&pq.Notification{Channel: UserChangesChannel, Extra: "{"})
+	// A reconnect
+	feed.dispatch(nil)
+	unsubscribeEvents()
+	feed.dispatch(&pq.Notification{Channel: UserEventsChannel, Extra: "43"})
+
+	if fmt.Sprint(eventIDs) != "[42]" {
+		t.Errorf("event IDs = %v, want [42]", eventIDs)
+	}
+	if len(changes) != 1 || changes[0].Operation != UserChangeResync {
+		t.Errorf("changes = %+v, want only a resync", changes)
+	}
+}
+
+func TestBrokerFollowsFeedAndResetsOnResync(t *testing.T) {
+	feed, logger := newTestFeed(t)
+	broker := NewBroker(10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker.Follow(ctx, feed, func(_ context.Context, id int64) (Event, error) {
+		if id == 2 {
+			return Event{}, errors.New("purged")
+		}
+		return Event{ID: id, Type: "user.updated"}, nil
+	}, logger)
+
+	subscription, _, _, err := broker.Subscribe(nil)
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	defer subscription.Close()
+
+	for _, id := range []string{"1", "2", "3", "1"} {
+		feed.dispatch(&pq.Notification{Channel: UserEventsChannel, Extra: id})
+	}
+	feed.dispatch(nil)
+
+	var got []string
+	for len(got) < 3 {
+		event := <-subscription.Events()
+		got = append(got, fmt.Sprintf("%d:%s", event.ID, event.Type))
+	}
+	if want := "[1:user.updated 3:user.updated 0:reset]"; fmt.Sprint(got) != want {
+		t.Errorf("stream got %v, want %s", got, want)
+	}
+
+	// The events before the resync are forgotten, so resuming after them resets too
+	lastEventID := int64(3)
+	resumed, replay, complete, err := broker.Subscribe(&lastEventID)
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	defer resumed.Close()
+	if complete || len(replay) != 0 {
+		t.Errorf("resuming after a resync replayed %v, complete %v", replay, complete)
+	}
+}
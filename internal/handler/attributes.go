@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+// attributeFilterPrefix marks list query parameters that filter on custom
+// attributes, as in ?attributes.department=Sales
+const attributeFilterPrefix = "attributes."
+
+// validateRequest runs utils.ValidateStruct and checks custom attributes against
+// the deployment's schema. It is for updates, where nil attributes are not being
+// set and are skipped.
+func validateRequest(req any, attributes map[string]any, schema *utils.JSONSchema) []utils.ValidationError {
+	validationErrors := utils.ValidateStruct(req)
+	if attributes != nil {
+		validationErrors = append(validationErrors, schema.Validate("attributes", attributes)...)
+	}
+	return validationErrors
+}
+
+// validateCreateRequest is validateRequest for a new user, whose missing
+// attributes are an empty object that must still satisfy required attributes
+func validateCreateRequest(req any, attributes map[string]any, schema *utils.JSONSchema) []utils.ValidationError {
+	return append(utils.ValidateStruct(req), schema.Validate("attributes", utils.AttributesOrEmpty(attributes))...)
+}
+
+// parseAttributeFilter collects attribute filters from the query, converting
+// each value to the type the schema declares for that attribute
+func parseAttributeFilter(params url.Values, schema *utils.JSONSchema) (map[string]any, []utils.ValidationError) {
+	var attributes map[string]any
+	var validationErrors []utils.ValidationError
+
+	for key, values := range params {
+		name, ok := strings.CutPrefix(key, attributeFilterPrefix)
+		if !ok {
+			continue
+		}
+
+		property := schema.Property(name)
+		if property == nil {
+			validationErrors = append(validationErrors, utils.ValidationError{Field: key, Error: "Unknown attribute"})
+			continue
+		}
+
+		value, err := property.ParseScalar(values[0])
+		if err != nil {
+			validationErrors = append(validationErrors, utils.ValidationError{Field: key, Error: "Attribute " + err.Error()})
+			continue
+		}
+
+		if attributes == nil {
+			attributes = map[string]any{}
+		}
+		attributes[name] = value
+	}
+
+	return attributes, validationErrors
+}
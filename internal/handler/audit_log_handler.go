@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+const maxAuditLogLimit = 100
+
+type AuditLogHandler struct {
+	auditService service.AuditService
+	logger       *utils.Logger
+}
+
+func NewAuditLogHandler(auditService service.AuditService, logger *utils.Logger) *AuditLogHandler {
+	return &AuditLogHandler{auditService: auditService, logger: logger}
+}
+
+// List returns audit entries, newest first, filtered by actor_id, action,
+// target_type, target_id and a from/to time range
+func (h *AuditLogHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	filter, validationErrors := parseAuditLogFilter(r)
+	if validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for audit log filter")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	query := &model.PaginationQuery{
+		Page:  max(page, 1),
+		Limit: min(utils.Default(limit, 20), maxAuditLogLimit),
+	}
+	query.Offset = (query.Page - 1) * query.Limit
+
+	response, err := h.auditService.List(ctx, filter, query)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to list audit log: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeResponse(w, http.StatusOK, response.Data, response.Message, response.Meta)
+}
+
+func parseAuditLogFilter(r *http.Request) (*model.AuditLogFilter, []utils.ValidationError) {
+	params := r.URL.Query()
+	var validationErrors []utils.ValidationError
+
+	filter := &model.AuditLogFilter{
+		Action:     strings.TrimSpace(params.Get("action")),
+		TargetType: strings.TrimSpace(params.Get("target_type")),
+	}
+
+	for _, name := range []string{"actor_id", "target_id"} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			validationErrors = append(validationErrors, utils.ValidationError{Field: name, Error: "Must be a positive integer"})
+			continue
+		}
+		if name == "actor_id" {
+			filter.ActorID = &id
+		} else {
+			filter.TargetID = &id
+		}
+	}
+
+	if value := params.Get("from"); value != "" {
+		if t, err := parseTimeParam(value, false); err == nil {
+			filter.From = &t
+		} else {
+			validationErrors = append(validationErrors, invalidDateError("from"))
+		}
+	}
+
+	if value := params.Get("to"); value != "" {
+		if t, err := parseTimeParam(value, true); err == nil {
+			filter.To = &t
+		} else {
+			validationErrors = append(validationErrors, invalidDateError("to"))
+		}
+	}
+
+	return filter, validationErrors
+}
@@ -1,12 +1,14 @@
 package handler
 
 import (
+	stdcontext "context"
 	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/Rafli-Dewanto/go-template/internal/auth"
 	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
 	"github.com/Rafli-Dewanto/go-template/internal/model"
 	"github.com/Rafli-Dewanto/go-template/internal/service"
 	"github.com/Rafli-Dewanto/go-template/internal/utils"
@@ -14,13 +16,15 @@ import (
 )
 
 type AuthHandler struct {
-	userService  service.UserService
-	tokenManager *auth.TokenManager
-	logger       *utils.Logger
+	userService       service.UserService
+	loginEventService service.LoginEventService
+	tokenManager      *auth.TokenManager
+	attributes        *utils.JSONSchema
+	logger            *utils.Logger
 }
 
-func NewAuthHandler(userService service.UserService, tokenManager *auth.TokenManager, logger *utils.Logger) *AuthHandler {
-	return &AuthHandler{userService: userService, tokenManager: tokenManager, logger: logger}
+func NewAuthHandler(userService service.UserService, loginEventService service.LoginEventService, tokenManager *auth.TokenManager, attributes *utils.JSONSchema, logger *utils.Logger) *AuthHandler {
+	return &AuthHandler{userService: userService, loginEventService: loginEventService, tokenManager: tokenManager, attributes: attributes, logger: logger}
 }
 
 type LoginRequest struct {
@@ -51,19 +55,56 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attempt := model.LoginAttempt{
+		Email:     req.Email,
+		Method:    entity.LoginMethodPassword,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
 	user, err := h.userService.GetByEmail(cancelCtx, req.Email)
 	if err != nil {
 		h.logger.WarningWithAPIID(apiID, "Invalid credentials")
+		attempt.FailureReason = entity.LoginFailureUnknownEmail
+		h.recordLogin(ctx, apiID, attempt)
 		WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	attempt.UserID = &user.ID
 
 	if err := auth.ComparePassword(user.Password, req.Password); err != nil {
 		h.logger.WarningWithAPIID(apiID, "Invalid credentials")
+		attempt.FailureReason = entity.LoginFailureInvalidPassword
+		h.recordLogin(ctx, apiID, attempt)
+		WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	// A deleted account is refused like an unknown one
+	if user.DeletedAt != nil {
+		h.logger.WarningWithAPIID(apiID, "Login refused for deleted user %d", user.ID)
+		attempt.FailureReason = entity.LoginFailureDeleted
+		h.recordLogin(ctx, apiID, attempt)
 		WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
+	// Only after the password matched, so the status does not reveal which emails exist
+	if err := service.AccountStatusError(user.Status); err != nil {
+		h.logger.WarningWithAPIID(apiID, "Login refused for user %d: %v", user.ID, err)
+		switch err {
+		case service.ErrAccountSuspended:
+			attempt.FailureReason = entity.LoginFailureSuspended
+		case service.ErrAccountBanned:
+			attempt.FailureReason = entity.LoginFailureBanned
+		case service.ErrAccountPending:
+			attempt.FailureReason = entity.LoginFailurePending
+		}
+		h.recordLogin(ctx, apiID, attempt)
+		WriteAccountStatusError(w, err)
+		return
+	}
+
 	token, err := h.tokenManager.GenerateToken(user.ID, user.Username)
 	if err != nil {
 		h.logger.ErrorWithAPIID(apiID, "Failed to generate token: %v", err)
@@ -71,10 +112,21 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attempt.Success = true
+	h.recordLogin(ctx, apiID, attempt)
+
 	response := LoginResponse{Token: token}
 	writeResponse(w, http.StatusOK, response, "Login successful", nil)
 }
 
+// recordLogin stores a login attempt. Failing to record one does not fail the
+// login, the attempt is still in the application log.
+func (h *AuthHandler) recordLogin(ctx stdcontext.Context, apiID string, attempt model.LoginAttempt) {
+	if err := h.loginEventService.Record(ctx, attempt); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to record login attempt: success=%t reason=%s: %v", attempt.Success, attempt.FailureReason, err)
+	}
+}
+
 func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	ctx := context.WithRequestID(r.Context(), uuid.New().String())
 	apiID := context.GetAPIID(ctx)
@@ -94,6 +146,12 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if validationErrors := validateCreateRequest(req, req.Attributes, h.attributes); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for user registration")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
 		h.logger.ErrorWithAPIID(apiID, "Failed to hash password: %v", err)
@@ -102,7 +160,7 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	}
 	req.Password = hashedPassword
 
-	err = h.userService.Create(cancelCtx, &req)
+	err = h.userService.SignUp(cancelCtx, &req)
 	if err != nil {
 		switch err {
 		case service.ErrInvalidInput:
@@ -113,6 +171,14 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 			h.logger.WarningWithAPIID(apiID, "User with email or username already exists")
 			WriteErrorResponse(w, http.StatusConflict, "User already exists")
 			return
+		case service.ErrUsernameReserved:
+			h.logger.WarningWithAPIID(apiID, "Reserved username rejected for user registration")
+			WriteErrorResponse(w, http.StatusConflict, "Username is reserved")
+			return
+		case service.ErrUsernameOnHold:
+			h.logger.WarningWithAPIID(apiID, "Recently released username rejected for user registration")
+			WriteErrorResponse(w, http.StatusConflict, "Username was recently released and cannot be claimed yet")
+			return
 		default:
 			h.logger.ErrorWithAPIID(apiID, "Failed to create user: %v", err)
 			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
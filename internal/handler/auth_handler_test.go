@@ -0,0 +1,110 @@
+package handler
+
+import (
+	stdcontext "context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+func newTestLogger(t *testing.T) *utils.Logger {
+	t.Helper()
+	logger, err := utils.NewLogger(filepath.Join(t.TempDir(), "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(logger.Close)
+	return logger
+}
+
+// loginUserService only finds one user by email, other methods are not used by Login
+type loginUserService struct {
+	service.UserService
+	user *entity.User
+}
+
+func (s *loginUserService) GetByEmail(_ stdcontext.Context, email string) (*entity.User, error) {
+	if email != s.user.Email {
+		return nil, service.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+type recordedLogins struct {
+	service.LoginEventService
+	attempts []model.LoginAttempt
+}
+
+func (s *recordedLogins) Record(_ stdcontext.Context, attempt model.LoginAttempt) error {
+	s.attempts = append(s.attempts, attempt)
+	return nil
+}
+
+func TestLoginRefusesDeletedUsers(t *testing.T) {
+	password, err := auth.HashPassword("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletedAt := time.Now()
+	users := &loginUserService{user: &entity.User{ID: 7, Username: "alice", Email: "alice@example.com", Password: password, Status: entity.UserStatusActive}}
+	logins := &recordedLogins{}
+	h := NewAuthHandler(users, logins, auth.NewTokenManager("secret"), nil, newTestLogger(t))
+
+	login := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Login(rec, httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"alice@example.com","password":"secret123"}`)))
+		return rec
+	}
+
+	if rec := login(); rec.Code != http.StatusOK {
+		t.Fatalf("login of an active user: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	users.user.DeletedAt = &deletedAt
+	rec := login()
+	if rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), "token") {
+		t.Errorf("login of a deleted user: status = %d, body %s, want a 401 without a token", rec.Code, rec.Body)
+	}
+	last := logins.attempts[len(logins.attempts)-1]
+	if last.Success || last.FailureReason != entity.LoginFailureDeleted {
+		t.Errorf("recorded attempt %+v, want a failure with reason %s", last, entity.LoginFailureDeleted)
+	}
+}
+
+func TestSignUpValidatesTheRequest(t *testing.T) {
+	attributes, err := utils.LoadJSONSchema("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No user service, invalid registrations never reach it
+	h := NewAuthHandler(nil, nil, nil, attributes, newTestLogger(t))
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{name: "confusable username", body: `{"username":"аdmin","email":"a@example.com","password":"secret123"}`, field: "username"},
+		{name: "invalid email", body: `{"username":"alice","email":"not-an-email","password":"secret123"}`, field: "email"},
+		{name: "short password", body: `{"username":"alice","email":"a@example.com","password":"x"}`, field: "password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.SignUp(rec, httptest.NewRequest(http.MethodPost, "/auth/signup", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(strings.ToLower(rec.Body.String()), tt.field) {
+				t.Errorf("status = %d, body %s, want a 400 naming %s", rec.Code, rec.Body, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// authorizeUserAccess resolves the {id} URL parameter, where "me" stands for the caller,
+// and checks that the caller may access that user's data. It writes the error
+// response itself and returns false when the request must not proceed.
+func authorizeUserAccess(w http.ResponseWriter, r *http.Request, policy *auth.AccessPolicy) (*auth.Claims, int64, bool) {
+	claims, ok := auth.GetUserClaims(r.Context())
+	if !ok {
+		WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, 0, false
+	}
+
+	userID, err := resolveUserID(chi.URLParam(r, "id"), claims)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return nil, 0, false
+	}
+
+	if !policy.CanAccessUser(claims, userID) {
+		WriteErrorResponse(w, http.StatusForbidden, "Forbidden")
+		return nil, 0, false
+	}
+
+	return claims, userID, true
+}
+
+func resolveUserID(idStr string, claims *auth.Claims) (int64, error) {
+	if idStr == "me" && claims != nil {
+		return claims.UserID, nil
+	}
+	return utils.StringToInt64(idStr)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/storage"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// avatarFormField is the multipart field the image is uploaded in
+const avatarFormField = "avatar"
+
+// multipartOverhead leaves room for boundaries and part headers on top of the file size limit
+const multipartOverhead = 64 << 10
+
+type AvatarHandler struct {
+	avatarService service.AvatarService
+	store         storage.BlobStore
+	policy        *auth.AccessPolicy
+	maxBytes      int64
+	logger        *utils.Logger
+}
+
+func NewAvatarHandler(avatarService service.AvatarService, store storage.BlobStore, policy *auth.AccessPolicy, maxBytes int64, logger *utils.Logger) *AvatarHandler {
+	return &AvatarHandler{avatarService: avatarService, store: store, policy: policy, maxBytes: maxBytes, logger: logger}
+}
+
+func (h *AvatarHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		h.logger.WarningWithAPIID(apiID, "Avatar upload is not multipart: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Expected multipart/form-data request")
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Avatar file is too large")
+				return
+			}
+			if errors.Is(err, io.EOF) {
+				WriteErrorResponse(w, http.StatusBadRequest, "Missing avatar file")
+				return
+			}
+			h.logger.WarningWithAPIID(apiID, "Failed to read multipart body: %v", err)
+			WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if part.FormName() != avatarFormField {
+			part.Close()
+			continue
+		}
+
+		avatar, err := h.avatarService.Upload(ctx, userID, part)
+		part.Close()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.Is(err, service.ErrAvatarTooLarge), errors.As(err, &maxBytesErr):
+				WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Avatar file is too large")
+			case errors.Is(err, service.ErrUnsupportedImageType):
+				WriteErrorResponse(w, http.StatusUnsupportedMediaType, "Avatar must be a JPEG, PNG or GIF image")
+			case errors.Is(err, service.ErrInvalidImageSize):
+				WriteErrorResponse(w, http.StatusUnprocessableEntity, "Avatar dimensions are out of range")
+			case errors.Is(err, service.ErrUserNotFound):
+				WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			default:
+				h.logger.ErrorWithAPIID(apiID, "Failed to upload avatar: %v", err)
+				WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+			}
+			return
+		}
+
+		writeResponse(w, http.StatusOK, avatar, "Avatar uploaded successfully", nil)
+		return
+	}
+}
+
+func (h *AvatarHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	if err := h.avatarService.Delete(ctx, userID); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.logger.ErrorWithAPIID(apiID, "Failed to delete avatar: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Serve streams a stored blob, it backs the public URLs of the local blob store
+func (h *AvatarHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	// Only avatars are public, other blobs such as data exports are handed out
+	// after an access check
+	key := chi.URLParam(r, "*")
+	if !strings.HasPrefix(key, "avatars/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, contentType, err := h.store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			http.NotFound(w, r)
+			return
+		}
+		h.logger.ErrorWithAPIID(apiID, "Failed to read blob: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer body.Close()
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, body)
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type DataExportHandler struct {
+	exportService service.DataExportService
+	policy        *auth.AccessPolicy
+	logger        *utils.Logger
+}
+
+func NewDataExportHandler(exportService service.DataExportService, policy *auth.AccessPolicy, logger *utils.Logger) *DataExportHandler {
+	return &DataExportHandler{exportService: exportService, policy: policy, logger: logger}
+}
+
+func (h *DataExportHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	claims, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	var req model.CreateDataExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.ErrorWithAPIID(apiID, "Failed to decode request body: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for data export request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	export, err := h.exportService.Request(ctx, userID, claims.UserID, req.Format)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidInput:
+			h.logger.WarningWithAPIID(apiID, "Invalid input for data export: %v", err)
+			WriteErrorResponse(w, http.StatusBadRequest, "Invalid input")
+		case service.ErrUserNotFound:
+			h.logger.WarningWithAPIID(apiID, "User not found for data export with ID: %d", userID)
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+		default:
+			h.logger.ErrorWithAPIID(apiID, "Failed to request data export: %v", err)
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/users/%d/exports/%s", userID, export.ID))
+	writeResponse(w, http.StatusAccepted, export, "Data export requested", nil)
+}
+
+func (h *DataExportHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	exportID := chi.URLParam(r, "exportID")
+	export, err := h.exportService.GetByID(ctx, userID, exportID)
+	if err != nil {
+		if errors.Is(err, service.ErrExportNotFound) {
+			h.logger.WarningWithAPIID(apiID, "Data export not found with ID: %s", exportID)
+			WriteErrorResponse(w, http.StatusNotFound, "Export not found")
+			return
+		}
+		h.logger.ErrorWithAPIID(apiID, "Failed to get data export: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeResponse(w, http.StatusOK, export, "Data export retrieved successfully", nil)
+}
+
+func (h *DataExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	exportID := chi.URLParam(r, "exportID")
+	file, err := h.exportService.GetFile(ctx, userID, exportID)
+	if err != nil {
+		switch err {
+		case service.ErrExportNotFound:
+			h.logger.WarningWithAPIID(apiID, "Data export not found with ID: %s", exportID)
+			WriteErrorResponse(w, http.StatusNotFound, "Export not found")
+		case service.ErrExportNotReady:
+			WriteErrorResponse(w, http.StatusConflict, "Export is not ready yet")
+		case service.ErrExportExpired:
+			WriteErrorResponse(w, http.StatusGone, "Export file is no longer available")
+		default:
+			h.logger.ErrorWithAPIID(apiID, "Failed to get data export file: %v", err)
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	defer file.Body.Close()
+
+	filename := fmt.Sprintf("user-%d-export.%s", userID, file.Format)
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := io.Copy(w, file.Body); err != nil {
+		h.logger.WarningWithAPIID(apiID, "Failed to send data export file: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+type EmailChangeHandler struct {
+	emailChangeService service.EmailChangeService
+	policy             *auth.AccessPolicy
+	logger             *utils.Logger
+}
+
+func NewEmailChangeHandler(emailChangeService service.EmailChangeService, policy *auth.AccessPolicy, logger *utils.Logger) *EmailChangeHandler {
+	return &EmailChangeHandler{emailChangeService: emailChangeService, policy: policy, logger: logger}
+}
+
+func (h *EmailChangeHandler) Request(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	var req model.RequestEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to decode request body: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for email change request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	change, err := h.emailChangeService.Request(ctx, userID, req.Email)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+		case service.ErrEmailUnchanged:
+			WriteErrorResponse(w, http.StatusBadRequest, "New email is the same as the current one")
+		case service.ErrEmailAlreadyInUse:
+			WriteErrorResponse(w, http.StatusConflict, "Email is already in use")
+		default:
+			h.logger.ErrorWithAPIID(apiID, "Failed to request email change: %v", err)
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	writeResponse(w, http.StatusAccepted, change, "Confirmation sent to the new email address", nil)
+}
+
+// ShowConfirm returns the pending change behind the link mailed to the new
+// address. Following the link changes nothing, the client confirms with a POST.
+func (h *EmailChangeHandler) ShowConfirm(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	change, err := h.emailChangeService.GetByConfirmToken(ctx, r.URL.Query().Get("token"))
+	if err != nil {
+		h.writeTokenError(w, apiID, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, change, "Email change awaiting confirmation", nil)
+}
+
+// Confirm applies a pending change, the token comes from the confirmation link
+func (h *EmailChangeHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	token, ok := h.decodeToken(w, r, apiID)
+	if !ok {
+		return
+	}
+
+	change, err := h.emailChangeService.Confirm(ctx, token)
+	if err != nil {
+		h.writeTokenError(w, apiID, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, change, "Email address changed successfully", nil)
+}
+
+// ShowRevert returns the change behind the link mailed to the old address,
+// the client reverts it with a POST
+func (h *EmailChangeHandler) ShowRevert(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	change, err := h.emailChangeService.GetByRevertToken(ctx, r.URL.Query().Get("token"))
+	if err != nil {
+		h.writeTokenError(w, apiID, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, change, "Email change can be reverted", nil)
+}
+
+// Revert undoes a change, the token comes from the revert link
+func (h *EmailChangeHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	token, ok := h.decodeToken(w, r, apiID)
+	if !ok {
+		return
+	}
+
+	change, err := h.emailChangeService.Revert(ctx, token)
+	if err != nil {
+		h.writeTokenError(w, apiID, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, change, "Email change reverted successfully", nil)
+}
+
+func (h *EmailChangeHandler) decodeToken(w http.ResponseWriter, r *http.Request, apiID string) (string, bool) {
+	var req model.EmailChangeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to decode request body: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return "", false
+	}
+
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for email change token")
+		writeValidationErrorResponse(w, validationErrors)
+		return "", false
+	}
+	return req.Token, true
+}
+
+func (h *EmailChangeHandler) writeTokenError(w http.ResponseWriter, apiID string, err error) {
+	switch {
+	case errors.Is(err, service.ErrEmailChangeNotFound):
+		WriteErrorResponse(w, http.StatusNotFound, "Link is invalid or has expired")
+	case errors.Is(err, service.ErrEmailChangeConflict):
+		WriteErrorResponse(w, http.StatusConflict, "Email address has changed since this link was sent")
+	case errors.Is(err, service.ErrEmailAlreadyInUse):
+		WriteErrorResponse(w, http.StatusConflict, "Email is already in use")
+	default:
+		h.logger.ErrorWithAPIID(apiID, "Failed to process email change link: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
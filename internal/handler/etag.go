@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+// versionETag renders a row version as a strong entity tag
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch extracts the version a client expects from an If-Match header.
+// "*" matches any version and yields 0. Weak tags never match, and neither
+// does anything we did not issue, so both report ok=false.
+func parseIfMatch(header string) (version int64, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// writeConditionalResponse writes a 200 response with validators, or a bare 304
+// when the request's If-None-Match or If-Modified-Since shows the client already
+// has it. An empty etag is derived from the body, as is the etag of a response
+// trimmed with ?fields= or ?expand= since the version no longer identifies it.
+// A zero lastModified omits the header, lists should do that since removing a
+// row does not move any timestamp.
+func writeConditionalResponse(w http.ResponseWriter, r *http.Request, data any, message string, meta any, etag string, lastModified time.Time) {
+	if shapeOf(w) != nil {
+		shaped, validationErrors, err := shapeData(w, data)
+		if validationErrors != nil {
+			writeValidationErrorResponse(w, validationErrors)
+			return
+		}
+		if err != nil {
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		data, etag = shaped, ""
+	}
+
+	body, err := json.Marshal(model.Response{Data: data, Message: message, Meta: meta})
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since only
+// when the former is absent (RFC 9110 section 13.2.2)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	// Last-Modified only has second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
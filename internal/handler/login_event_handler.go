@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+const maxLoginHistoryLimit = 100
+
+type LoginEventHandler struct {
+	loginEventService service.LoginEventService
+	policy            *auth.AccessPolicy
+	logger            *utils.Logger
+}
+
+func NewLoginEventHandler(loginEventService service.LoginEventService, policy *auth.AccessPolicy, logger *utils.Logger) *LoginEventHandler {
+	return &LoginEventHandler{loginEventService: loginEventService, policy: policy, logger: logger}
+}
+
+// History lists a user's login attempts, newest first, to the user and to admins
+func (h *LoginEventHandler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, userID, ok := authorizeUserAccess(w, r, h.policy)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	query := &model.PaginationQuery{
+		Page:  max(page, 1),
+		Limit: min(utils.Default(limit, 20), maxLoginHistoryLimit),
+	}
+	query.Offset = (query.Page - 1) * query.Limit
+
+	response, err := h.loginEventService.History(ctx, userID, query)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to list login history: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeResponse(w, http.StatusOK, response.Data, response.Message, response.Meta)
+}
+
+// clientIP is the caller's address without the port, RealIP has already
+// applied X-Forwarded-For and X-Real-IP
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
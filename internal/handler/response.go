@@ -9,7 +9,19 @@ import (
 	"github.com/Rafli-Dewanto/go-template/internal/utils"
 )
 
-func writeResponse(w http.ResponseWriter, statusCode int, data interface{}, message string, meta *model.PaginatedMeta) {
+func writeResponse(w http.ResponseWriter, statusCode int, data interface{}, message string, meta any) {
+	if _, ok := data.([]utils.ValidationError); !ok && statusCode < http.StatusMultipleChoices {
+		shaped, validationErrors, err := shapeData(w, data)
+		switch {
+		case validationErrors != nil:
+			statusCode, data, message, meta = http.StatusBadRequest, validationErrors, "Validation failed", nil
+		case err != nil:
+			statusCode, data, message, meta = http.StatusInternalServerError, nil, "Internal server error", nil
+		default:
+			data = shaped
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
@@ -34,7 +46,7 @@ func writeResponse(w http.ResponseWriter, statusCode int, data interface{}, mess
 }
 
 // writeResponseWithContext writes HTTP response with API ID from context
-func writeResponseWithContext(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}, message string, meta *model.PaginatedMeta) {
+func writeResponseWithContext(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}, message string, meta any) {
 	// Get API ID from context and add to response header
 	if apiID := context.GetAPIID(r.Context()); apiID != "" {
 		w.Header().Set("X-API-ID", apiID)
@@ -47,6 +59,13 @@ func WriteErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 	writeResponse(w, statusCode, nil, message, nil)
 }
 
+// writeErrorCodeResponse writes an error response carrying a machine readable code
+func writeErrorCodeResponse(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(model.Response{Code: code, Message: message})
+}
+
 // WriteErrorResponseWithContext writes error response with API ID from context
 func WriteErrorResponseWithContext(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
 	writeResponseWithContext(w, r, statusCode, nil, message, nil)
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+// Expander inlines a related resource into response objects under ?expand=<name>
+type Expander interface {
+	// CanExpand reports whether item, an element of the response data, supports the expansion
+	CanExpand(item any) bool
+	Expand(ctx stdcontext.Context, item any) (any, error)
+}
+
+// responseShape is the projection and expansion a request asked for
+type responseShape struct {
+	ctx       stdcontext.Context
+	fields    []string
+	expand    []string
+	expanders map[string]Expander
+}
+
+// ShapeResponses lets clients trim responses with ?fields=a,b and inline related
+// resources with ?expand=x. resource is a sample of what the wrapped routes
+// respond with, e.g. &model.UserResponse{}. The shape is checked against it
+// before the handler runs, so a bad shape never gets as far as a write, and is
+// applied by writeResponse to whatever data a handler writes, single objects
+// and lists alike.
+func ShapeResponses(resource any, expanders map[string]Expander) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			shape := &responseShape{
+				ctx:       r.Context(),
+				fields:    splitList(r.URL.Query().Get("fields")),
+				expand:    splitList(r.URL.Query().Get("expand")),
+				expanders: expanders,
+			}
+			if len(shape.fields) == 0 && len(shape.expand) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if validationErrors := shape.validate(resource); validationErrors != nil {
+				writeValidationErrorResponse(w, validationErrors)
+				return
+			}
+			next.ServeHTTP(&shapedWriter{ResponseWriter: w, shape: shape}, r)
+		})
+	}
+}
+
+// validate reports the fields and expansions sample, a struct or a pointer to
+// one, does not have
+func (s *responseShape) validate(sample any) []utils.ValidationError {
+	structType := reflect.TypeOf(sample)
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	names := jsonFieldNames(structType)
+
+	var validationErrors []utils.ValidationError
+	for _, field := range s.fields {
+		if !slices.Contains(names, field) {
+			validationErrors = append(validationErrors, utils.ValidationError{Field: "fields", Error: fmt.Sprintf("Unknown field %q", field)})
+		}
+	}
+	for _, name := range s.expand {
+		if expander, ok := s.expanders[name]; !ok || !expander.CanExpand(sample) {
+			validationErrors = append(validationErrors, utils.ValidationError{Field: "expand", Error: fmt.Sprintf("Unknown expansion %q", name)})
+		}
+	}
+	return validationErrors
+}
+
+type shapedWriter struct {
+	http.ResponseWriter
+	shape *responseShape
+}
+
+func (s *shapedWriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *shapedWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// shapeOf finds the response shape of w, looking through wrapping middleware writers
+func shapeOf(w http.ResponseWriter) *responseShape {
+	for {
+		if shaped, ok := w.(*shapedWriter); ok {
+			return shaped.shape
+		}
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = wrapper.Unwrap()
+	}
+}
+
+// shapeData applies the requested shape to data, which may be a struct or a slice
+// of structs
+func shapeData(w http.ResponseWriter, data any) (any, []utils.ValidationError, error) {
+	shape := shapeOf(w)
+	if shape == nil || data == nil {
+		return data, nil, nil
+	}
+
+	value := reflect.ValueOf(data)
+	isList := value.Kind() == reflect.Slice
+	itemType := value.Type()
+	if isList {
+		itemType = itemType.Elem()
+	}
+	structType := itemType
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return data, nil, nil
+	}
+
+	names := jsonFieldNames(structType)
+	sample := reflect.New(structType).Interface()
+	if itemType.Kind() != reflect.Pointer {
+		sample = reflect.Zero(itemType).Interface()
+	}
+
+	// Already checked against the resource of the route, this only fails for a
+	// handler responding with something else
+	if validationErrors := shape.validate(sample); validationErrors != nil {
+		return nil, validationErrors, nil
+	}
+
+	if len(shape.fields) > 0 {
+		names = slices.DeleteFunc(names, func(name string) bool {
+			return !slices.Contains(shape.fields, name)
+		})
+	}
+
+	if !isList {
+		object, err := shape.object(data, names)
+		return object, nil, err
+	}
+
+	objects := make([]orderedObject, value.Len())
+	for i := range objects {
+		object, err := shape.object(value.Index(i).Interface(), names)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects[i] = object
+	}
+	return objects, nil, nil
+}
+
+func (s *responseShape) object(item any, names []string) (orderedObject, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	object := make(orderedObject, 0, len(names)+len(s.expand))
+	for _, name := range names {
+		if value, ok := raw[name]; ok {
+			object = append(object, objectMember{name: name, value: value})
+		}
+	}
+	for _, name := range s.expand {
+		value, err := s.expanders[name].Expand(s.ctx, item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand %s: %w", name, err)
+		}
+		object = append(object, objectMember{name: name, value: value})
+	}
+	return object, nil
+}
+
+// jsonFieldNames lists the JSON member names of a struct type in declaration order
+func jsonFieldNames(structType reflect.Type) []string {
+	var names []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// orderedObject marshals as a JSON object whose members keep their order
+type orderedObject []objectMember
+
+type objectMember struct {
+	name  string
+	value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, member := range o {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		name, err := json.Marshal(member.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, name...)
+		buf = append(buf, ':')
+		buf = append(buf, value...)
+	}
+	return append(buf, '}'), nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// avatarExpander inlines the avatar and its thumbnail URLs into users
+type avatarExpander struct {
+	avatarService service.AvatarService
+}
+
+func NewAvatarExpander(avatarService service.AvatarService) Expander {
+	return &avatarExpander{avatarService: avatarService}
+}
+
+func (e *avatarExpander) CanExpand(item any) bool {
+	_, ok := item.(*model.UserResponse)
+	return ok
+}
+
+func (e *avatarExpander) Expand(_ stdcontext.Context, item any) (any, error) {
+	user := item.(*model.UserResponse)
+	return e.avatarService.Variants(user.AvatarURL, user.AvatarKey), nil
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func TestShapeResponsesRejectsUnknownFieldsBeforeTheHandler(t *testing.T) {
+	for _, target := range []string{"/users/1?fields=bogus", "/users/1?expand=roles", "/users/1?fields=id&expand=avatar"} {
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+		rec := httptest.NewRecorder()
+		ShapeResponses(&model.UserResponse{}, nil)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, target, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, rec.Code)
+		}
+		if called {
+			t.Errorf("%s: handler ran despite the invalid shape", target)
+		}
+	}
+}
+
+func TestShapeResponsesProjectsFields(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users := []*model.UserResponse{{ID: 1, Username: "john", Email: "john@example.com"}}
+		writeResponse(w, http.StatusOK, users, "ok", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	ShapeResponses(&model.UserResponse{}, nil)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?fields=username,id", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"data":[{"id":1,"username":"john"}]`) {
+		t.Errorf("body = %s, want only id and username", body)
+	}
+}
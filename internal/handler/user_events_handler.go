@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/events"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+// sseRetry is how long browsers wait before reconnecting a dropped stream
+const sseRetry = 3 * time.Second
+
+type UserEventsHandler struct {
+	broker    *events.Broker
+	heartbeat time.Duration
+	logger    *utils.Logger
+}
+
+func NewUserEventsHandler(broker *events.Broker, heartbeat time.Duration, logger *utils.Logger) *UserEventsHandler {
+	return &UserEventsHandler{broker: broker, heartbeat: heartbeat, logger: logger}
+}
+
+// Stream pushes user changes as server-sent events, named after the event type
+// such as user.created, with the event as JSON data. A client reconnecting with
+// Last-Event-ID, or last_event_id in the query, first gets the events it missed.
+// When those are no longer buffered, or events were missed while the stream was
+// open, a reset event tells it to reload instead.
+func (h *UserEventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	lastEventID, ok := parseLastEventID(r)
+	if !ok {
+		writeValidationErrorResponse(w, []utils.ValidationError{{Field: "Last-Event-ID", Error: "Must be an event ID"}})
+		return
+	}
+
+	subscription, replay, complete, err := h.broker.Subscribe(lastEventID)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+	defer subscription.Close()
+
+	// Streams outlive any write timeout of the server
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	if !complete {
+		writeReset(w)
+	}
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Streaming user events is not supported: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				if subscription.Dropped() {
+					h.logger.WarningWithAPIID(apiID, "User event stream fell behind and was dropped")
+				}
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	if event.Type == events.EventReset {
+		return writeReset(w)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// writeReset has no id, so the client keeps the ID of the last event it saw
+func writeReset(w http.ResponseWriter) error {
+	_, err := fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	return err
+}
+
+// parseLastEventID reads the ID browsers send when reconnecting, falling back to
+// the query for clients resuming a stream they opened earlier
+func parseLastEventID(r *http.Request) (*int64, bool) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &id, true
+}
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+// exportFlushEvery controls how many rows are written between flushes to the client
+const exportFlushEvery = 100
+
+// userExportColumns are the columns an export may contain. They are read from
+// model.UserResponse, which has no password field, so hashes can never leak.
+var userExportColumns = map[string]func(user *model.UserResponse) any{
+	"id":           func(u *model.UserResponse) any { return u.ID },
+	"username":     func(u *model.UserResponse) any { return u.Username },
+	"email":        func(u *model.UserResponse) any { return u.Email },
+	"display_name": func(u *model.UserResponse) any { return u.DisplayName },
+	"bio":          func(u *model.UserResponse) any { return u.Bio },
+	"locale":       func(u *model.UserResponse) any { return u.Locale },
+	"timezone":     func(u *model.UserResponse) any { return u.Timezone },
+	"avatar_url":   func(u *model.UserResponse) any { return u.AvatarURL },
+	"status":       func(u *model.UserResponse) any { return u.Status },
+	"created_at":   func(u *model.UserResponse) any { return u.CreatedAt },
+	"updated_at":   func(u *model.UserResponse) any { return u.UpdatedAt },
+	"deleted_at":   func(u *model.UserResponse) any { return u.DeletedAt },
+}
+
+var defaultUserExportColumns = []string{"id", "username", "email", "display_name", "created_at", "updated_at"}
+
+const (
+	exportFormatCSV    = "text/csv"
+	exportFormatNDJSON = "application/x-ndjson"
+)
+
+// Export streams every user matching the list filters as CSV or NDJSON,
+// chosen by the Accept header or the format query parameter.
+func (h *UserHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	format := negotiateExportFormat(r)
+	if format == "" {
+		WriteErrorResponse(w, http.StatusNotAcceptable, "Export is available as text/csv or application/x-ndjson")
+		return
+	}
+
+	filter, validationErrors := parseUserFilter(r, h.attributes)
+	columns, err := parseExportColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		validationErrors = append(validationErrors, utils.ValidationError{Field: "columns", Error: err.Error()})
+	}
+	if validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for export users request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+	if !h.mayFilterDeleted(w, r, filter) {
+		return
+	}
+
+	extension := "csv"
+	if format == exportFormatNDJSON {
+		extension = "ndjson"
+	}
+	w.Header().Set("Content-Type", format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"users-%s.%s\"", time.Now().UTC().Format("20060102T150405Z"), extension))
+
+	body := &exportBody{w: w}
+	var writer userExportWriter
+	if format == exportFormatCSV {
+		writer = newCSVUserExportWriter(body, columns)
+	} else {
+		writer = &ndjsonUserExportWriter{w: body, columns: columns}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	err = h.userService.Export(ctx, filter, func(user *model.UserResponse) error {
+		if err := writer.write(user); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 && flusher != nil {
+			writer.flush()
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.flush()
+	}
+	if err != nil && !body.written {
+		// Nothing reached the client yet, so it can still be told the export failed
+		h.logger.ErrorWithAPIID(apiID, "Failed to export users: %v", err)
+		w.Header().Del("Content-Disposition")
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err != nil {
+		// Headers are already out, all we can do is cut the stream short
+		h.logger.ErrorWithAPIID(apiID, "Failed to export users after %d rows: %v", rows, err)
+		return
+	}
+
+	h.logger.InfoWithAPIID(apiID, "Exported %d users as %s", rows, format)
+}
+
+func negotiateExportFormat(r *http.Request) string {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return exportFormatCSV
+	case "ndjson", "jsonl":
+		return exportFormatNDJSON
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return exportFormatCSV
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv", "*/*", "text/*":
+			return exportFormatCSV
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			return exportFormatNDJSON
+		}
+	}
+	return ""
+}
+
+func parseExportColumns(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return defaultUserExportColumns, nil
+	}
+
+	var columns []string
+	for _, column := range strings.Split(raw, ",") {
+		column = strings.TrimSpace(column)
+		if _, ok := userExportColumns[column]; !ok {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// exportBody remembers whether any of the export was written to the client,
+// after which an error response can no longer be sent
+type exportBody struct {
+	w       io.Writer
+	written bool
+}
+
+func (b *exportBody) Write(p []byte) (int, error) {
+	b.written = true
+	return b.w.Write(p)
+}
+
+type userExportWriter interface {
+	write(user *model.UserResponse) error
+	flush() error
+}
+
+type csvUserExportWriter struct {
+	writer        *csv.Writer
+	columns       []string
+	headerWritten bool
+}
+
+func newCSVUserExportWriter(w io.Writer, columns []string) *csvUserExportWriter {
+	return &csvUserExportWriter{writer: csv.NewWriter(w), columns: columns}
+}
+
+func (c *csvUserExportWriter) write(user *model.UserResponse) error {
+	if !c.headerWritten {
+		if err := c.writer.Write(c.columns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	record := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		record[i] = csvValue(userExportColumns[column](user))
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvUserExportWriter) flush() error {
+	// An export without rows still gets its header
+	if !c.headerWritten {
+		if err := c.writer.Write(c.columns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return csvText(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvText defuses values a spreadsheet would run as a formula, such as a display
+// name of =HYPERLINK(...), by prefixing them with a quote
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ndjsonUserExportWriter writes one JSON object per line with keys in column order
+type ndjsonUserExportWriter struct {
+	w       io.Writer
+	columns []string
+	buf     bytes.Buffer
+}
+
+func (n *ndjsonUserExportWriter) write(user *model.UserResponse) error {
+	n.buf.Reset()
+	n.buf.WriteByte('{')
+	for i, column := range n.columns {
+		if i > 0 {
+			n.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(userExportColumns[column](user))
+		if err != nil {
+			return err
+		}
+		n.buf.Write(key)
+		n.buf.WriteByte(':')
+		n.buf.Write(value)
+	}
+	n.buf.WriteString("}\n")
+
+	_, err := n.w.Write(n.buf.Bytes())
+	return err
+}
+
+func (n *ndjsonUserExportWriter) flush() error {
+	return nil
+}
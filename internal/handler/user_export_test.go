@@ -0,0 +1,26 @@
+package handler
+
+import "testing"
+
+func TestCSVValueDefusesFormulas(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{value: "john", want: "john"},
+		{value: "=HYPERLINK(\"http://evil\")", want: "'=HYPERLINK(\"http://evil\")"},
+		{value: "+1", want: "'+1"},
+		{value: "-1+2", want: "'-1+2"},
+		{value: "@SUM(A1)", want: "'@SUM(A1)"},
+		{value: "\tcmd", want: "'\tcmd"},
+		{value: "\rcmd", want: "'\rcmd"},
+		{value: "", want: ""},
+		{value: int64(-5), want: "-5"},
+	}
+
+	for _, tt := range tests {
+		if got := csvValue(tt.value); got != tt.want {
+			t.Errorf("csvValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
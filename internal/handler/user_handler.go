@@ -1,13 +1,16 @@
 package handler
 
 import (
+	stdcontext "context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
 	"github.com/Rafli-Dewanto/go-template/internal/context"
 	"github.com/Rafli-Dewanto/go-template/internal/model"
 	"github.com/Rafli-Dewanto/go-template/internal/service"
@@ -17,12 +20,17 @@ import (
 )
 
 type UserHandler struct {
-	userService service.UserService
-	logger      *utils.Logger
+	userService  service.UserService
+	attributes   *utils.JSONSchema
+	accessPolicy *auth.AccessPolicy
+	maxBatchIDs  int
+	logger       *utils.Logger
 }
 
-func NewUserHandler(userService service.UserService, logger *utils.Logger) *UserHandler {
-	return &UserHandler{userService: userService, logger: logger}
+// NewUserHandler creates the handler, attributes is the schema custom user attributes
+// must match and maxBatchIDs caps the IDs of one batch lookup
+func NewUserHandler(userService service.UserService, attributes *utils.JSONSchema, accessPolicy *auth.AccessPolicy, maxBatchIDs int, logger *utils.Logger) *UserHandler {
+	return &UserHandler{userService: userService, attributes: attributes, accessPolicy: accessPolicy, maxBatchIDs: maxBatchIDs, logger: logger}
 }
 
 func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -44,7 +52,7 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+	if validationErrors := validateCreateRequest(req, req.Attributes, h.attributes); validationErrors != nil {
 		h.logger.WarningWithAPIID(apiID, "Validation failed for create user request")
 		writeValidationErrorResponse(w, validationErrors)
 		return
@@ -66,6 +74,12 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 		case service.ErrUserAlreadyExists:
 			h.logger.WarningWithAPIID(apiID, "User with email or username already exists")
 			WriteErrorResponse(w, http.StatusConflict, "User already exists")
+		case service.ErrUsernameReserved:
+			h.logger.WarningWithAPIID(apiID, "Reserved username rejected for user creation")
+			WriteErrorResponse(w, http.StatusConflict, "Username is reserved")
+		case service.ErrUsernameOnHold:
+			h.logger.WarningWithAPIID(apiID, "Recently released username rejected for user creation")
+			WriteErrorResponse(w, http.StatusConflict, "Username was recently released and cannot be claimed yet")
 		default:
 			h.logger.ErrorWithAPIID(apiID, "Failed to create user: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -109,7 +123,87 @@ func (h *UserHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeResponse(w, http.StatusOK, user, "User retrieved successfully", nil)
+	writeConditionalResponse(w, r, user, "User retrieved successfully", nil, versionETag(user.Version), user.UpdatedAt)
+}
+
+// GetByUsername looks a user up by username. A username the user has since
+// changed still resolves for a while, answered with a redirect to the user's
+// canonical URL alongside the user itself.
+func (h *UserHandler) GetByUsername(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	username := chi.URLParam(r, "username")
+	user, historical, err := h.userService.ResolveUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			h.logger.WarningWithAPIID(apiID, "User not found with username: %s", username)
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.logger.ErrorWithAPIID(apiID, "Failed to resolve username: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if historical {
+		h.logger.InfoWithAPIID(apiID, "Former username %s resolved to user %d", username, user.ID)
+		w.Header().Set("Location", "/users/"+strconv.FormatInt(user.ID, 10))
+		writeResponse(w, http.StatusFound, user, "User has changed their username", nil)
+		return
+	}
+
+	writeConditionalResponse(w, r, user, "User retrieved successfully", nil, versionETag(user.Version), user.UpdatedAt)
+}
+
+// GetBatch looks up the users whose IDs are given in ?ids=1,2,3 with a single
+// query. Users are returned in request order and IDs that matched no user are
+// listed in meta.missing rather than failing the request.
+func (h *UserHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	var ids []int64
+	for _, param := range r.URL.Query()["ids"] {
+		for _, part := range strings.Split(param, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil || id <= 0 {
+				writeValidationErrorResponse(w, []utils.ValidationError{{Field: "ids", Error: "Invalid user ID: " + part}})
+				return
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		writeValidationErrorResponse(w, []utils.ValidationError{{Field: "ids", Error: "This field is required"}})
+		return
+	}
+	if len(ids) > h.maxBatchIDs {
+		writeValidationErrorResponse(w, []utils.ValidationError{{Field: "ids", Error: fmt.Sprintf("At most %d IDs are allowed", h.maxBatchIDs)}})
+		return
+	}
+
+	batch, err := h.userService.GetByIDs(ctx, ids)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to get users by IDs: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	meta := &model.BatchMeta{Requested: len(ids), Found: len(batch.Users), Missing: batch.Missing}
+	writeConditionalResponse(w, r, batch.Users, "Users retrieved successfully", meta, "", time.Time{})
+}
+
+// maxListLimit caps the page size of List
+const maxListLimit = 100
+
+// validateListLimit checks a page size given in the query, zero meaning the default
+func validateListLimit(limit int) []utils.ValidationError {
+	if limit < 0 || limit > maxListLimit {
+		return []utils.ValidationError{{Field: "limit", Error: fmt.Sprintf("Must be between 1 and %d", maxListLimit)}}
+	}
+	return nil
 }
 
 func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -132,14 +226,121 @@ func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
 		Offset: utils.Default(offset, 0),
 	}
 
-	response, err := h.userService.List(ctx, query)
+	filter, validationErrors := parseUserFilter(r, h.attributes)
+	if validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for list users request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+	if !h.mayFilterDeleted(w, r, filter) {
+		return
+	}
+
+	if r.URL.Query().Get("cursor") != "" || r.URL.Query().Get("pagination") == "cursor" {
+		h.listByCursor(w, r, limit, filter)
+		return
+	}
+
+	validationErrors = validateListLimit(limit)
+	if offset < 0 {
+		validationErrors = append(validationErrors, utils.ValidationError{Field: "offset", Error: "Must not be negative"})
+	}
+	if validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Invalid paging for list users request: limit %d, offset %d", limit, offset)
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	response, err := h.userService.List(ctx, query, filter)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to list users: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeConditionalResponse(w, r, response.Data, response.Message, response.Meta, "", time.Time{})
+}
+
+// listByCursor serves the keyset paginated mode of List, where pages are addressed
+// by opaque cursors instead of offsets and the total count is opt-in.
+func (h *UserHandler) listByCursor(w http.ResponseWriter, r *http.Request, limit int, filter *model.UserFilter) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	if len(filter.Sort) > 1 {
+		writeValidationErrorResponse(w, []utils.ValidationError{{
+			Field: "sort",
+			Error: "Cursor pagination supports a single sort field",
+		}})
+		return
+	}
+	if validationErrors := validateListLimit(limit); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Invalid page size for list users request: %d", limit)
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	sort := model.SortField{Field: "created_at", Desc: true}
+	if len(filter.Sort) == 1 {
+		sort = filter.Sort[0]
+	}
+	withTotal, _ := utils.StringToBool(r.URL.Query().Get("with_total"))
+
+	query := &model.CursorQuery{
+		Cursor:    r.URL.Query().Get("cursor"),
+		Limit:     utils.Default(limit, 10),
+		Sort:      sort,
+		WithTotal: withTotal,
+	}
+
+	response, err := h.userService.ListByCursor(ctx, query, filter)
 	if err != nil {
+		if errors.Is(err, model.ErrInvalidCursor) {
+			h.logger.WarningWithAPIID(apiID, "Invalid cursor for list users request")
+			writeValidationErrorResponse(w, []utils.ValidationError{{
+				Field: "cursor",
+				Error: "Invalid cursor, it must come from a previous response with the same sort",
+			}})
+			return
+		}
 		h.logger.ErrorWithAPIID(apiID, "Failed to list users: %v", err)
 		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	writeResponse(w, http.StatusOK, response.Data, response.Message, response.Meta)
+	writeConditionalResponse(w, r, response.Data, response.Message, response.Meta, "", time.Time{})
+}
+
+func (h *UserHandler) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	query := &model.UserSearchQuery{
+		Query: strings.TrimSpace(r.URL.Query().Get("q")),
+		Limit: utils.Default(limit, 20),
+	}
+
+	if validationErrors := utils.ValidateStruct(query); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for search users request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	results, err := h.userService.Search(cancelCtx, query)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			WriteErrorResponse(w, http.StatusBadRequest, "Invalid input")
+			return
+		}
+		h.logger.ErrorWithAPIID(apiID, "Failed to search users: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeConditionalResponse(w, r, results, "Users retrieved successfully", nil, "", time.Time{})
 }
 
 func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
@@ -151,16 +352,21 @@ func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/users/")
-	if idStr == "" || strings.Contains(idStr, "/") {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	_, id, ok := authorizeUserAccess(w, r, h.accessPolicy)
+	if !ok {
 		return
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		h.logger.ErrorWithAPIID(apiID, "Failed to parse user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		h.logger.WarningWithAPIID(apiID, "Update of user %d without If-Match", id)
+		WriteErrorResponse(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return
+	}
+	version, ok := parseIfMatch(ifMatch)
+	if !ok {
+		h.logger.WarningWithAPIID(apiID, "Unrecognized If-Match for user %d: %s", id, ifMatch)
+		WriteErrorResponse(w, http.StatusPreconditionFailed, "User has been modified, fetch it again and retry")
 		return
 	}
 
@@ -171,14 +377,15 @@ func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.ID = id
+	req.Version = version
 
-	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+	if validationErrors := validateRequest(req, req.Attributes, h.attributes); validationErrors != nil {
 		h.logger.WarningWithAPIID(apiID, "Validation failed for update user request")
 		writeValidationErrorResponse(w, validationErrors)
 		return
 	}
 
-	err = h.userService.Update(ctx, req)
+	user, err := h.userService.Update(ctx, req)
 	if err != nil {
 		switch err {
 		case service.ErrInvalidInput:
@@ -190,33 +397,45 @@ func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 		case service.ErrUsernameAlreadyTaken:
 			h.logger.WarningWithAPIID(apiID, "Username is already taken for update with ID: %d", req.ID)
 			WriteErrorResponse(w, http.StatusConflict, "Username is already taken")
+		case service.ErrUsernameReserved:
+			WriteErrorResponse(w, http.StatusConflict, "Username is reserved")
+		case service.ErrUsernameOnHold:
+			WriteErrorResponse(w, http.StatusConflict, "Username was recently released and cannot be claimed yet")
+		case service.ErrEmailChangeRequiresConfirmation:
+			WriteErrorResponse(w, http.StatusConflict, "Email changes must be requested through POST /users/{id}/email and confirmed")
+		case service.ErrVersionMismatch:
+			h.logger.WarningWithAPIID(apiID, "Stale update rejected for user with ID: %d", req.ID)
+			WriteErrorResponse(w, http.StatusPreconditionFailed, "User has been modified, fetch it again and retry")
 		default:
 			h.logger.ErrorWithAPIID(apiID, "Failed to update user: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
-	writeResponse(w, http.StatusOK, nil, "User updated successfully", nil)
+
+	w.Header().Set("ETag", versionETag(user.Version))
+	writeResponse(w, http.StatusOK, user, "User updated successfully", nil)
 }
 
 func (h *UserHandler) SoftDelete(w http.ResponseWriter, r *http.Request) {
 	ctx := context.WithRequestID(r.Context(), uuid.New().String())
 	apiID := context.GetAPIID(ctx)
 	h.logger.InfoWithAPIID(apiID, "Handling delete user request")
-	if r.Method != http.MethodPatch {
+	if r.Method != http.MethodDelete {
 		h.logger.WarningWithAPIID(apiID, "Method not allowed: %s", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/users/")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		h.logger.ErrorWithAPIID(apiID, "Failed to parse user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	_, id, ok := authorizeUserAccess(w, r, h.accessPolicy)
+	if !ok {
 		return
 	}
 
+	h.softDelete(ctx, w, apiID, id)
+}
+
+func (h *UserHandler) softDelete(ctx stdcontext.Context, w http.ResponseWriter, apiID string, id int64) {
 	if err := h.userService.SoftDelete(ctx, id); err != nil {
 		switch err {
 		case service.ErrUserNotFound:
@@ -230,3 +449,84 @@ func (h *UserHandler) SoftDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// mayFilterDeleted refuses to list soft-deleted users to anyone but administrators
+func (h *UserHandler) mayFilterDeleted(w http.ResponseWriter, r *http.Request, filter *model.UserFilter) bool {
+	if filter.Deleted == model.DeletedExclude {
+		return true
+	}
+	claims, _ := auth.GetUserClaims(r.Context())
+	if !h.accessPolicy.IsAdmin(claims) {
+		WriteErrorResponse(w, http.StatusForbidden, "Only administrators may list deleted users")
+		return false
+	}
+	return true
+}
+
+// parseUserFilter reads the filter and sort query parameters of the user list
+func parseUserFilter(r *http.Request, attributes *utils.JSONSchema) (*model.UserFilter, []utils.ValidationError) {
+	params := r.URL.Query()
+	var validationErrors []utils.ValidationError
+
+	filter := &model.UserFilter{
+		Username: strings.TrimSpace(params.Get("username")),
+		Email:    strings.TrimSpace(params.Get("email")),
+		Deleted:  utils.Default(params.Get("deleted"), model.DeletedExclude),
+	}
+
+	if filter.Deleted != model.DeletedExclude && filter.Deleted != model.DeletedInclude && filter.Deleted != model.DeletedOnly {
+		validationErrors = append(validationErrors, utils.ValidationError{
+			Field: "deleted",
+			Error: "Must be one of exclude, include, only",
+		})
+	}
+
+	if value := params.Get("created_from"); value != "" {
+		if t, err := parseTimeParam(value, false); err == nil {
+			filter.CreatedFrom = &t
+		} else {
+			validationErrors = append(validationErrors, invalidDateError("created_from"))
+		}
+	}
+
+	if value := params.Get("created_to"); value != "" {
+		if t, err := parseTimeParam(value, true); err == nil {
+			filter.CreatedTo = &t
+		} else {
+			validationErrors = append(validationErrors, invalidDateError("created_to"))
+		}
+	}
+
+	attributeFilter, attributeErrors := parseAttributeFilter(params, attributes)
+	filter.Attributes = attributeFilter
+	validationErrors = append(validationErrors, attributeErrors...)
+
+	sort, err := model.ParseSort(params.Get("sort"), model.UserSortFields)
+	if err != nil {
+		validationErrors = append(validationErrors, utils.ValidationError{Field: "sort", Error: err.Error()})
+	}
+	filter.Sort = sort
+
+	return filter, validationErrors
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain dates, a plain date is
+// expanded to the end of that day when endOfDay is set so ranges are inclusive.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := utils.ParseDate(value, utils.DateFormatYYYYMMDD)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		return utils.GetEndOfDay(t), nil
+	}
+	return t, nil
+}
+
+func invalidDateError(field string) utils.ValidationError {
+	return utils.ValidationError{Field: field, Error: "Invalid date, expected RFC 3339 or YYYY-MM-DD"}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+// importContentTypes maps request media types to import formats
+var importContentTypes = map[string]string{
+	"text/csv":             model.ImportFormatCSV,
+	"application/x-ndjson": model.ImportFormatJSONL,
+	"application/jsonl":    model.ImportFormatJSONL,
+	"application/ndjson":   model.ImportFormatJSONL,
+}
+
+type UserImportHandler struct {
+	importService service.UserImportService
+	logger        *utils.Logger
+}
+
+func NewUserImportHandler(importService service.UserImportService, logger *utils.Logger) *UserImportHandler {
+	return &UserImportHandler{importService: importService, logger: logger}
+}
+
+// Import streams a CSV or JSON Lines body of users into the database. The format
+// comes from the format query parameter or the Content-Type header.
+func (h *UserImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format = importContentTypes[mediaType]
+	}
+
+	dryRun, _ := strconv.ParseBool(params.Get("dry_run"))
+	batchSize, _ := strconv.Atoi(params.Get("batch_size"))
+
+	report, err := h.importService.Import(ctx, r.Body, model.ImportOptions{
+		Format:    format,
+		Mode:      params.Get("mode"),
+		DryRun:    dryRun,
+		BatchSize: batchSize,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedImportFormat):
+			WriteErrorResponse(w, http.StatusUnsupportedMediaType, "Import must be text/csv or application/x-ndjson")
+		case errors.Is(err, service.ErrInvalidImportMode):
+			WriteErrorResponse(w, http.StatusBadRequest, "Mode must be atomic or best_effort")
+		case errors.Is(err, service.ErrInvalidImportHeader):
+			WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			h.logger.ErrorWithAPIID(apiID, "Failed to import users: %v", err)
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	switch {
+	case report.DryRun:
+		writeResponse(w, http.StatusOK, report, "Dry run completed", nil)
+	case !report.Committed:
+		h.logger.WarningWithAPIID(apiID, "Atomic user import rolled back, %d rows failed", report.Failed)
+		writeResponse(w, http.StatusUnprocessableEntity, report, "Import rolled back", nil)
+	default:
+		writeResponse(w, http.StatusOK, report, "Import completed", nil)
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+// newListTestHandler has no user service, the requests tested never reach it
+func newListTestHandler(t *testing.T) *UserHandler {
+	t.Helper()
+	attributes, err := utils.LoadJSONSchema("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUserHandler(nil, attributes, auth.NewAccessPolicy(nil), 100, newTestLogger(t))
+}
+
+func TestListRejectsOutOfRangePaging(t *testing.T) {
+	h := newListTestHandler(t)
+
+	for _, target := range []string{
+		"/users?limit=-1",
+		"/users?limit=101",
+		"/users?limit=100000000",
+		"/users?offset=-5",
+		"/users?pagination=cursor&limit=-1",
+		"/users?pagination=cursor&limit=101",
+		"/users?cursor=abc&limit=100000000",
+	} {
+		rec := httptest.NewRecorder()
+		h.List(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, rec.Code)
+		}
+	}
+}
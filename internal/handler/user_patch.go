@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// maxPatchBytes bounds the patch document, a user representation is tiny
+const maxPatchBytes = 64 << 10
+
+// legacyPatchDeleteSunset is when a bodiless PATCH stops soft deleting the user
+const legacyPatchDeleteSunset = "Sun, 31 Jan 2027 00:00:00 GMT"
+
+// Patch applies a JSON Merge Patch or JSON Patch to a user. The patch runs
+// against the user's current representation and the result is validated as a
+// whole, so a patch can never leave a user in a state PUT would reject.
+func (h *UserHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	_, id, ok := authorizeUserAccess(w, r, h.accessPolicy)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBytes))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Patch document is too large")
+		return
+	}
+
+	// PATCH used to soft delete, keep honoring bodiless requests until the sunset
+	if len(bytes.TrimSpace(patch)) == 0 && r.Header.Get("Content-Type") == "" {
+		h.logger.WarningWithAPIID(apiID, "Deprecated PATCH soft delete used for user with ID: %d", id)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", legacyPatchDeleteSunset)
+		w.Header().Set("Link", `<`+r.URL.Path+`>; rel="successor-version"; title="DELETE"`)
+		h.softDelete(ctx, w, apiID, id)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		w.Header().Set("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+		WriteErrorResponse(w, http.StatusUnsupportedMediaType, "Patch must be application/merge-patch+json or application/json-patch+json")
+		return
+	}
+
+	// Like PUT, a patch must say which version it was made against
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		h.logger.WarningWithAPIID(apiID, "Patch of user %d without If-Match", id)
+		WriteErrorResponse(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return
+	}
+	version, ok := parseIfMatch(ifMatch)
+	if !ok {
+		h.logger.WarningWithAPIID(apiID, "Unrecognized If-Match for user %d: %s", id, ifMatch)
+		WriteErrorResponse(w, http.StatusPreconditionFailed, "User has been modified, fetch it again and retry")
+		return
+	}
+
+	current, err := h.userService.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			h.logger.WarningWithAPIID(apiID, "User not found for patch with ID: %d", id)
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.logger.ErrorWithAPIID(apiID, "Failed to get user: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if version != 0 && version != current.Version {
+		h.logger.WarningWithAPIID(apiID, "Stale patch rejected for user with ID: %d", id)
+		WriteErrorResponse(w, http.StatusPreconditionFailed, "User has been modified, fetch it again and retry")
+		return
+	}
+
+	original := converter.ToUserPatchDocument(current)
+	doc, err := json.Marshal(original)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to encode user for patch: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if contentType == mergePatchContentType {
+		doc, err = utils.MergePatch(doc, patch)
+	} else {
+		doc, err = utils.ApplyJSONPatch(doc, patch)
+	}
+	if err != nil {
+		h.logger.WarningWithAPIID(apiID, "Failed to apply patch to user %d: %v", id, err)
+		switch {
+		case errors.Is(err, utils.ErrPatchTestFailed):
+			WriteErrorResponse(w, http.StatusConflict, err.Error())
+		case errors.Is(err, utils.ErrInvalidPatch):
+			WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	var patched model.UserPatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		h.logger.WarningWithAPIID(apiID, "Patched user %d is not a valid document: %v", id, err)
+		WriteErrorResponse(w, http.StatusUnprocessableEntity, "Patched user is not a valid user document")
+		return
+	}
+
+	if validationErrors := validateRequest(patched, patched.Attributes, h.attributes); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for patched user %d", id)
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	user, err := h.userService.Update(ctx, converter.ToUpdateUserRequest(id, current.Version, original, &patched))
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+		case service.ErrUsernameAlreadyTaken:
+			WriteErrorResponse(w, http.StatusConflict, "Username is already taken")
+		case service.ErrUsernameReserved:
+			WriteErrorResponse(w, http.StatusConflict, "Username is reserved")
+		case service.ErrUsernameOnHold:
+			WriteErrorResponse(w, http.StatusConflict, "Username was recently released and cannot be claimed yet")
+		case service.ErrEmailChangeRequiresConfirmation:
+			WriteErrorResponse(w, http.StatusConflict, "Email changes must be requested through POST /users/{id}/email and confirmed")
+		case service.ErrVersionMismatch:
+			WriteErrorResponse(w, http.StatusPreconditionFailed, "User has been modified, fetch it again and retry")
+		default:
+			h.logger.ErrorWithAPIID(apiID, "Failed to patch user: %v", err)
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(user.Version))
+	writeResponse(w, http.StatusOK, user, "User updated successfully", nil)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	errorCodeAccountSuspended = "account_suspended"
+	errorCodeAccountBanned    = "account_banned"
+	errorCodeAccountPending   = "account_pending"
+)
+
+type UserStatusHandler struct {
+	statusService service.UserStatusService
+	userService   service.UserService
+	logger        *utils.Logger
+}
+
+func NewUserStatusHandler(statusService service.UserStatusService, userService service.UserService, logger *utils.Logger) *UserStatusHandler {
+	return &UserStatusHandler{statusService: statusService, userService: userService, logger: logger}
+}
+
+// Transition changes a user's status. Only moves allowed by the lifecycle succeed,
+// the caller is recorded as the actor.
+func (h *UserStatusHandler) Transition(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, err := utils.StringToInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req model.UserStatusTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to decode request body: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for status transition request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	var actorID *int64
+	if claims, ok := auth.GetUserClaims(ctx); ok {
+		actorID = &claims.UserID
+	}
+
+	transition, err := h.statusService.Transition(ctx, id, actorID, &req)
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			WriteErrorResponse(w, http.StatusNotFound, "User not found")
+		case service.ErrInvalidStatusTransition:
+			h.invalidTransition(ctx, w, id, req.Status)
+		case service.ErrStatusConflict:
+			WriteErrorResponse(w, http.StatusConflict, "User status changed meanwhile, fetch the user again and retry")
+		default:
+			h.logger.ErrorWithAPIID(apiID, "Failed to change user status: %v", err)
+			WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	h.logger.InfoWithAPIID(apiID, "User %d moved from %s to %s", id, transition.FromStatus, transition.ToStatus)
+	writeResponse(w, http.StatusCreated, transition, "User status changed successfully", nil)
+}
+
+// invalidTransition explains which statuses the user may move to instead
+func (h *UserStatusHandler) invalidTransition(ctx stdcontext.Context, w http.ResponseWriter, id int64, status string) {
+	user, err := h.userService.GetByID(ctx, id)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusConflict, "Status transition is not allowed")
+		return
+	}
+
+	allowed := entity.NextUserStatuses(user.Status)
+	WriteErrorResponse(w, http.StatusConflict, "A "+user.Status+" user cannot become "+status+
+		", allowed: "+strings.Join(allowed, ", "))
+}
+
+func (h *UserStatusHandler) ListTransitions(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, err := utils.StringToInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if _, err := h.userService.GetByID(ctx, id); errors.Is(err, service.ErrUserNotFound) {
+		WriteErrorResponse(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	transitions, err := h.statusService.ListTransitions(ctx, id)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to list status transitions: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeResponse(w, http.StatusOK, transitions, "Status transitions retrieved successfully", nil)
+}
+
+// WriteAccountStatusError answers a request refused because of the account's
+// status, with a code clients can act on. It returns false for other errors.
+func WriteAccountStatusError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrAccountSuspended):
+		writeErrorCodeResponse(w, http.StatusForbidden, errorCodeAccountSuspended, "Account is suspended")
+	case errors.Is(err, service.ErrAccountBanned):
+		writeErrorCodeResponse(w, http.StatusForbidden, errorCodeAccountBanned, "Account is banned")
+	case errors.Is(err, service.ErrAccountPending):
+		writeErrorCodeResponse(w, http.StatusForbidden, errorCodeAccountPending, "Account is awaiting activation")
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxWebhookDeliveryLimit = 100
+
+type WebhookHandler struct {
+	webhookService service.WebhookService
+	logger         *utils.Logger
+}
+
+func NewWebhookHandler(webhookService service.WebhookService, logger *utils.Logger) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService, logger: logger}
+}
+
+// Create registers an endpoint. The response carries the signing secret, it is
+// not shown again.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	var req model.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to decode request body: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for create webhook request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	var actorID *int64
+	if claims, ok := auth.GetUserClaims(ctx); ok {
+		actorID = &claims.UserID
+	}
+
+	webhook, err := h.webhookService.Create(ctx, &req, actorID)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to create webhook: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeResponse(w, http.StatusCreated, webhook, "Webhook created successfully", nil)
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	webhooks, err := h.webhookService.List(ctx)
+	if err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to list webhooks: %v", err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeResponse(w, http.StatusOK, webhooks, "Webhooks retrieved successfully", nil)
+}
+
+func (h *WebhookHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.GetByID(ctx, id)
+	if err != nil {
+		h.writeError(w, apiID, "Failed to get webhook", err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, webhook, "Webhook retrieved successfully", nil)
+}
+
+// Update changes an endpoint, setting active to true re-enables one that was
+// disabled for failing
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorWithAPIID(apiID, "Failed to decode request body: %v", err)
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		h.logger.WarningWithAPIID(apiID, "Validation failed for update webhook request")
+		writeValidationErrorResponse(w, validationErrors)
+		return
+	}
+
+	webhook, err := h.webhookService.Update(ctx, id, &req)
+	if err != nil {
+		h.writeError(w, apiID, "Failed to update webhook", err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, webhook, "Webhook updated successfully", nil)
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(ctx, id); err != nil {
+		h.writeError(w, apiID, "Failed to delete webhook", err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, nil, "Webhook deleted successfully", nil)
+}
+
+// ListDeliveries is the delivery log of an endpoint, newest first, optionally
+// filtered by status
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", entity.WebhookDeliveryPending, entity.WebhookDeliverySucceeded, entity.WebhookDeliveryFailed:
+	default:
+		writeValidationErrorResponse(w, []utils.ValidationError{{Field: "status", Error: "Must be one of: pending, succeeded, failed"}})
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	query := &model.PaginationQuery{
+		Page:  max(page, 1),
+		Limit: min(utils.Default(limit, 20), maxWebhookDeliveryLimit),
+	}
+	query.Offset = (query.Page - 1) * query.Limit
+
+	response, err := h.webhookService.ListDeliveries(ctx, id, status, query)
+	if err != nil {
+		h.writeError(w, apiID, "Failed to list webhook deliveries", err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, response.Data, response.Message, response.Meta)
+}
+
+// Redeliver sends a succeeded, failed or due delivery again
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithRequestID(r.Context(), uuid.New().String())
+	apiID := context.GetAPIID(ctx)
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := utils.StringToInt64(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(ctx, id, deliveryID)
+	if err != nil {
+		h.writeError(w, apiID, "Failed to redeliver webhook", err)
+		return
+	}
+
+	writeResponse(w, http.StatusAccepted, delivery, "Webhook delivery queued", nil)
+}
+
+func (h *WebhookHandler) writeError(w http.ResponseWriter, apiID string, message string, err error) {
+	switch err {
+	case service.ErrWebhookNotFound:
+		WriteErrorResponse(w, http.StatusNotFound, "Webhook not found")
+	case service.ErrWebhookDeliveryNotFound:
+		WriteErrorResponse(w, http.StatusNotFound, "Webhook delivery not found")
+	case service.ErrWebhookInactive:
+		WriteErrorResponse(w, http.StatusConflict, "Webhook is not active, activate it first")
+	case service.ErrWebhookDeliveryInFlight:
+		WriteErrorResponse(w, http.StatusConflict, "Webhook delivery is already scheduled")
+	default:
+		h.logger.ErrorWithAPIID(apiID, "%s: %v", message, err)
+		WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := utils.StringToInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them, for development
+type LogMailer struct {
+	from   string
+	logger *utils.Logger
+}
+
+func NewLogMailer(from string, logger *utils.Logger) *LogMailer {
+	return &LogMailer{from: from, logger: logger}
+}
+
+func (m *LogMailer) Send(_ context.Context, message Message) error {
+	m.logger.Info("Mail from %s to %s: %s\n%s", m.from, message.To, message.Subject, message.Body)
+	return nil
+}
@@ -1,37 +1,27 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/Rafli-Dewanto/go-template/internal/auth"
 	"github.com/Rafli-Dewanto/go-template/internal/handler"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
 )
 
-func AuthMiddleware(tokenManager *auth.TokenManager) Middleware {
+// AuthMiddleware authenticates the bearer token and refuses users whose account
+// status no longer allows access, even with a token issued before the change
+func AuthMiddleware(tokenManager *auth.TokenManager, statusService service.UserStatusService) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
+			if r.Header.Get("Authorization") == "" {
 				handler.WriteErrorResponse(w, http.StatusUnauthorized, "Missing authorization header")
 				return
 			}
 
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				handler.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid authorization header format")
-				return
-			}
-
-			tokenString := parts[1]
-			claims, err := tokenManager.ValidateToken(tokenString)
-			if err != nil {
-				switch err {
-				case auth.ErrExpiredToken:
-					handler.WriteErrorResponse(w, http.StatusUnauthorized, "Token has expired")
-				default:
-					handler.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token")
-				}
+			claims, ok := authenticate(w, r, tokenManager, statusService)
+			if !ok {
 				return
 			}
 
@@ -44,3 +34,74 @@ func AuthMiddleware(tokenManager *auth.TokenManager) Middleware {
 		})
 	}
 }
+
+// OptionalAuth lets anonymous requests through but authenticates a bearer token
+// when one is sent, for public routes that offer more to signed in callers. A
+// token that does not authenticate is refused rather than ignored.
+func OptionalAuth(tokenManager *auth.TokenManager, statusService service.UserStatusService) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, ok := authenticate(w, r, tokenManager, statusService)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithUserClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// authenticate validates the bearer token of r, writing the error response when
+// it does not authenticate
+func authenticate(w http.ResponseWriter, r *http.Request, tokenManager *auth.TokenManager, statusService service.UserStatusService) (*auth.Claims, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		handler.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid authorization header format")
+		return nil, false
+	}
+
+	tokenString := parts[1]
+	claims, err := tokenManager.ValidateToken(tokenString)
+	if err != nil {
+		switch err {
+		case auth.ErrExpiredToken:
+			handler.WriteErrorResponse(w, http.StatusUnauthorized, "Token has expired")
+		default:
+			handler.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+		}
+		return nil, false
+	}
+
+	if err := statusService.CheckCanAuthenticate(r.Context(), claims.UserID); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			handler.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+		} else if !handler.WriteAccountStatusError(w, err) {
+			// The user could not be looked up, the token may well be valid
+			handler.WriteErrorResponse(w, http.StatusServiceUnavailable, "Service unavailable")
+		}
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// RequireAdmin rejects requests whose caller is not an administrator.
+// It must run after AuthMiddleware.
+func RequireAdmin(policy *auth.AccessPolicy) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := auth.GetUserClaims(r.Context())
+			if !policy.IsAdmin(claims) {
+				handler.WriteErrorResponse(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
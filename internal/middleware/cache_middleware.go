@@ -0,0 +1,43 @@
+package middleware
+
+import "net/http"
+
+// CacheControl sets the Cache-Control header on successful and 304 responses.
+// Errors are left alone so a cached 404 does not outlive the resource's creation.
+func CacheControl(value string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if value == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+		})
+	}
+}
+
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (c *cacheControlWriter) WriteHeader(statusCode int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		if statusCode == http.StatusOK || statusCode == http.StatusNotModified {
+			c.Header().Set("Cache-Control", c.value)
+		}
+	}
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *cacheControlWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
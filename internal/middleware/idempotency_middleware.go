@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/handler"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes bounds the request bodies fingerprinted and kept in memory
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+// replayedHeaders are the response headers stored with a response and replayed with it
+var replayedHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// Idempotency makes a POST safe to retry when the client sends an Idempotency-Key
+// header. The first request with a key runs and its response is stored, retries
+// with the same key and body get that response replayed, while reusing a key
+// for a different body is rejected with 422. Server errors are not stored so
+// they can be retried. Requests without the header pass through untouched.
+func Idempotency(idempotencyService service.IdempotencyService, logger *utils.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				handler.WriteErrorResponse(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				handler.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scope := idempotencyScope(r)
+			fingerprint := utils.HashSHA256(r.Header.Get("Content-Type") + "\n" + string(body))
+
+			stored, err := idempotencyService.Begin(r.Context(), scope, key, fingerprint)
+			switch {
+			case errors.Is(err, service.ErrIdempotencyKeyReused):
+				handler.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				return
+			case errors.Is(err, service.ErrIdempotencyKeyInProgress):
+				w.Header().Set("Retry-After", "1")
+				handler.WriteErrorResponse(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				return
+			case err != nil:
+				logger.Error("Idempotency key %s could not be claimed: %v", key, err)
+				handler.WriteErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+				return
+			case stored != nil:
+				replayResponse(w, stored)
+				return
+			}
+
+			// The outcome is recorded even if the client has gone away, a retry is likely
+			storeCtx := context.WithoutCancel(r.Context())
+			recorder := &idempotencyRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			defer func() {
+				if p := recover(); p != nil {
+					idempotencyService.Release(storeCtx, scope, key, fingerprint)
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.statusCode >= http.StatusInternalServerError {
+				if err := idempotencyService.Release(storeCtx, scope, key, fingerprint); err != nil {
+					logger.Error("Idempotency key %s could not be released: %v", key, err)
+				}
+				return
+			}
+
+			header := map[string][]string{}
+			for _, name := range replayedHeaders {
+				if values := recorder.Header().Values(name); len(values) > 0 {
+					header[name] = values
+				}
+			}
+			err = idempotencyService.Complete(storeCtx, scope, key, fingerprint, &model.IdempotentResponse{
+				StatusCode: recorder.statusCode,
+				Header:     header,
+				Body:       recorder.body.Bytes(),
+			})
+			if err != nil {
+				logger.Error("Idempotency key %s response could not be stored: %v", key, err)
+			}
+		})
+	}
+}
+
+// idempotencyScope keeps keys of different endpoints and callers apart, two
+// clients picking the same key must never see each other's responses
+func idempotencyScope(r *http.Request) string {
+	scope := r.Method + " " + r.URL.Path
+	if claims, ok := auth.GetUserClaims(r.Context()); ok {
+		scope += " user:" + strconv.FormatInt(claims.UserID, 10)
+	}
+	return scope
+}
+
+func replayResponse(w http.ResponseWriter, stored *model.IdempotentResponse) {
+	for name, values := range stored.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// idempotencyRecorder passes the response through while keeping a copy to store
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (i *idempotencyRecorder) WriteHeader(statusCode int) {
+	if !i.wroteHeader {
+		i.wroteHeader = true
+		i.statusCode = statusCode
+	}
+	i.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (i *idempotencyRecorder) Write(b []byte) (int, error) {
+	if !i.wroteHeader {
+		i.WriteHeader(http.StatusOK)
+	}
+	i.body.Write(b)
+	return i.ResponseWriter.Write(b)
+}
+
+func (i *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return i.ResponseWriter
+}
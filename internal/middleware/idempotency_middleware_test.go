@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+type idempotencyEntry struct {
+	fingerprint string
+	response    *model.IdempotentResponse
+}
+
+// fakeIdempotencyService keeps keys in memory with the semantics of the real
+// service, except that a key in progress is refused instead of waited for
+type fakeIdempotencyService struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+func newFakeIdempotencyService() *fakeIdempotencyService {
+	return &fakeIdempotencyService{entries: map[string]*idempotencyEntry{}}
+}
+
+func (s *fakeIdempotencyService) Begin(_ context.Context, scope string, key string, fingerprint string) (*model.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[scope+"\n"+key]
+	switch {
+	case !ok:
+		s.entries[scope+"\n"+key] = &idempotencyEntry{fingerprint: fingerprint}
+		return nil, nil
+	case entry.fingerprint != fingerprint:
+		return nil, service.ErrIdempotencyKeyReused
+	case entry.response == nil:
+		return nil, service.ErrIdempotencyKeyInProgress
+	default:
+		return entry.response, nil
+	}
+}
+
+func (s *fakeIdempotencyService) Complete(_ context.Context, scope string, key string, _ string, response *model.IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[scope+"\n"+key].response = response
+	return nil
+}
+
+func (s *fakeIdempotencyService) Release(_ context.Context, scope string, key string, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, scope+"\n"+key)
+	return nil
+}
+
+func (s *fakeIdempotencyService) RunPurge(context.Context, time.Duration) {}
+
+func newTestLogger(t *testing.T) *utils.Logger {
+	t.Helper()
+	logger, err := utils.NewLogger(filepath.Join(t.TempDir(), "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(logger.Close)
+	return logger
+}
+
+// countingHandler creates a user named after the request body and counts its calls
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/users/1")
+	w.WriteHeader(h.status)
+	w.Write([]byte(`{"created":` + string(body) + `,"call":` + strconv.Itoa(h.calls) + `}`))
+}
+
+func postWithKey(h http.Handler, key string, body string, claims *auth.Claims) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Idempotency-Key", key)
+	if claims != nil {
+		r = r.WithContext(auth.WithUserClaims(r.Context(), claims))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestIdempotencyReplaysTheStoredResponse(t *testing.T) {
+	next := &countingHandler{status: http.StatusCreated}
+	h := Idempotency(newFakeIdempotencyService(), newTestLogger(t))(next)
+
+	first := postWithKey(h, "key-1", `"alice"`, nil)
+	retry := postWithKey(h, "key-1", `"alice"`, nil)
+
+	if next.calls != 1 {
+		t.Fatalf("handler ran %d times, want once", next.calls)
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("first response is marked replayed")
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry is not marked replayed, headers %v", retry.Header())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get("Location") != "/users/1" {
+		t.Errorf("replayed %d %s %v, want %d %s", retry.Code, retry.Body, retry.Header(), first.Code, first.Body)
+	}
+}
+
+func TestIdempotencyRejectsAKeyReusedForAnotherBody(t *testing.T) {
+	next := &countingHandler{status: http.StatusCreated}
+	h := Idempotency(newFakeIdempotencyService(), newTestLogger(t))(next)
+
+	postWithKey(h, "key-1", `"alice"`, nil)
+	rec := postWithKey(h, "key-1", `"bob"`, nil)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	if next.calls != 1 {
+		t.Errorf("handler ran %d times, want once", next.calls)
+	}
+}
+
+func TestIdempotencyRefusesAKeyInProgress(t *testing.T) {
+	idempotency := newFakeIdempotencyService()
+	h := Idempotency(idempotency, newTestLogger(t))(&countingHandler{status: http.StatusCreated})
+
+	// Claimed by a request still running
+	body := `"alice"`
+	idempotency.Begin(context.Background(), "POST /users", "key-1", utils.HashSHA256("application/json\n"+body))
+
+	rec := postWithKey(h, "key-1", body, nil)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, headers %v, want a 409 with Retry-After", rec.Code, rec.Header())
+	}
+}
+
+func TestIdempotencyDoesNotStoreServerErrors(t *testing.T) {
+	next := &countingHandler{status: http.StatusInternalServerError}
+	h := Idempotency(newFakeIdempotencyService(), newTestLogger(t))(next)
+
+	postWithKey(h, "key-1", `"alice"`, nil)
+	next.status = http.StatusCreated
+	retry := postWithKey(h, "key-1", `"alice"`, nil)
+
+	if next.calls != 2 {
+		t.Fatalf("handler ran %d times, want the retry to run again", next.calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry got %d, replayed %q, want a fresh 201", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotencyReleasesTheKeyOnPanic(t *testing.T) {
+	idempotency := newFakeIdempotencyService()
+	panicking := Idempotency(idempotency, newTestLogger(t))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("handler failed")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("the panic was swallowed")
+			}
+		}()
+		postWithKey(panicking, "key-1", `"alice"`, nil)
+	}()
+
+	next := &countingHandler{status: http.StatusCreated}
+	rec := postWithKey(Idempotency(idempotency, newTestLogger(t))(next), "key-1", `"alice"`, nil)
+	if rec.Code != http.StatusCreated || next.calls != 1 {
+		t.Errorf("retry after a panic got %d with %d handler calls, want the key free again", rec.Code, next.calls)
+	}
+}
+
+func TestIdempotencyKeysAreScopedPerCaller(t *testing.T) {
+	next := &countingHandler{status: http.StatusCreated}
+	h := Idempotency(newFakeIdempotencyService(), newTestLogger(t))(next)
+
+	alice := postWithKey(h, "shared-key", `"alice"`, &auth.Claims{UserID: 1})
+	bob := postWithKey(h, "shared-key", `"alice"`, &auth.Claims{UserID: 2})
+
+	if next.calls != 2 {
+		t.Fatalf("handler ran %d times, want once per caller", next.calls)
+	}
+	if bob.Header().Get("Idempotent-Replayed") != "" || bob.Body.String() == alice.Body.String() {
+		t.Errorf("second caller was replayed the first caller's response: %s", bob.Body)
+	}
+}
+
+func TestIdempotencyPassesRequestsWithoutAKeyThrough(t *testing.T) {
+	next := &countingHandler{status: http.StatusCreated}
+	h := Idempotency(newFakeIdempotencyService(), newTestLogger(t))(next)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`"alice"`)))
+	}
+	if next.calls != 2 {
+		t.Errorf("handler ran %d times, want every request to run", next.calls)
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// FieldChange is the before and after value of one audited field
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+type AuditLogFilter struct {
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   *int64
+	From       *time.Time
+	To         *time.Time
+}
+
+type AuditLogResponse struct {
+	ID         int64                  `json:"id"`
+	ActorID    *int64                 `json:"actor_id"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   *int64                 `json:"target_id"`
+	APIID      string                 `json:"api_id"`
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
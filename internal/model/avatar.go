@@ -0,0 +1,6 @@
+package model
+
+type AvatarResponse struct {
+	URL        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails"`
+}
@@ -0,0 +1,34 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+// ToAuditLogResponses decodes the recorded changes of each entry. Redacted values
+// were never stored, so the responses carry them as recorded.
+func ToAuditLogResponses(entries []*entity.AuditLog) ([]*model.AuditLogResponse, error) {
+	responses := make([]*model.AuditLogResponse, len(entries))
+	for i, entry := range entries {
+		changes := map[string]model.FieldChange{}
+		if len(entry.Changes) > 0 {
+			if err := json.Unmarshal(entry.Changes, &changes); err != nil {
+				return nil, fmt.Errorf("audit entry %d has malformed changes: %w", entry.ID, err)
+			}
+		}
+		responses[i] = &model.AuditLogResponse{
+			ID:         entry.ID,
+			ActorID:    entry.ActorID,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			APIID:      entry.APIID,
+			Changes:    changes,
+			CreatedAt:  entry.CreatedAt,
+		}
+	}
+	return responses, nil
+}
@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func ToDataExportResponse(export *entity.DataExport) *model.DataExportResponse {
+	return &model.DataExportResponse{
+		ID:          export.ID,
+		UserID:      export.UserID,
+		Format:      export.Format,
+		Status:      export.Status,
+		Error:       export.Error,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}
+}
+
+func ToDataExportsResponse(exports []*entity.DataExport) []*model.DataExportResponse {
+	responses := make([]*model.DataExportResponse, len(exports))
+	for i, export := range exports {
+		responses[i] = ToDataExportResponse(export)
+	}
+	return responses
+}
+
+func ToPersonalDataProfile(user *entity.User) *model.PersonalDataProfile {
+	return &model.PersonalDataProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		DeletedAt:   user.DeletedAt,
+	}
+}
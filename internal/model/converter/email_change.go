@@ -0,0 +1,27 @@
+package converter
+
+import (
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func ToEmailChangeResponse(change *entity.EmailChange) *model.EmailChangeResponse {
+	return &model.EmailChangeResponse{
+		ID:          change.ID,
+		OldEmail:    change.OldEmail,
+		NewEmail:    change.NewEmail,
+		Status:      change.Status,
+		ExpiresAt:   change.ExpiresAt,
+		CreatedAt:   change.CreatedAt,
+		ConfirmedAt: change.ConfirmedAt,
+		RevertedAt:  change.RevertedAt,
+	}
+}
+
+func ToEmailChangesResponse(changes []*entity.EmailChange) []*model.EmailChangeResponse {
+	responses := make([]*model.EmailChangeResponse, len(changes))
+	for i, change := range changes {
+		responses[i] = ToEmailChangeResponse(change)
+	}
+	return responses
+}
@@ -0,0 +1,22 @@
+package converter
+
+import (
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func ToLoginEventResponses(events []*entity.LoginEvent) []*model.LoginEventResponse {
+	responses := make([]*model.LoginEventResponse, len(events))
+	for i, event := range events {
+		responses[i] = &model.LoginEventResponse{
+			ID:            event.ID,
+			Success:       event.Success,
+			FailureReason: event.FailureReason,
+			Method:        event.Method,
+			IP:            event.IP,
+			UserAgent:     event.UserAgent,
+			CreatedAt:     event.CreatedAt,
+		}
+	}
+	return responses
+}
@@ -1,18 +1,97 @@
 package converter
 
 import (
+	"encoding/json"
+	"reflect"
+
 	"github.com/Rafli-Dewanto/go-template/internal/entity"
 	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/jmoiron/sqlx/types"
 )
 
 func ToUserResponse(user *entity.User) *model.UserResponse {
 	return &model.UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		AvatarURL:   user.AvatarURL,
+		AvatarKey:   user.AvatarKey,
+		Status:      user.Status,
+		Attributes:  ToAttributes(user.Attributes),
+		Version:     user.Version,
+		LastLoginAt: user.LastLoginAt,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		DeletedAt:   user.DeletedAt,
+	}
+}
+
+func ToUserPatchDocument(user *model.UserResponse) *model.UserPatchDocument {
+	return &model.UserPatchDocument{
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		AvatarURL:   user.AvatarURL,
+		Attributes:  user.Attributes,
+	}
+}
+
+// ToUpdateUserRequest keeps only the fields of patched that differ from original
+func ToUpdateUserRequest(id int64, version int64, original *model.UserPatchDocument, patched *model.UserPatchDocument) model.UpdateUserRequest {
+	changed := func(before string, after string) *string {
+		if before == after {
+			return nil
+		}
+		return &after
+	}
+
+	return model.UpdateUserRequest{
+		ID:          id,
+		Username:    changed(original.Username, patched.Username),
+		Email:       changed(original.Email, patched.Email),
+		DisplayName: changed(original.DisplayName, patched.DisplayName),
+		Bio:         changed(original.Bio, patched.Bio),
+		Locale:      changed(original.Locale, patched.Locale),
+		Timezone:    changed(original.Timezone, patched.Timezone),
+		AvatarURL:   changed(original.AvatarURL, patched.AvatarURL),
+		Attributes:  changedAttributes(original.Attributes, patched.Attributes),
+		Version:     version,
+	}
+}
+
+// ToAttributes decodes stored attributes, always returning a non-nil map
+func ToAttributes(data types.JSONText) map[string]any {
+	attributes := map[string]any{}
+	if len(data) > 0 {
+		json.Unmarshal(data, &attributes)
+	}
+	return attributes
+}
+
+// FromAttributes encodes attributes for storage, nil is stored as an empty object
+func FromAttributes(attributes map[string]any) (types.JSONText, error) {
+	if attributes == nil {
+		return types.JSONText("{}"), nil
 	}
+	data, err := json.Marshal(attributes)
+	return types.JSONText(data), err
+}
+
+func changedAttributes(before map[string]any, after map[string]any) map[string]any {
+	if after == nil {
+		after = map[string]any{}
+	}
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return after
 }
 
 func ToUsersResponse(users []*entity.User, meta *model.PaginatedMeta) *model.Response {
@@ -27,3 +106,18 @@ func ToUsersResponse(users []*entity.User, meta *model.PaginatedMeta) *model.Res
 		Meta:    meta,
 	}
 }
+
+func ToUserSearchResults(results []*entity.UserSearchResult) []*model.UserSearchResult {
+	responses := make([]*model.UserSearchResult, len(results))
+	for i, result := range results {
+		responses[i] = &model.UserSearchResult{
+			User:  ToUserResponse(&result.User),
+			Score: result.Rank,
+			Highlights: map[string]string{
+				"username":     result.UsernameHighlight,
+				"display_name": result.DisplayNameHighlight,
+			},
+		}
+	}
+	return responses
+}
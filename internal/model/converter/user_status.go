@@ -0,0 +1,25 @@
+package converter
+
+import (
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func ToUserStatusTransitionResponse(transition *entity.UserStatusTransition) *model.UserStatusTransitionResponse {
+	return &model.UserStatusTransitionResponse{
+		ID:         transition.ID,
+		FromStatus: transition.FromStatus,
+		ToStatus:   transition.ToStatus,
+		Reason:     transition.Reason,
+		ActorID:    transition.ActorID,
+		CreatedAt:  transition.CreatedAt,
+	}
+}
+
+func ToUserStatusTransitionResponses(transitions []*entity.UserStatusTransition) []*model.UserStatusTransitionResponse {
+	responses := make([]*model.UserStatusTransitionResponse, len(transitions))
+	for i, transition := range transitions {
+		responses[i] = ToUserStatusTransitionResponse(transition)
+	}
+	return responses
+}
@@ -0,0 +1,14 @@
+package converter
+
+import (
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func ToUsernameHistoryResponses(entries []*entity.UsernameHistory) []*model.UsernameHistoryResponse {
+	responses := make([]*model.UsernameHistoryResponse, len(entries))
+	for i, entry := range entries {
+		responses[i] = &model.UsernameHistoryResponse{Username: entry.Username, ChangedAt: entry.ChangedAt}
+	}
+	return responses
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"encoding/json"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+)
+
+func ToWebhookResponse(webhook *entity.WebhookSubscription) *model.WebhookResponse {
+	events := []string(webhook.Events)
+	if events == nil {
+		events = []string{}
+	}
+	return &model.WebhookResponse{
+		ID:                  webhook.ID,
+		URL:                 webhook.URL,
+		Events:              events,
+		Active:              webhook.Active,
+		ConsecutiveFailures: webhook.ConsecutiveFailures,
+		DisabledAt:          webhook.DisabledAt,
+		DisabledReason:      webhook.DisabledReason,
+		CreatedBy:           webhook.CreatedBy,
+		CreatedAt:           webhook.CreatedAt,
+		UpdatedAt:           webhook.UpdatedAt,
+	}
+}
+
+func ToWebhookResponses(webhooks []*entity.WebhookSubscription) []*model.WebhookResponse {
+	responses := make([]*model.WebhookResponse, len(webhooks))
+	for i, webhook := range webhooks {
+		responses[i] = ToWebhookResponse(webhook)
+	}
+	return responses
+}
+
+func ToWebhookDeliveryResponse(delivery *entity.WebhookDelivery) *model.WebhookDeliveryResponse {
+	response := &model.WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		WebhookID:      delivery.WebhookID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Payload:        json.RawMessage(delivery.Payload),
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+	// Only pending deliveries have another attempt coming
+	if delivery.Status == entity.WebhookDeliveryPending {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return response
+}
+
+func ToWebhookDeliveryResponses(deliveries []*entity.WebhookDelivery) []*model.WebhookDeliveryResponse {
+	responses := make([]*model.WebhookDeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		responses[i] = ToWebhookDeliveryResponse(delivery)
+	}
+	return responses
+}
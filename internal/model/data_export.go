@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+)
+
+type CreateDataExportRequest struct {
+	Format string `json:"format" validate:"omitempty,oneof=json zip"`
+}
+
+type DataExportResponse struct {
+	ID          string     `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// PersonalDataProfile is the users row as handed out in a personal data export.
+// It deliberately has no password field.
+type PersonalDataProfile struct {
+	ID          int64      `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name"`
+	Bio         string     `json:"bio"`
+	Locale      string     `json:"locale"`
+	Timezone    string     `json:"timezone"`
+	AvatarURL   string     `json:"avatar_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+}
+
+type PersonalDataExport struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	UserID      int64                `json:"user_id"`
+	Profile     *PersonalDataProfile `json:"profile"`
+	Sections    map[string]any       `json:"sections"`
+}
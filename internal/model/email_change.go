@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+type RequestEmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// EmailChangeTokenRequest carries the token of a mailed link to the POST that acts on it
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type EmailChangeResponse struct {
+	ID          string     `json:"id"`
+	OldEmail    string     `json:"old_email"`
+	NewEmail    string     `json:"new_email"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	RevertedAt  *time.Time `json:"reverted_at,omitempty"`
+}
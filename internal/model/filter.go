@@ -0,0 +1,59 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DeletedExclude = "exclude"
+	DeletedInclude = "include"
+	DeletedOnly    = "only"
+)
+
+// UserSortFields are the fields clients may sort the user list by
+var UserSortFields = []string{"id", "username", "email", "created_at", "updated_at"}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type UserFilter struct {
+	Username    string
+	Email       string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Deleted     string
+	// Attributes matches users whose custom attributes contain all of these values
+	Attributes map[string]any
+	Sort       []SortField
+}
+
+// ParseSort parses a sort parameter such as "-created_at,username" where a leading
+// minus sorts descending. Every field must be in allowed and appear only once.
+func ParseSort(raw string, allowed []string) ([]SortField, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var fields []SortField
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+
+		if !slices.Contains(allowed, field.Field) {
+			return nil, fmt.Errorf("unknown sort field %q, allowed: %s", field.Field, strings.Join(allowed, ", "))
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("duplicate sort field %q", field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
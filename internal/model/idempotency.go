@@ -0,0 +1,8 @@
+package model
+
+// IdempotentResponse is a response stored for an Idempotency-Key and replayed to retries
+type IdempotentResponse struct {
+	StatusCode int
+	Header     map[string][]string
+	Body       []byte
+}
@@ -0,0 +1,14 @@
+package model
+
+// IdentifierConflict is a group of users whose usernames or emails are equal once normalized
+type IdentifierConflict struct {
+	Field string          `json:"field"`
+	Value string          `json:"normalized_value"`
+	Users []*UserResponse `json:"users"`
+}
+
+// IdentifierReport lists existing accounts that normalization or the username rules would reject
+type IdentifierReport struct {
+	Conflicts           []*IdentifierConflict `json:"conflicts"`
+	ConfusableUsernames []*UserResponse       `json:"confusable_usernames"`
+}
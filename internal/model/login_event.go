@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+// LoginAttempt describes a login attempt to be recorded
+type LoginAttempt struct {
+	UserID        *int64
+	Email         string
+	Success       bool
+	FailureReason string
+	Method        string
+	IP            string
+	UserAgent     string
+}
+
+type LoginEventResponse struct {
+	ID            int64     `json:"id"`
+	Success       bool      `json:"success"`
+	FailureReason *string   `json:"failure_reason,omitempty"`
+	Method        string    `json:"method"`
+	IP            string    `json:"ip"`
+	UserAgent     string    `json:"user_agent"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -1,5 +1,11 @@
 package model
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
 type PaginationQuery struct {
 	Page   int `json:"page"`
 	Limit  int `json:"limit"`
@@ -14,3 +20,49 @@ type PaginatedMeta struct {
 	HasNextPage bool  `json:"has_next_page"`
 	HasPrevPage bool  `json:"has_prev_page"`
 }
+
+// CursorQuery asks for one page of a keyset paginated list. Cursor is empty for the first page.
+type CursorQuery struct {
+	Cursor    string
+	Limit     int
+	Sort      SortField
+	WithTotal bool
+}
+
+// Cursor marks a position in a keyset paginated list: the sort key and ID of the
+// row at the page boundary, and whether to read forwards or backwards from it.
+type Cursor struct {
+	Field    string `json:"f"`
+	Desc     bool   `json:"d,omitempty"`
+	Value    string `json:"v"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+type CursorMeta struct {
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
+	PerPage    int64   `json:"per_page"`
+	Total      *int64  `json:"total,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode renders the cursor as an opaque URL-safe token
+func (c *Cursor) Encode() string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil || cursor.Field == "" {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -1,9 +1,12 @@
 package model
 
+// Response is the standard envelope, Meta holds either a *PaginatedMeta or a *CursorMeta
 type Response struct {
-	Message string         `json:"message"`
-	Data    any            `json:"data,omitempty"`
-	Meta    *PaginatedMeta `json:"meta,omitempty"`
+	// Code identifies errors clients are expected to handle, such as "account_suspended"
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+	Meta    any    `json:"meta,omitempty"`
 }
 
 type FailedResponse struct {
@@ -5,21 +5,80 @@ import (
 )
 
 type UserResponse struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int64          `json:"id"`
+	Username    string         `json:"username"`
+	Email       string         `json:"email"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	Locale      string         `json:"locale"`
+	Timezone    string         `json:"timezone"`
+	AvatarURL   string         `json:"avatar_url"`
+	AvatarKey   *string        `json:"-"`
+	Status      string         `json:"status"`
+	Attributes  map[string]any `json:"attributes"`
+	Version     int64          `json:"version"`
+	LastLoginAt *time.Time     `json:"last_login_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// UserBatchResponse holds the users found by a batch lookup, in request order,
+// and the requested IDs that matched no user
+type UserBatchResponse struct {
+	Users   []*UserResponse
+	Missing []int64
+}
+
+type BatchMeta struct {
+	Requested int     `json:"requested"`
+	Found     int     `json:"found"`
+	Missing   []int64 `json:"missing"`
 }
 
 type CreateUserRequest struct {
-	Username string `json:"username" validate:"required,min=3,max=50"`
+	Username string `json:"username" validate:"required,min=3,max=50,username"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	// Attributes are checked against the deployment's attribute schema, not by tags
+	Attributes map[string]any `json:"attributes,omitempty"`
 }
 
 type UpdateUserRequest struct {
-	ID       int64   `json:"id"`
-	Username *string `json:"username,omitempty" validate:"omitempty,min=3,max=50"`
-	Email    *string `json:"email,omitempty" validate:"omitempty,email"`
+	ID          int64   `json:"id"`
+	Username    *string `json:"username,omitempty" validate:"omitempty,min=3,max=50,username"`
+	Email       *string `json:"email,omitempty" validate:"omitempty,email"`
+	DisplayName *string `json:"display_name,omitempty" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio,omitempty" validate:"omitempty,max=500"`
+	Locale      *string `json:"locale,omitempty" validate:"omitempty,locale"`
+	Timezone    *string `json:"timezone,omitempty" validate:"omitempty,iana_timezone"`
+	AvatarURL   *string `json:"avatar_url,omitempty" validate:"omitempty,http_url,max=2048"`
+	// Attributes replaces all custom attributes when set
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// Version is the version the client last read, taken from If-Match. Zero skips the check.
+	Version int64 `json:"-"`
+}
+
+// UserPatchDocument is the representation PATCH requests are applied to. The
+// patched result must pass validation as a whole before anything is saved.
+type UserPatchDocument struct {
+	Username    string         `json:"username" validate:"required,min=3,max=50,username"`
+	Email       string         `json:"email" validate:"required,email"`
+	DisplayName string         `json:"display_name" validate:"max=100"`
+	Bio         string         `json:"bio" validate:"max=500"`
+	Locale      string         `json:"locale" validate:"omitempty,locale"`
+	Timezone    string         `json:"timezone" validate:"omitempty,iana_timezone"`
+	AvatarURL   string         `json:"avatar_url" validate:"omitempty,http_url,max=2048"`
+	Attributes  map[string]any `json:"attributes"`
+}
+
+type UserSearchQuery struct {
+	Query string `json:"q" validate:"required,min=2,max=100"`
+	Limit int    `json:"limit" validate:"min=1,max=50"`
+}
+
+type UserSearchResult struct {
+	User       *UserResponse     `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
 }
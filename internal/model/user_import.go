@@ -0,0 +1,41 @@
+package model
+
+import (
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+)
+
+const (
+	// ImportModeAtomic imports every row or, if any row fails, none at all
+	ImportModeAtomic = "atomic"
+	// ImportModeBestEffort imports every valid row and reports the rest
+	ImportModeBestEffort = "best_effort"
+)
+
+type ImportOptions struct {
+	Format    string
+	Mode      string
+	DryRun    bool
+	BatchSize int
+}
+
+type ImportRowError struct {
+	Line     int                     `json:"line"`
+	Username string                  `json:"username,omitempty"`
+	Errors   []utils.ValidationError `json:"errors"`
+}
+
+type ImportReport struct {
+	Mode            string           `json:"mode"`
+	DryRun          bool             `json:"dry_run"`
+	Total           int              `json:"total"`
+	Imported        int              `json:"imported"`
+	Failed          int              `json:"failed"`
+	Committed       bool             `json:"committed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
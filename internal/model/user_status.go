@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+type UserStatusTransitionRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending active suspended banned"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type UserStatusTransitionResponse struct {
+	ID         int64     `json:"id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	ActorID    *int64    `json:"actor_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
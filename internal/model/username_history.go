@@ -0,0 +1,10 @@
+package model
+
+import (
+	"time"
+)
+
+type UsernameHistoryResponse struct {
+	Username  string    `json:"username"`
+	ChangedAt time.Time `json:"changed_at"`
+}
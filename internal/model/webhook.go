@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type CreateWebhookRequest struct {
+	URL string `json:"url" validate:"required,http_url,max=2048"`
+	// Secret signs the deliveries, one is generated when left empty
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=255"`
+	Events []string `json:"events" validate:"dive,oneof=user.created user.updated user.deleted"`
+}
+
+// UpdateWebhookRequest changes the fields that are set. Activating a disabled
+// webhook clears its failure count.
+type UpdateWebhookRequest struct {
+	URL    *string   `json:"url" validate:"omitempty,http_url,max=2048"`
+	Secret *string   `json:"secret" validate:"omitempty,min=16,max=255"`
+	Events *[]string `json:"events" validate:"omitempty,dive,oneof=user.created user.updated user.deleted"`
+	Active *bool     `json:"active"`
+}
+
+type WebhookResponse struct {
+	ID                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DisabledReason      *string    `json:"disabled_reason"`
+	CreatedBy           *int64     `json:"created_by"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// WebhookCreatedResponse is the only response that includes the signing secret
+type WebhookCreatedResponse struct {
+	WebhookResponse
+	Secret string `json:"secret"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, entry *entity.AuditLog) error
+	List(ctx context.Context, filter *model.AuditLogFilter, query *model.PaginationQuery) ([]*entity.AuditLog, int64, error)
+	ListByTarget(ctx context.Context, targetType string, targetID int64) ([]*entity.AuditLog, error)
+}
+
+type auditRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewAuditRepository(db *sqlx.DB, logger *utils.Logger) AuditRepository {
+	return &auditRepository{db: db, logger: logger}
+}
+
+// Create joins the transaction carried by ctx, if any, so the entry commits or
+// rolls back together with the change it records
+func (r *auditRepository) Create(ctx context.Context, entry *entity.AuditLog) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("AuditRepository.Create: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO audit_log (aud_actor_id, aud_action, aud_target_type, aud_target_id, aud_api_id, aud_changes, aud_created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING aud_id, aud_created_at
+	`
+	err = tx.QueryRowxContext(ctx, query, entry.ActorID, entry.Action, entry.TargetType, entry.TargetID,
+		entry.APIID, entry.Changes).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		r.logger.Error("AuditRepository.Create: %v", err)
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("AuditRepository.Create: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *auditRepository) List(ctx context.Context, filter *model.AuditLogFilter, query *model.PaginationQuery) ([]*entity.AuditLog, int64, error) {
+	args := queryArgs{}
+	conditions := []string{}
+	if filter.ActorID != nil {
+		conditions = append(conditions, "aud_actor_id = "+args.add(*filter.ActorID))
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "aud_action = "+args.add(filter.Action))
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "aud_target_type = "+args.add(filter.TargetType))
+	}
+	if filter.TargetID != nil {
+		conditions = append(conditions, "aud_target_id = "+args.add(*filter.TargetID))
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "aud_created_at >= "+args.add(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "aud_created_at <= "+args.add(*filter.To))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM audit_log `+where, args...); err != nil {
+		r.logger.Error("AuditRepository.List: %v", err)
+		return nil, 0, err
+	}
+
+	entries := []*entity.AuditLog{}
+	listQuery := fmt.Sprintf(`
+		SELECT * FROM audit_log
+		%s
+		ORDER BY aud_created_at DESC, aud_id DESC
+		LIMIT %s OFFSET %s
+	`, where, args.add(query.Limit), args.add(query.Offset))
+
+	if err := r.db.SelectContext(ctx, &entries, listQuery, args...); err != nil {
+		r.logger.Error("AuditRepository.List: %v", err)
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// ListByTarget returns every entry about one target, newest first
+func (r *auditRepository) ListByTarget(ctx context.Context, targetType string, targetID int64) ([]*entity.AuditLog, error) {
+	entries := []*entity.AuditLog{}
+	query := `
+		SELECT * FROM audit_log
+		WHERE aud_target_type = $1 AND aud_target_id = $2
+		ORDER BY aud_created_at DESC, aud_id DESC
+	`
+	if err := r.db.SelectContext(ctx, &entries, query, targetType, targetID); err != nil {
+		r.logger.Error("AuditRepository.ListByTarget: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type DataExportRepository interface {
+	Create(ctx context.Context, export *entity.DataExport) error
+	GetByID(ctx context.Context, userID int64, id string) (*entity.DataExport, error)
+	ListByUser(ctx context.Context, userID int64) ([]*entity.DataExport, error)
+	UpdateStatus(ctx context.Context, export *entity.DataExport) error
+	ClaimPending(ctx context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.DataExport, error)
+	// ListExpired returns up to limit exports whose archive expired before now
+	// and is still stored
+	ListExpired(ctx context.Context, now time.Time, limit int) ([]*entity.DataExport, error)
+	// MarkExpired records that the archive of an export was deleted
+	MarkExpired(ctx context.Context, id string) error
+}
+
+type dataExportRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewDataExportRepository(db *sqlx.DB, logger *utils.Logger) DataExportRepository {
+	return &dataExportRepository{db: db, logger: logger}
+}
+
+func (r *dataExportRepository) Create(ctx context.Context, export *entity.DataExport) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("DataExportRepository.Create: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO user_data_exports (exp_id, exp_usr_id, exp_requested_by, exp_format, exp_status, exp_created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING exp_created_at
+	`
+
+	err = tx.QueryRowx(query, export.ID, export.UserID, export.RequestedBy, export.Format, export.Status).Scan(&export.CreatedAt)
+	if err != nil {
+		r.logger.Error("DataExportRepository.Create: %v", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("DataExportRepository.Create: failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *dataExportRepository) GetByID(ctx context.Context, userID int64, id string) (*entity.DataExport, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("DataExportRepository.GetByID: failed to start transaction: %v", err)
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	export := &entity.DataExport{}
+	query := `SELECT * FROM user_data_exports WHERE exp_id = $1 AND exp_usr_id = $2`
+
+	err = tx.Get(export, query, id, userID)
+	if err != nil {
+		r.logger.Error("DataExportRepository.GetByID: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("DataExportRepository.GetByID: failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (r *dataExportRepository) ListByUser(ctx context.Context, userID int64) ([]*entity.DataExport, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("DataExportRepository.ListByUser: failed to start transaction: %v", err)
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	exports := []*entity.DataExport{}
+	query := `SELECT * FROM user_data_exports WHERE exp_usr_id = $1 ORDER BY exp_created_at DESC`
+
+	err = tx.Select(&exports, query, userID)
+	if err != nil {
+		r.logger.Error("DataExportRepository.ListByUser: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("DataExportRepository.ListByUser: failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (r *dataExportRepository) UpdateStatus(ctx context.Context, export *entity.DataExport) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("DataExportRepository.UpdateStatus: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE user_data_exports
+		SET exp_status = $1, exp_file_key = $2, exp_error = $3, exp_completed_at = $4, exp_expires_at = $5
+		WHERE exp_id = $6
+	`
+
+	_, err = tx.Exec(query, export.Status, export.FileKey, export.Error, export.CompletedAt, export.ExpiresAt, export.ID)
+	if err != nil {
+		r.logger.Error("DataExportRepository.UpdateStatus: %v", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("DataExportRepository.UpdateStatus: failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ClaimPending marks the oldest pending exports, and running ones whose lease
+// expired, as running and leases them to the caller until leaseUntil
+func (r *dataExportRepository) ClaimPending(ctx context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.DataExport, error) {
+	query := `
+		UPDATE user_data_exports SET exp_status = 'running', exp_lease_until = $3
+		WHERE exp_id IN (
+			SELECT exp_id FROM user_data_exports
+			WHERE exp_status = 'pending' OR (exp_status = 'running' AND (exp_lease_until IS NULL OR exp_lease_until <= $2))
+			ORDER BY exp_created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	exports := []*entity.DataExport{}
+	if err := r.db.SelectContext(ctx, &exports, query, limit, now, leaseUntil); err != nil {
+		r.logger.Error("DataExportRepository.ClaimPending: %v", err)
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *dataExportRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]*entity.DataExport, error) {
+	query := `
+		SELECT * FROM user_data_exports
+		WHERE exp_file_key IS NOT NULL AND exp_expires_at <= $1
+		ORDER BY exp_expires_at
+		LIMIT $2
+	`
+
+	exports := []*entity.DataExport{}
+	if err := r.db.SelectContext(ctx, &exports, query, now, limit); err != nil {
+		r.logger.Error("DataExportRepository.ListExpired: %v", err)
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *dataExportRepository) MarkExpired(ctx context.Context, id string) error {
+	query := `UPDATE user_data_exports SET exp_status = $1, exp_file_key = NULL WHERE exp_id = $2`
+	if _, err := r.db.ExecContext(ctx, query, entity.DataExportStatusExpired, id); err != nil {
+		r.logger.Error("DataExportRepository.MarkExpired: %v", err)
+		return err
+	}
+	return nil
+}
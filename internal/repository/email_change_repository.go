@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrEmailChangeConflict means the user's email moved on since the change was requested
+	ErrEmailChangeConflict = errors.New("email change no longer applies")
+	ErrEmailTaken          = errors.New("email already in use")
+)
+
+type EmailChangeRepository interface {
+	Create(ctx context.Context, change *entity.EmailChange) error
+	GetByConfirmTokenHash(ctx context.Context, hash string) (*entity.EmailChange, error)
+	GetByRevertTokenHash(ctx context.Context, hash string) (*entity.EmailChange, error)
+	ListByUser(ctx context.Context, userID int64) ([]*entity.EmailChange, error)
+	Confirm(ctx context.Context, change *entity.EmailChange) error
+	Revert(ctx context.Context, change *entity.EmailChange) error
+}
+
+type emailChangeRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewEmailChangeRepository(db *sqlx.DB, logger *utils.Logger) EmailChangeRepository {
+	return &emailChangeRepository{db: db, logger: logger}
+}
+
+// Create stores a pending change and supersedes any change still pending for the user
+func (r *emailChangeRepository) Create(ctx context.Context, change *entity.EmailChange) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.Create: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`UPDATE user_email_changes SET ech_status = $1 WHERE ech_usr_id = $2 AND ech_status = $3`,
+		entity.EmailChangeStatusSuperseded, change.UserID, entity.EmailChangeStatusPending)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.Create: failed to supersede pending changes: %v", err)
+		return err
+	}
+
+	query := `
+		INSERT INTO user_email_changes (ech_id, ech_usr_id, ech_old_email, ech_new_email, ech_confirm_token_hash,
+			ech_revert_token_hash, ech_status, ech_expires_at, ech_revert_expires_at, ech_created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW()) RETURNING ech_created_at
+	`
+	err = tx.QueryRowx(query, change.ID, change.UserID, change.OldEmail, change.NewEmail, change.ConfirmTokenHash,
+		change.RevertTokenHash, change.Status, change.ExpiresAt, change.RevertExpiresAt).Scan(&change.CreatedAt)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.Create: %v", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("EmailChangeRepository.Create: failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *emailChangeRepository) GetByConfirmTokenHash(ctx context.Context, hash string) (*entity.EmailChange, error) {
+	change := &entity.EmailChange{}
+	err := r.db.GetContext(ctx, change, `SELECT * FROM user_email_changes WHERE ech_confirm_token_hash = $1`, hash)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.GetByConfirmTokenHash: %v", err)
+		return nil, err
+	}
+	return change, nil
+}
+
+func (r *emailChangeRepository) GetByRevertTokenHash(ctx context.Context, hash string) (*entity.EmailChange, error) {
+	change := &entity.EmailChange{}
+	err := r.db.GetContext(ctx, change, `SELECT * FROM user_email_changes WHERE ech_revert_token_hash = $1`, hash)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.GetByRevertTokenHash: %v", err)
+		return nil, err
+	}
+	return change, nil
+}
+
+func (r *emailChangeRepository) ListByUser(ctx context.Context, userID int64) ([]*entity.EmailChange, error) {
+	changes := []*entity.EmailChange{}
+	query := `SELECT * FROM user_email_changes WHERE ech_usr_id = $1 ORDER BY ech_created_at DESC`
+
+	if err := r.db.SelectContext(ctx, &changes, query, userID); err != nil {
+		r.logger.Error("EmailChangeRepository.ListByUser: %v", err)
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Confirm switches the user to the new address and marks the change confirmed.
+// It fails with ErrEmailChangeConflict if either row moved on in the meantime.
+func (r *emailChangeRepository) Confirm(ctx context.Context, change *entity.EmailChange) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.Confirm: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	err = r.moveEmail(ctx, tx, change.UserID, change.OldEmail, change.NewEmail)
+	if err != nil {
+		return err
+	}
+
+	err = r.setStatus(tx, change, entity.EmailChangeStatusPending, entity.EmailChangeStatusConfirmed, "ech_confirmed_at")
+	if err != nil {
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("EmailChangeRepository.Confirm: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Revert cancels a pending change, or moves the user back to the old address
+// if the change was already confirmed
+func (r *emailChangeRepository) Revert(ctx context.Context, change *entity.EmailChange) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("EmailChangeRepository.Revert: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	if change.Status == entity.EmailChangeStatusConfirmed {
+		err = r.moveEmail(ctx, tx, change.UserID, change.NewEmail, change.OldEmail)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.setStatus(tx, change, change.Status, entity.EmailChangeStatusReverted, "ech_reverted_at")
+	if err != nil {
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("EmailChangeRepository.Revert: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveEmail changes the user's email from one address to another, only if it is still from
+func (r *emailChangeRepository) moveEmail(ctx context.Context, tx *sqlx.Tx, userID int64, from string, to string) error {
+	query := `
+		UPDATE users SET usr_email = $1, usr_updated_at = NOW(), usr_version = usr_version + 1
+		WHERE usr_id = $2 AND usr_email = $3 AND usr_deleted_at IS NULL
+	`
+	result, err := tx.Exec(query, to, userID, from)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" { // Unique violation
+			r.logger.Warning("EmailChangeRepository: email already in use: %v", to)
+			return ErrEmailTaken
+		}
+		r.logger.Error("EmailChangeRepository: failed to update user email: %v", err)
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrEmailChangeConflict
+	}
+
+	if err := insertUserEvents(ctx, tx, entity.EventUserUpdated, "usr_id = $2", userID); err != nil {
+		r.logger.Error("EmailChangeRepository: failed to record event: %v", err)
+		return err
+	}
+	return nil
+}
+
+// setStatus moves the change from one status to another and stamps the given column
+func (r *emailChangeRepository) setStatus(tx *sqlx.Tx, change *entity.EmailChange, from string, to string, stampColumn string) error {
+	query := `UPDATE user_email_changes SET ech_status = $1, ` + stampColumn + ` = NOW()
+		WHERE ech_id = $2 AND ech_status = $3 RETURNING ` + stampColumn
+
+	var stamp pq.NullTime
+	err := tx.QueryRowx(query, to, change.ID, from).Scan(&stamp)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEmailChangeConflict
+		}
+		r.logger.Error("EmailChangeRepository: failed to update change status: %v", err)
+		return err
+	}
+
+	change.Status = to
+	if to == entity.EmailChangeStatusConfirmed {
+		change.ConfirmedAt = &stamp.Time
+	} else {
+		change.RevertedAt = &stamp.Time
+	}
+	return nil
+}
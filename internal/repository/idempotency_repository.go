@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyRepository interface {
+	Claim(ctx context.Context, key *entity.IdempotencyKey, now time.Time) (bool, error)
+	Get(ctx context.Context, scope string, key string) (*entity.IdempotencyKey, error)
+	Complete(ctx context.Context, key *entity.IdempotencyKey) error
+	Release(ctx context.Context, scope string, key string, fingerprint string) error
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewIdempotencyRepository(db *sqlx.DB, logger *utils.Logger) IdempotencyRepository {
+	return &idempotencyRepository{db: db, logger: logger}
+}
+
+// Claim stores key as processing. A key already present is only taken over when
+// its response has expired or the request holding it ran past its lock, so
+// exactly one request at a time processes a key. It reports whether the key was claimed.
+func (r *idempotencyRepository) Claim(ctx context.Context, key *entity.IdempotencyKey, now time.Time) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (idk_scope, idk_key, idk_fingerprint, idk_status, idk_locked_until, idk_created_at, idk_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (idk_scope, idk_key) DO UPDATE SET
+			idk_fingerprint = EXCLUDED.idk_fingerprint, idk_status = EXCLUDED.idk_status,
+			idk_response_status = NULL, idk_response_headers = NULL, idk_response_body = NULL,
+			idk_locked_until = EXCLUDED.idk_locked_until, idk_created_at = EXCLUDED.idk_created_at,
+			idk_expires_at = EXCLUDED.idk_expires_at
+		WHERE idempotency_keys.idk_expires_at < $6
+			OR (idempotency_keys.idk_status = $4 AND idempotency_keys.idk_locked_until < $6)
+		RETURNING idk_key
+	`
+
+	var claimed string
+	err := r.db.QueryRowxContext(ctx, query, key.Scope, key.Key, key.Fingerprint, entity.IdempotencyStatusProcessing,
+		key.LockedUntil, now, key.ExpiresAt).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		r.logger.Error("IdempotencyRepository.Claim: %v", err)
+		return false, err
+	}
+
+	key.Status = entity.IdempotencyStatusProcessing
+	key.CreatedAt = now
+	return true, nil
+}
+
+func (r *idempotencyRepository) Get(ctx context.Context, scope string, key string) (*entity.IdempotencyKey, error) {
+	record := &entity.IdempotencyKey{}
+	err := r.db.GetContext(ctx, record, `SELECT * FROM idempotency_keys WHERE idk_scope = $1 AND idk_key = $2`, scope, key)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			r.logger.Error("IdempotencyRepository.Get: %v", err)
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// Complete stores the response of a key this request claimed
+func (r *idempotencyRepository) Complete(ctx context.Context, key *entity.IdempotencyKey) error {
+	query := `
+		UPDATE idempotency_keys
+		SET idk_status = $1, idk_response_status = $2, idk_response_headers = $3, idk_response_body = $4
+		WHERE idk_scope = $5 AND idk_key = $6 AND idk_fingerprint = $7 AND idk_status = $8
+	`
+	_, err := r.db.ExecContext(ctx, query, entity.IdempotencyStatusCompleted, key.ResponseStatus, key.ResponseHeaders,
+		key.ResponseBody, key.Scope, key.Key, key.Fingerprint, entity.IdempotencyStatusProcessing)
+	if err != nil {
+		r.logger.Error("IdempotencyRepository.Complete: %v", err)
+		return err
+	}
+
+	key.Status = entity.IdempotencyStatusCompleted
+	return nil
+}
+
+// Release gives up a claimed key without a response, so a retry runs the request again
+func (r *idempotencyRepository) Release(ctx context.Context, scope string, key string, fingerprint string) error {
+	query := `DELETE FROM idempotency_keys WHERE idk_scope = $1 AND idk_key = $2 AND idk_fingerprint = $3 AND idk_status = $4`
+	if _, err := r.db.ExecContext(ctx, query, scope, key, fingerprint, entity.IdempotencyStatusProcessing); err != nil {
+		r.logger.Error("IdempotencyRepository.Release: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *idempotencyRepository) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE idk_expires_at < $1 AND (idk_status = $2 OR idk_locked_until < $1)`
+	result, err := r.db.ExecContext(ctx, query, now, entity.IdempotencyStatusCompleted)
+	if err != nil {
+		r.logger.Error("IdempotencyRepository.PurgeExpired: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// loginEventPurgeBatch bounds how many rows one purge statement deletes, so a
+// large backlog does not hold locks for long
+const loginEventPurgeBatch = 5000
+
+type LoginEventRepository interface {
+	Create(ctx context.Context, event *entity.LoginEvent) error
+	ListByUser(ctx context.Context, userID int64, query *model.PaginationQuery) ([]*entity.LoginEvent, int64, error)
+	PurgeBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type loginEventRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewLoginEventRepository(db *sqlx.DB, logger *utils.Logger) LoginEventRepository {
+	return &loginEventRepository{db: db, logger: logger}
+}
+
+// Create records a login attempt. A successful one also stamps the user's
+// usr_last_login_at in the same transaction. The user's version is left alone,
+// logging in is not an edit and must not invalidate copies clients hold.
+func (r *loginEventRepository) Create(ctx context.Context, event *entity.LoginEvent) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("LoginEventRepository.Create: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO user_login_events (lev_usr_id, lev_email, lev_success, lev_failure_reason, lev_method, lev_ip, lev_user_agent, lev_created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW()) RETURNING lev_id, lev_created_at
+	`
+	err = tx.QueryRowxContext(ctx, query, event.UserID, event.Email, event.Success, event.FailureReason,
+		event.Method, event.IP, event.UserAgent).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		r.logger.Error("LoginEventRepository.Create: %v", err)
+		return err
+	}
+
+	if event.Success && event.UserID != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET usr_last_login_at = $1 WHERE usr_id = $2`, event.CreatedAt, *event.UserID)
+		if err != nil {
+			r.logger.Error("LoginEventRepository.Create: failed to update last login: %v", err)
+			return err
+		}
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("LoginEventRepository.Create: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *loginEventRepository) ListByUser(ctx context.Context, userID int64, query *model.PaginationQuery) ([]*entity.LoginEvent, int64, error) {
+	var total int64
+	err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM user_login_events WHERE lev_usr_id = $1`, userID)
+	if err != nil {
+		r.logger.Error("LoginEventRepository.ListByUser: %v", err)
+		return nil, 0, err
+	}
+
+	events := []*entity.LoginEvent{}
+	listQuery := `
+		SELECT * FROM user_login_events WHERE lev_usr_id = $1
+		ORDER BY lev_created_at DESC, lev_id DESC
+		LIMIT $2 OFFSET $3
+	`
+	if err := r.db.SelectContext(ctx, &events, listQuery, userID, query.Limit, query.Offset); err != nil {
+		r.logger.Error("LoginEventRepository.ListByUser: %v", err)
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// PurgeBefore deletes events recorded before the given time, in batches, and
+// returns how many were deleted
+func (r *loginEventRepository) PurgeBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM user_login_events WHERE lev_id IN (
+			SELECT lev_id FROM user_login_events WHERE lev_created_at < $1 LIMIT $2
+		)
+	`
+
+	var purged int64
+	for {
+		result, err := r.db.ExecContext(ctx, query, before, loginEventPurgeBatch)
+		if err != nil {
+			r.logger.Error("LoginEventRepository.PurgeBefore: %v", err)
+			return purged, err
+		}
+
+		affected, _ := result.RowsAffected()
+		purged += affected
+		if affected < loginEventPurgeBatch {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// userEventPayload renders a users row as the payload of its events. The
+// password hash and storage keys stay out of it.
+const userEventPayload = `json_build_object(
+	'id', usr_id, 'username', usr_username, 'email', usr_email, 'display_name', usr_display_name,
+	'bio', usr_bio, 'locale', usr_locale, 'timezone', usr_timezone, 'avatar_url', usr_avatar_url,
+	'status', usr_status, 'attributes', usr_attributes, 'version', usr_version,
+	'created_at', usr_created_at, 'updated_at', usr_updated_at, 'deleted_at', usr_deleted_at
+)`
+
+type OutboxRepository interface {
+	// ClaimPending leases up to limit events that are due, at most one per
+	// aggregate and only the oldest unpublished one, so each aggregate's events
+	// are published in order. A claimed event is not handed out again before
+	// leaseUntil unless it is marked failed.
+	ClaimPending(ctx context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.OutboxEvent, error)
+	// GetByID returns sql.ErrNoRows for an event that does not exist or was purged
+	GetByID(ctx context.Context, id int64) (*entity.OutboxEvent, error)
+	MarkPublished(ctx context.Context, id int64, now time.Time) error
+	MarkFailed(ctx context.Context, id int64, retryAt time.Time, lastError string) error
+	PurgePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outboxRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewOutboxRepository(db *sqlx.DB, logger *utils.Logger) OutboxRepository {
+	return &outboxRepository{db: db, logger: logger}
+}
+
+// insertUserEvents records an event for every user matching where, whose
+// placeholders start at $2. It runs in the transaction of the write the event
+// describes and after it, so the payload is the committed state of the row.
+func insertUserEvents(ctx context.Context, tx *sqlx.Tx, eventType string, where string, args ...any) error {
+	query := fmt.Sprintf(`
+		INSERT INTO outbox_events (obx_aggregate_type, obx_aggregate_id, obx_event_type, obx_payload)
+		SELECT '%s', usr_id, $1, %s FROM users WHERE %s ORDER BY usr_id
+	`, entity.AggregateUser, userEventPayload, where)
+	_, err := tx.ExecContext(ctx, query, append([]any{eventType}, args...)...)
+	return err
+}
+
+func (r *outboxRepository) ClaimPending(ctx context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.OutboxEvent, error) {
+	query := `
+		UPDATE outbox_events SET obx_available_at = $3, obx_attempts = obx_attempts + 1
+		WHERE obx_id IN (
+			SELECT o.obx_id FROM outbox_events o
+			WHERE o.obx_published_at IS NULL AND o.obx_available_at <= $2
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox_events e
+					WHERE e.obx_aggregate_type = o.obx_aggregate_type AND e.obx_aggregate_id = o.obx_aggregate_id
+						AND e.obx_published_at IS NULL AND e.obx_id < o.obx_id
+				)
+			ORDER BY o.obx_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	events := []*entity.OutboxEvent{}
+	if err := r.db.SelectContext(ctx, &events, query, limit, now, leaseUntil); err != nil {
+		r.logger.Error("OutboxRepository.ClaimPending: %v", err)
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *outboxRepository) GetByID(ctx context.Context, id int64) (*entity.OutboxEvent, error) {
+	event := &entity.OutboxEvent{}
+	err := r.db.GetContext(ctx, event, `SELECT * FROM outbox_events WHERE obx_id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		r.logger.Error("OutboxRepository.GetByID: %v", err)
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, id int64, now time.Time) error {
+	query := `UPDATE outbox_events SET obx_published_at = $1, obx_last_error = NULL WHERE obx_id = $2`
+	if _, err := r.db.ExecContext(ctx, query, now, id); err != nil {
+		r.logger.Error("OutboxRepository.MarkPublished: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id int64, retryAt time.Time, lastError string) error {
+	query := `UPDATE outbox_events SET obx_available_at = $1, obx_last_error = $2 WHERE obx_id = $3 AND obx_published_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, retryAt, lastError, id); err != nil {
+		r.logger.Error("OutboxRepository.MarkFailed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// PurgePublished deletes events published before the cutoff, unpublished events are never purged
+func (r *outboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE obx_published_at < $1`, before)
+	if err != nil {
+		r.logger.Error("OutboxRepository.PurgePublished: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
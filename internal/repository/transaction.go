@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type txContextKey struct{}
+
+// Transactor runs a function inside a single database transaction. Repository
+// methods that support it pick the transaction up from the context passed to fn.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactor struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewTransactor(db *sqlx.DB, logger *utils.Logger) Transactor {
+	return &transactor{db: db, logger: logger}
+}
+
+// WithinTransaction commits when fn returns nil and rolls back otherwise.
+// Nested calls join the outer transaction.
+func (t *transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.logger.Error("Transactor.WithinTransaction: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.logger.Error("Transactor.WithinTransaction: failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func txFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*sqlx.Tx)
+	return tx, ok
+}
+
+// beginTx returns the transaction carried by ctx or starts a new one. Only
+// transactions the caller owns may be committed or rolled back by it.
+func beginTx(ctx context.Context, db *sqlx.DB) (tx *sqlx.Tx, owned bool, err error) {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx, false, nil
+	}
+	tx, err = db.BeginTxx(ctx, nil)
+	return tx, true, err
+}
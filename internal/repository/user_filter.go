@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/jmoiron/sqlx/types"
+)
+
+// userSortColumns maps the public sort fields to their columns, anything else is rejected
+var userSortColumns = map[string]string{
+	"id":         "usr_id",
+	"username":   "usr_username",
+	"email":      "usr_email",
+	"created_at": "usr_created_at",
+	"updated_at": "usr_updated_at",
+}
+
+// queryArgs collects positional arguments and hands out their $n placeholders
+type queryArgs []any
+
+func (a *queryArgs) add(value any) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// buildUserWhere turns a filter into a WHERE clause whose values are all bound parameters
+func buildUserWhere(filter *model.UserFilter, args *queryArgs) string {
+	conditions := []string{}
+
+	deleted := model.DeletedExclude
+	if filter != nil && filter.Deleted != "" {
+		deleted = filter.Deleted
+	}
+	switch deleted {
+	case model.DeletedOnly:
+		conditions = append(conditions, "usr_deleted_at IS NOT NULL")
+	case model.DeletedInclude:
+	default:
+		conditions = append(conditions, "usr_deleted_at IS NULL")
+	}
+
+	if filter != nil {
+		if filter.Username != "" {
+			conditions = append(conditions, "usr_username ILIKE "+args.add("%"+escapeLike(filter.Username)+"%"))
+		}
+		if filter.Email != "" {
+			conditions = append(conditions, "usr_email ILIKE "+args.add("%"+escapeLike(filter.Email)+"%"))
+		}
+		if filter.CreatedFrom != nil {
+			conditions = append(conditions, "usr_created_at >= "+args.add(*filter.CreatedFrom))
+		}
+		if filter.CreatedTo != nil {
+			conditions = append(conditions, "usr_created_at <= "+args.add(*filter.CreatedTo))
+		}
+		if len(filter.Attributes) > 0 {
+			// Containment is served by the GIN index on usr_attributes
+			contained, _ := json.Marshal(filter.Attributes)
+			conditions = append(conditions, "usr_attributes @> "+args.add(string(contained))+"::jsonb")
+		}
+	}
+
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// buildUserOrderBy renders the requested sort, defaulting to newest first, with
+// usr_id as the final tie-breaker so pages are stable.
+func buildUserOrderBy(sort []model.SortField) (string, error) {
+	if len(sort) == 0 {
+		sort = []model.SortField{{Field: "created_at", Desc: true}}
+	}
+
+	terms := make([]string, 0, len(sort)+1)
+	hasID := false
+	for _, field := range sort {
+		column, ok := userSortColumns[field.Field]
+		if !ok {
+			return "", fmt.Errorf("unsupported sort field: %s", field.Field)
+		}
+		direction := "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, column+" "+direction)
+		hasID = hasID || column == "usr_id"
+	}
+	if !hasID {
+		terms = append(terms, "usr_id "+strings.Fields(terms[len(terms)-1])[1])
+	}
+
+	return "ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+// cursorValue converts the sort key stored in a cursor back into a query argument
+func cursorValue(field string, cursor *model.Cursor) (any, error) {
+	if field != cursor.Field {
+		return nil, model.ErrInvalidCursor
+	}
+
+	switch field {
+	case "id":
+		return cursor.ID, nil
+	case "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, model.ErrInvalidCursor
+		}
+		return t, nil
+	default:
+		return cursor.Value, nil
+	}
+}
+
+// attributesValue passes stored attributes on as JSONB, absent attributes are an empty object
+func attributesValue(attributes types.JSONText) types.JSONText {
+	if len(attributes) == 0 {
+		return types.JSONText("{}")
+	}
+	return attributes
+}
+
+func appendCondition(where string, condition string) string {
+	if where == "" {
+		return "WHERE " + condition
+	}
+	return where + " AND " + condition
+}
+
+// escapeLike escapes the LIKE wildcards so user input only ever matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/Rafli-Dewanto/go-template/internal/entity"
 	"github.com/Rafli-Dewanto/go-template/internal/model"
@@ -12,13 +14,27 @@ import (
 	"github.com/lib/pq"
 )
 
+// ErrVersionConflict is returned by Update when the row no longer has the expected version
+var (
+	ErrVersionConflict = errors.New("user version conflict")
+	// ErrUserExists is returned when a write hits the unique username or email index
+	ErrUserExists = errors.New("username or email already in use")
+)
+
 type UserRepository interface {
 	GetByUsername(ctx context.Context, username string) (*entity.User, error)
 	GetByEmailOrUsername(ctx context.Context, email string, username string) (*entity.User, error)
 	Create(ctx context.Context, user *entity.User) error
+	CreateBatch(ctx context.Context, users []*entity.User) error
+	FindByUsernamesOrEmails(ctx context.Context, usernames []string, emails []string) ([]*entity.User, error)
 	GetByID(ctx context.Context, id int64) (*entity.User, error)
-	List(ctx context.Context, query *model.PaginationQuery) ([]*entity.User, int64, error)
+	GetByIDs(ctx context.Context, ids []int64) ([]*entity.User, error)
+	List(ctx context.Context, query *model.PaginationQuery, filter *model.UserFilter) ([]*entity.User, int64, error)
+	ListByCursor(ctx context.Context, filter *model.UserFilter, cursor *model.Cursor, sort model.SortField, limit int, withTotal bool) ([]*entity.User, *int64, error)
+	Search(ctx context.Context, term string, limit int) ([]*entity.UserSearchResult, error)
+	Stream(ctx context.Context, filter *model.UserFilter, fn func(user *entity.User) error) error
 	Update(ctx context.Context, user *entity.User) error
+	UpdateAvatar(ctx context.Context, id int64, avatarURL string, avatarKey *string) error
 	SoftDelete(ctx context.Context, id int64) error
 }
 
@@ -44,7 +60,7 @@ func (r *userRepository) GetByUsername(ctx context.Context, username string) (*e
 		}
 	}()
 
-	query := `SELECT * FROM users WHERE usr_username = $1 LIMIT 1`
+	query := `SELECT * FROM users WHERE lower(usr_username) = lower($1) LIMIT 1`
 	user := &entity.User{}
 
 	err = tx.Get(user, query, username)
@@ -69,7 +85,7 @@ func (r *userRepository) GetByEmailOrUsername(ctx context.Context, email string,
 		}
 	}()
 
-	query := `SELECT * FROM users WHERE usr_email = $1 OR usr_username = $2 LIMIT 1`
+	query := `SELECT * FROM users WHERE lower(usr_email) = lower($1) OR lower(usr_username) = lower($2) LIMIT 1`
 	user := &entity.User{}
 
 	err = tx.Get(user, query, email, username)
@@ -87,37 +103,147 @@ func (r *userRepository) Create(ctx context.Context, user *entity.User) error {
 		return context.DeadlineExceeded
 	}
 
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, owned, err := beginTx(ctx, r.db)
 	if err != nil {
 		r.logger.Error("UserRepository.Create: failed to start transaction: %v", err)
 		return err
 	}
 
 	defer func() {
-		if err != nil {
+		if err != nil && owned {
 			tx.Rollback()
 		}
 	}()
 
+	// Users start active unless the caller says otherwise, as self-signups do
+	if user.Status == "" {
+		user.Status = entity.UserStatusActive
+	}
+
 	query := `
-		INSERT INTO users (usr_username, usr_password, usr_email, usr_created_at, usr_updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW()) RETURNING usr_id, usr_created_at, usr_updated_at
+		INSERT INTO users (usr_username, usr_password, usr_email, usr_attributes, usr_status, usr_created_at, usr_updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING usr_id, usr_created_at, usr_updated_at
 	`
 
-	err = tx.QueryRowx(query, user.Username, user.Password, user.Email).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err = tx.QueryRowx(query, user.Username, user.Password, user.Email, attributesValue(user.Attributes), user.Status).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" { // Unique violation
+			r.logger.Warning("UserRepository.Create: username or email already exists: %v", user.Username)
+			return ErrUserExists
+		}
 		r.logger.Error("UserRepository.Create: %v", err)
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		r.logger.Error("UserRepository.Create: failed to commit transaction: %v", err)
+	if err = insertUserEvents(ctx, tx, entity.EventUserCreated, "usr_id = $2", user.ID); err != nil {
+		r.logger.Error("UserRepository.Create: failed to record event: %v", err)
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UserRepository.Create: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateBatch inserts users with COPY. It joins the transaction carried by ctx, if any,
+// so a whole import can be committed or rolled back at once.
+func (r *userRepository) CreateBatch(ctx context.Context, users []*entity.User) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("UserRepository.CreateBatch: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("users", "usr_username", "usr_email", "usr_password", "usr_attributes"))
+	if err != nil {
+		r.logger.Error("UserRepository.CreateBatch: failed to prepare copy: %v", err)
+		return err
+	}
+
+	for _, user := range users {
+		if _, err = stmt.ExecContext(ctx, user.Username, user.Email, user.Password, string(attributesValue(user.Attributes))); err != nil {
+			stmt.Close()
+			r.logger.Error("UserRepository.CreateBatch: %v", err)
+			return err
+		}
+	}
+
+	// The final empty Exec flushes the buffered rows to the server
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		r.logger.Error("UserRepository.CreateBatch: %v", err)
+		return err
+	}
+
+	if err = stmt.Close(); err != nil {
+		r.logger.Error("UserRepository.CreateBatch: failed to close copy: %v", err)
+		return err
+	}
+
+	// COPY returns no IDs, the new rows are found again by their unique usernames
+	usernames := make([]string, len(users))
+	for i, user := range users {
+		usernames[i] = user.Username
+	}
+	if err = insertUserEvents(ctx, tx, entity.EventUserCreated, "usr_username = ANY($2)", pq.Array(usernames)); err != nil {
+		r.logger.Error("UserRepository.CreateBatch: failed to record events: %v", err)
 		return err
 	}
 
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UserRepository.CreateBatch: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
+// FindByUsernamesOrEmails matches case-insensitively, pass identifiers already normalized
+func (r *userRepository) FindByUsernamesOrEmails(ctx context.Context, usernames []string, emails []string) ([]*entity.User, error) {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("UserRepository.FindByUsernamesOrEmails: failed to start transaction: %v", err)
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	users := []*entity.User{}
+	query := `SELECT * FROM users WHERE lower(usr_username) = ANY($1) OR lower(usr_email) = ANY($2)`
+
+	err = tx.SelectContext(ctx, &users, query, pq.Array(usernames), pq.Array(emails))
+	if err != nil {
+		r.logger.Error("UserRepository.FindByUsernamesOrEmails: %v", err)
+		return nil, err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UserRepository.FindByUsernamesOrEmails: failed to commit transaction: %v", err)
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
 func (r *userRepository) GetByID(ctx context.Context, id int64) (*entity.User, error) {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
@@ -143,7 +269,20 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (*entity.User, e
 	return user, nil
 }
 
-func (r *userRepository) List(ctx context.Context, query *model.PaginationQuery) ([]*entity.User, int64, error) {
+// GetByIDs returns the users with the given IDs in no particular order, IDs
+// without a user or whose user is deleted are simply absent
+func (r *userRepository) GetByIDs(ctx context.Context, ids []int64) ([]*entity.User, error) {
+	users := []*entity.User{}
+	query := `SELECT * FROM users WHERE usr_id = ANY($1) AND usr_deleted_at IS NULL`
+
+	if err := r.db.SelectContext(ctx, &users, query, pq.Array(ids)); err != nil {
+		r.logger.Error("UserRepository.GetByIDs: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *userRepository) List(ctx context.Context, query *model.PaginationQuery, filter *model.UserFilter) ([]*entity.User, int64, error) {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		r.logger.Error("UserRepository.List: failed to start transaction: %v", err)
@@ -156,9 +295,22 @@ func (r *userRepository) List(ctx context.Context, query *model.PaginationQuery)
 		}
 	}()
 
+	args := queryArgs{}
+	where := buildUserWhere(filter, &args)
+
+	var sort []model.SortField
+	if filter != nil {
+		sort = filter.Sort
+	}
+	orderBy, err := buildUserOrderBy(sort)
+	if err != nil {
+		r.logger.Error("UserRepository.List: %v", err)
+		return nil, 0, err
+	}
+
 	var total int64
-	countQuery := `SELECT COUNT(*) FROM users WHERE usr_deleted_at IS NULL`
-	err = tx.Get(&total, countQuery)
+	countQuery := `SELECT COUNT(*) FROM users ` + where
+	err = tx.Get(&total, countQuery, args...)
 	if err != nil {
 		r.logger.Error("UserRepository.List: %v", err)
 		return nil, 0, err
@@ -168,22 +320,217 @@ func (r *userRepository) List(ctx context.Context, query *model.PaginationQuery)
 	users := []*entity.User{}
 	listQuery := fmt.Sprintf(`
 		SELECT * FROM users
-		WHERE usr_deleted_at IS NULL
-		ORDER BY usr_created_at DESC
-		LIMIT %d OFFSET %d
-	`, query.Limit, query.Offset)
+		%s
+		%s
+		LIMIT %s OFFSET %s
+	`, where, orderBy, args.add(query.Limit), args.add(query.Offset))
 
-	err = tx.Select(&users, listQuery)
+	err = tx.Select(&users, listQuery, args...)
 	if err != nil {
+		r.logger.Error("UserRepository.List: %v", err)
 		return nil, 0, err
 	}
 	r.logger.Info("UserRepository.List: executed query: %v", listQuery)
 
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("UserRepository.List: failed to commit transaction: %v", err)
+		return nil, 0, err
+	}
+
 	return users, total, nil
 }
 
-func (r *userRepository) Update(ctx context.Context, user *entity.User) error {
+// ListByCursor returns up to limit+1 users after (or, for backward cursors, before) the
+// cursor position in sort order, so callers can tell whether another page exists.
+// Rows are always returned in sort order.
+func (r *userRepository) ListByCursor(ctx context.Context, filter *model.UserFilter, cursor *model.Cursor, sort model.SortField, limit int, withTotal bool) ([]*entity.User, *int64, error) {
 	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("UserRepository.ListByCursor: failed to start transaction: %v", err)
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	column, ok := userSortColumns[sort.Field]
+	if !ok {
+		err = fmt.Errorf("unsupported sort field: %s", sort.Field)
+		r.logger.Error("UserRepository.ListByCursor: %v", err)
+		return nil, nil, err
+	}
+
+	args := queryArgs{}
+	where := buildUserWhere(filter, &args)
+
+	var total *int64
+	if withTotal {
+		var count int64
+		err = tx.Get(&count, `SELECT COUNT(*) FROM users `+where, args...)
+		if err != nil {
+			r.logger.Error("UserRepository.ListByCursor: %v", err)
+			return nil, nil, err
+		}
+		total = &count
+	}
+
+	// Reading backwards means walking the index in the opposite direction
+	backward := cursor != nil && cursor.Backward
+	readDesc := sort.Desc != backward
+	direction, operator := "ASC", ">"
+	if readDesc {
+		direction, operator = "DESC", "<"
+	}
+
+	if cursor != nil {
+		var value any
+		value, err = cursorValue(sort.Field, cursor)
+		if err != nil {
+			r.logger.Warning("UserRepository.ListByCursor: %v", err)
+			return nil, nil, err
+		}
+		where = appendCondition(where, fmt.Sprintf("(%s, usr_id) %s (%s, %s)", column, operator, args.add(value), args.add(cursor.ID)))
+	}
+
+	users := []*entity.User{}
+	listQuery := fmt.Sprintf(`
+		SELECT * FROM users
+		%s
+		ORDER BY %s %s, usr_id %s
+		LIMIT %s
+	`, where, column, direction, direction, args.add(limit+1))
+
+	err = tx.Select(&users, listQuery, args...)
+	if err != nil {
+		r.logger.Error("UserRepository.ListByCursor: %v", err)
+		return nil, nil, err
+	}
+	r.logger.Info("UserRepository.ListByCursor: executed query: %v", listQuery)
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("UserRepository.ListByCursor: failed to commit transaction: %v", err)
+		return nil, nil, err
+	}
+
+	if backward {
+		slices.Reverse(users)
+	}
+
+	return users, total, nil
+}
+
+func (r *userRepository) Search(ctx context.Context, term string, limit int) ([]*entity.UserSearchResult, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("UserRepository.Search: failed to start transaction: %v", err)
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Full-text prefix matches find partial names, trigram word similarity
+	// catches typos. Both contribute to the rank.
+	query := fmt.Sprintf(`
+		SELECT users.*,
+			ts_rank(%[1]s, search.query) + GREATEST(
+				word_similarity(search.term, usr_username),
+				word_similarity(search.term, usr_display_name),
+				word_similarity(search.term, usr_email)
+			) AS search_rank,
+			ts_headline('simple', %[2]s, search.query, $3) AS search_username_highlight,
+			ts_headline('simple', %[3]s, search.query, $3) AS search_display_name_highlight
+		FROM users, (SELECT to_tsquery('simple', $1) AS query, $2::text AS term) AS search
+		WHERE usr_deleted_at IS NULL
+			AND (%[1]s @@ search.query
+				OR search.term <%% usr_username
+				OR search.term <%% usr_display_name
+				OR search.term <%% usr_email)
+		ORDER BY search_rank DESC, usr_id ASC
+		LIMIT $4
+	`, userSearchDocument, searchHighlightSource("usr_username"), searchHighlightSource("usr_display_name"))
+
+	results := []*entity.UserSearchResult{}
+	err = tx.Select(&results, query, prefixTSQuery(term), term, searchHighlightOptions, limit)
+	if err != nil {
+		r.logger.Error("UserRepository.Search: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("UserRepository.Search: failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	for _, result := range results {
+		result.UsernameHighlight = renderSearchHighlight(result.UsernameHighlight)
+		result.DisplayNameHighlight = renderSearchHighlight(result.DisplayNameHighlight)
+	}
+
+	return results, nil
+}
+
+// Stream calls fn for every user matching filter, one row at a time as they are
+// read off the connection, so memory use does not grow with the table.
+func (r *userRepository) Stream(ctx context.Context, filter *model.UserFilter, fn func(user *entity.User) error) error {
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		r.logger.Error("UserRepository.Stream: failed to start transaction: %v", err)
+		return err
+	}
+
+	// Nothing is written, so the transaction is always rolled back
+	defer tx.Rollback()
+
+	args := queryArgs{}
+	where := buildUserWhere(filter, &args)
+
+	var sort []model.SortField
+	if filter != nil {
+		sort = filter.Sort
+	}
+	orderBy, err := buildUserOrderBy(sort)
+	if err != nil {
+		r.logger.Error("UserRepository.Stream: %v", err)
+		return err
+	}
+
+	query := `SELECT * FROM users ` + where + ` ` + orderBy
+	rows, err := tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Error("UserRepository.Stream: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := &entity.User{}
+		if err := rows.StructScan(user); err != nil {
+			r.logger.Error("UserRepository.Stream: %v", err)
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserRepository.Stream: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Update joins the transaction carried by ctx, if any, so related writes can commit with it
+func (r *userRepository) Update(ctx context.Context, user *entity.User) error {
+	tx, owned, err := beginTx(ctx, r.db)
 	if err != nil {
 		r.logger.Error("UserRepository.Update: failed to start transaction: %v", err)
 		return err
@@ -192,62 +539,142 @@ func (r *userRepository) Update(ctx context.Context, user *entity.User) error {
 	// Ensure rollback on failure
 	defer func() {
 		if p := recover(); p != nil {
-			tx.Rollback()
+			if owned {
+				tx.Rollback()
+			}
 			panic(p)
 		}
 	}()
 
+	// Compare-and-swap on usr_version so a writer holding a stale copy cannot
+	// overwrite changes it has not seen
 	query := `
 		UPDATE users
-		SET usr_username = $1, usr_email = $2, usr_updated_at = NOW()
-		WHERE usr_id = $3
-		RETURNING usr_updated_at
+		SET usr_username = $1, usr_email = $2, usr_display_name = $3, usr_bio = $4,
+			usr_locale = $5, usr_timezone = $6, usr_avatar_url = $7, usr_attributes = $8, usr_updated_at = NOW(),
+			usr_version = usr_version + 1
+		WHERE usr_id = $9 AND usr_version = $10
+		RETURNING usr_updated_at, usr_version
 	`
 
-	err = tx.QueryRowx(query, user.Username, user.Email, user.ID).Scan(&user.UpdatedAt)
+	err = tx.QueryRowx(
+		query,
+		user.Username,
+		user.Email,
+		user.DisplayName,
+		user.Bio,
+		user.Locale,
+		user.Timezone,
+		user.AvatarURL,
+		attributesValue(user.Attributes),
+		user.ID,
+		user.Version,
+	).Scan(&user.UpdatedAt, &user.Version)
 	if err != nil {
-		tx.Rollback()                                                  // Explicitly rollback on error
+		if owned {
+			tx.Rollback() // Explicitly rollback on error
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			r.logger.Warning("UserRepository.Update: version %d of user %d is stale", user.Version, user.ID)
+			return ErrVersionConflict
+		}
 		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" { // Unique violation
-			r.logger.Warning("UserRepository.Update: email already exists: %v", user.Email)
-			return errors.New("email already in use")
+			r.logger.Warning("UserRepository.Update: username or email of user %d already in use", user.ID)
+			return ErrUserExists
 		}
 		r.logger.Error("UserRepository.Update: %v", err)
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		r.logger.Error("UserRepository.Update: failed to commit transaction: %v", err)
+	if err := insertUserEvents(ctx, tx, entity.EventUserUpdated, "usr_id = $2", user.ID); err != nil {
+		if owned {
+			tx.Rollback()
+		}
+		r.logger.Error("UserRepository.Update: failed to record event: %v", err)
 		return err
 	}
 
+	if owned {
+		if err := tx.Commit(); err != nil {
+			r.logger.Error("UserRepository.Update: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *userRepository) UpdateAvatar(ctx context.Context, id int64, avatarURL string, avatarKey *string) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("UserRepository.UpdateAvatar: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE users
+		SET usr_avatar_url = $1, usr_avatar_key = $2, usr_updated_at = NOW(), usr_version = usr_version + 1
+		WHERE usr_id = $3 AND usr_deleted_at IS NULL
+	`
+	_, err = tx.Exec(query, avatarURL, avatarKey, id)
+	if err != nil {
+		r.logger.Error("UserRepository.UpdateAvatar: %v", err)
+		return err
+	}
+
+	if err = insertUserEvents(ctx, tx, entity.EventUserUpdated, "usr_id = $2 AND usr_deleted_at IS NULL", id); err != nil {
+		r.logger.Error("UserRepository.UpdateAvatar: failed to record event: %v", err)
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UserRepository.UpdateAvatar: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (r *userRepository) SoftDelete(ctx context.Context, id int64) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, owned, err := beginTx(ctx, r.db)
 	if err != nil {
 		r.logger.Error("UserRepository.SoftDelete: failed to start transaction: %v", err)
 		return err
 	}
 
 	defer func() {
-		if err != nil {
+		if err != nil && owned {
 			tx.Rollback()
 		}
 	}()
 
-	query := `UPDATE users SET usr_deleted_at = NOW() WHERE usr_id = $1`
+	query := `UPDATE users SET usr_deleted_at = NOW(), usr_version = usr_version + 1 WHERE usr_id = $1`
 	_, err = tx.Exec(query, id)
 	if err != nil {
 		r.logger.Error("UserRepository.SoftDelete: %v", err)
 		return err
 	}
-	r.logger.Info("UserRepository.SoftDelete: executed query: %v", query)
 
-	if err := tx.Commit(); err != nil {
-		r.logger.Error("UserRepository.SoftDelete: failed to commit transaction: %v", err)
+	if err = insertUserEvents(ctx, tx, entity.EventUserDeleted, "usr_id = $2", id); err != nil {
+		r.logger.Error("UserRepository.SoftDelete: failed to record event: %v", err)
 		return err
 	}
+	r.logger.Info("UserRepository.SoftDelete: executed query: %v", query)
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UserRepository.SoftDelete: failed to commit transaction: %v", err)
+			return err
+		}
+	}
 
 	return err
 }
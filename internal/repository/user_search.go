@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// userSearchDocument must stay in sync with idx_users_search_document so the index is used
+const userSearchDocument = `to_tsvector('simple', usr_username || ' ' || usr_display_name || ' ' || usr_email)`
+
+// ts_headline marks matches with control characters rather than markup, the
+// text around them is user input and is escaped before <mark> tags are added
+const (
+	searchHighlightStart   = "\x02"
+	searchHighlightStop    = "\x03"
+	searchHighlightOptions = "StartSel=" + searchHighlightStart + ", StopSel=" + searchHighlightStop + ", HighlightAll=true"
+)
+
+// searchHighlightSource strips the delimiters from a column, so text containing
+// them cannot fake a match
+func searchHighlightSource(column string) string {
+	return "translate(" + column + ", E'\\x02\\x03', '')"
+}
+
+// renderSearchHighlight HTML-escapes a ts_headline result and wraps the matches
+// in <mark> tags
+func renderSearchHighlight(headline string) string {
+	var b strings.Builder
+	for headline != "" {
+		start := strings.Index(headline, searchHighlightStart)
+		if start < 0 {
+			b.WriteString(html.EscapeString(headline))
+			break
+		}
+		b.WriteString(html.EscapeString(headline[:start]))
+		headline = headline[start+len(searchHighlightStart):]
+
+		stop := strings.Index(headline, searchHighlightStop)
+		if stop < 0 {
+			stop = len(headline)
+		}
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(headline[:stop]))
+		b.WriteString("</mark>")
+		headline = strings.TrimPrefix(headline[stop:], searchHighlightStop)
+	}
+	return b.String()
+}
+
+// prefixTSQuery turns free text into a to_tsquery expression matching every word as a
+// prefix, e.g. "jo smi" becomes "jo:* & smi:*". Operators in the input are dropped so
+// it can never produce a tsquery syntax error.
+func prefixTSQuery(term string) string {
+	words := strings.FieldsFunc(strings.ToLower(term), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = word + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
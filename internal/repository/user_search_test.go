@@ -0,0 +1,49 @@
+package repository
+
+import "testing"
+
+func TestRenderSearchHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{name: "no match", headline: "john", want: "john"},
+		{name: "match", headline: "\x02jo\x03hn smith", want: "<mark>jo</mark>hn smith"},
+		{name: "several matches", headline: "\x02john\x03 \x02smi\x03th", want: "<mark>john</mark> <mark>smi</mark>th"},
+		{
+			name:     "markup around a match is escaped",
+			headline: "<img src=x onerror=\"alert(1)\"> \x02jo\x03",
+			want:     `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>jo</mark>`,
+		},
+		{name: "markup inside a match is escaped", headline: "\x02<b>\x03", want: "<mark>&lt;b&gt;</mark>"},
+		{name: "unterminated match is closed", headline: "a \x02b", want: "a <mark>b</mark>"},
+		{name: "empty", headline: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderSearchHighlight(tt.headline); got != tt.want {
+				t.Errorf("renderSearchHighlight(%q) = %q, want %q", tt.headline, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixTSQuery(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{term: "jo smi", want: "jo:* & smi:*"},
+		{term: "John", want: "john:*"},
+		{term: "a & b | !c", want: "a:* & b:* & c:*"},
+		{term: "  ", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := prefixTSQuery(tt.term); got != tt.want {
+			t.Errorf("prefixTSQuery(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrStatusConflict means the user's status changed since it was read
+var ErrStatusConflict = errors.New("user status changed concurrently")
+
+type UserStatusRepository interface {
+	Transition(ctx context.Context, transition *entity.UserStatusTransition) error
+	ListByUser(ctx context.Context, userID int64) ([]*entity.UserStatusTransition, error)
+}
+
+type userStatusRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewUserStatusRepository(db *sqlx.DB, logger *utils.Logger) UserStatusRepository {
+	return &userStatusRepository{db: db, logger: logger}
+}
+
+// Transition moves the user from transition.FromStatus to transition.ToStatus and
+// records the change, both or neither. The user must still be in FromStatus.
+func (r *userStatusRepository) Transition(ctx context.Context, transition *entity.UserStatusTransition) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("UserStatusRepository.Transition: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE users SET usr_status = $1, usr_updated_at = NOW(), usr_version = usr_version + 1
+		WHERE usr_id = $2 AND usr_status = $3 AND usr_deleted_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, query, transition.ToStatus, transition.UserID, transition.FromStatus)
+	if err != nil {
+		r.logger.Error("UserStatusRepository.Transition: failed to update user status: %v", err)
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		err = ErrStatusConflict
+		return err
+	}
+
+	if err = insertUserEvents(ctx, tx, entity.EventUserUpdated, "usr_id = $2", transition.UserID); err != nil {
+		r.logger.Error("UserStatusRepository.Transition: failed to record event: %v", err)
+		return err
+	}
+
+	query = `
+		INSERT INTO user_status_transitions (ust_usr_id, ust_from_status, ust_to_status, ust_reason, ust_actor_id, ust_created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING ust_id, ust_created_at
+	`
+	err = tx.QueryRowxContext(ctx, query, transition.UserID, transition.FromStatus, transition.ToStatus,
+		transition.Reason, transition.ActorID).Scan(&transition.ID, &transition.CreatedAt)
+	if err != nil {
+		r.logger.Error("UserStatusRepository.Transition: failed to record transition: %v", err)
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UserStatusRepository.Transition: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *userStatusRepository) ListByUser(ctx context.Context, userID int64) ([]*entity.UserStatusTransition, error) {
+	transitions := []*entity.UserStatusTransition{}
+	query := `SELECT * FROM user_status_transitions WHERE ust_usr_id = $1 ORDER BY ust_created_at DESC, ust_id DESC`
+
+	if err := r.db.SelectContext(ctx, &transitions, query, userID); err != nil {
+		r.logger.Error("UserStatusRepository.ListByUser: %v", err)
+		return nil, err
+	}
+	return transitions, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type UsernameHistoryRepository interface {
+	Create(ctx context.Context, entry *entity.UsernameHistory) error
+	FindHolds(ctx context.Context, usernames []string) ([]*entity.UsernameHistory, error)
+	GetLatestByUsername(ctx context.Context, username string) (*entity.UsernameHistory, error)
+	ListByUser(ctx context.Context, userID int64) ([]*entity.UsernameHistory, error)
+}
+
+type usernameHistoryRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewUsernameHistoryRepository(db *sqlx.DB, logger *utils.Logger) UsernameHistoryRepository {
+	return &usernameHistoryRepository{db: db, logger: logger}
+}
+
+// Create joins the transaction carried by ctx, if any, so the entry commits with the rename
+func (r *usernameHistoryRepository) Create(ctx context.Context, entry *entity.UsernameHistory) error {
+	tx, owned, err := beginTx(ctx, r.db)
+	if err != nil {
+		r.logger.Error("UsernameHistoryRepository.Create: failed to start transaction: %v", err)
+		return err
+	}
+
+	defer func() {
+		if err != nil && owned {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO user_username_history (unh_usr_id, unh_username, unh_changed_at, unh_released_until)
+		VALUES ($1, $2, NOW(), $3) RETURNING unh_id, unh_changed_at
+	`
+	err = tx.QueryRowxContext(ctx, query, entry.UserID, entry.Username, entry.ReleasedUntil).Scan(&entry.ID, &entry.ChangedAt)
+	if err != nil {
+		r.logger.Error("UsernameHistoryRepository.Create: %v", err)
+		return err
+	}
+
+	if owned {
+		if err = tx.Commit(); err != nil {
+			r.logger.Error("UsernameHistoryRepository.Create: failed to commit transaction: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindHolds returns the entries still holding any of the given normalized usernames
+func (r *usernameHistoryRepository) FindHolds(ctx context.Context, usernames []string) ([]*entity.UsernameHistory, error) {
+	holds := []*entity.UsernameHistory{}
+	query := `SELECT * FROM user_username_history WHERE lower(unh_username) = ANY($1) AND unh_released_until > NOW()`
+
+	if err := r.db.SelectContext(ctx, &holds, query, pq.Array(usernames)); err != nil {
+		r.logger.Error("UsernameHistoryRepository.FindHolds: %v", err)
+		return nil, err
+	}
+	return holds, nil
+}
+
+// GetLatestByUsername returns the most recent user to give up username, or nil if nobody has
+func (r *usernameHistoryRepository) GetLatestByUsername(ctx context.Context, username string) (*entity.UsernameHistory, error) {
+	entry := &entity.UsernameHistory{}
+	query := `
+		SELECT * FROM user_username_history WHERE lower(unh_username) = lower($1)
+		ORDER BY unh_changed_at DESC LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, entry, query, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.Error("UsernameHistoryRepository.GetLatestByUsername: %v", err)
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *usernameHistoryRepository) ListByUser(ctx context.Context, userID int64) ([]*entity.UsernameHistory, error) {
+	entries := []*entity.UsernameHistory{}
+	query := `SELECT * FROM user_username_history WHERE unh_usr_id = $1 ORDER BY unh_changed_at DESC`
+
+	if err := r.db.SelectContext(ctx, &entries, query, userID); err != nil {
+		r.logger.Error("UsernameHistoryRepository.ListByUser: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
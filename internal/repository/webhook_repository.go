@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrWebhookDeliveryInFlight means a delivery is claimed by a worker or waiting for its next attempt
+	ErrWebhookDeliveryInFlight = errors.New("webhook delivery is in flight")
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *entity.WebhookSubscription) error
+	GetByID(ctx context.Context, id int64) (*entity.WebhookSubscription, error)
+	List(ctx context.Context) ([]*entity.WebhookSubscription, error)
+	Update(ctx context.Context, webhook *entity.WebhookSubscription) error
+	Delete(ctx context.Context, id int64) error
+
+	// EnqueueEvent adds a pending delivery of an event for every active
+	// subscription wanting its type. Enqueueing the same event again is a no-op.
+	EnqueueEvent(ctx context.Context, eventID int64, eventType string, payload types.JSONText) (int64, error)
+	// ClaimDue leases up to limit pending deliveries of active subscriptions
+	// that are due, counting the attempt
+	ClaimDue(ctx context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.WebhookDelivery, error)
+	MarkSucceeded(ctx context.Context, delivery *entity.WebhookDelivery, responseStatus int, now time.Time) error
+	// MarkFailed records a failed attempt and retries at retryAt, or gives up
+	// when retryAt is nil. The subscription is disabled once it has failed
+	// disableAfter times in a row, the returned bool reports whether this did it.
+	MarkFailed(ctx context.Context, delivery *entity.WebhookDelivery, retryAt *time.Time, responseStatus *int, lastError string, disableAfter int, now time.Time) (bool, error)
+	ListDeliveries(ctx context.Context, webhookID int64, status string, query *model.PaginationQuery) ([]*entity.WebhookDelivery, int64, error)
+	// Redeliver queues a finished or due delivery to be sent again right away.
+	// A pending delivery whose next attempt is still ahead may be in a worker's
+	// hands, it is left alone with ErrWebhookDeliveryInFlight.
+	Redeliver(ctx context.Context, webhookID int64, deliveryID int64, now time.Time) (*entity.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db     *sqlx.DB
+	logger *utils.Logger
+}
+
+func NewWebhookRepository(db *sqlx.DB, logger *utils.Logger) WebhookRepository {
+	return &webhookRepository{db: db, logger: logger}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *entity.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (whk_url, whk_secret, whk_events, whk_active, whk_created_by, whk_created_at, whk_updated_at)
+		VALUES ($1, $2, $3, TRUE, $4, NOW(), NOW())
+		RETURNING whk_id, whk_active, whk_created_at, whk_updated_at
+	`
+	err := r.db.QueryRowxContext(ctx, query, webhook.URL, webhook.Secret, webhook.Events, webhook.CreatedBy).
+		Scan(&webhook.ID, &webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		r.logger.Error("WebhookRepository.Create: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, id int64) (*entity.WebhookSubscription, error) {
+	webhook := &entity.WebhookSubscription{}
+	err := r.db.GetContext(ctx, webhook, `SELECT * FROM webhook_subscriptions WHERE whk_id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		r.logger.Error("WebhookRepository.GetByID: %v", err)
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepository) List(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	webhooks := []*entity.WebhookSubscription{}
+	if err := r.db.SelectContext(ctx, &webhooks, `SELECT * FROM webhook_subscriptions ORDER BY whk_id`); err != nil {
+		r.logger.Error("WebhookRepository.List: %v", err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepository) Update(ctx context.Context, webhook *entity.WebhookSubscription) error {
+	query := `
+		UPDATE webhook_subscriptions
+		SET whk_url = $1, whk_secret = $2, whk_events = $3, whk_active = $4, whk_consecutive_failures = $5,
+			whk_disabled_at = $6, whk_disabled_reason = $7, whk_updated_at = NOW()
+		WHERE whk_id = $8
+		RETURNING whk_updated_at
+	`
+	err := r.db.QueryRowxContext(ctx, query, webhook.URL, webhook.Secret, webhook.Events, webhook.Active,
+		webhook.ConsecutiveFailures, webhook.DisabledAt, webhook.DisabledReason, webhook.ID).Scan(&webhook.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		r.logger.Error("WebhookRepository.Update: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE whk_id = $1`, id)
+	if err != nil {
+		r.logger.Error("WebhookRepository.Delete: %v", err)
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepository) EnqueueEvent(ctx context.Context, eventID int64, eventType string, payload types.JSONText) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (wdl_whk_id, wdl_event_id, wdl_event_type, wdl_payload)
+		SELECT whk_id, $1, $2, $3 FROM webhook_subscriptions
+		WHERE whk_active AND (cardinality(whk_events) = 0 OR $2 = ANY(whk_events))
+		ON CONFLICT (wdl_whk_id, wdl_event_id) DO NOTHING
+	`
+	result, err := r.db.ExecContext(ctx, query, eventID, eventType, payload)
+	if err != nil {
+		r.logger.Error("WebhookRepository.EnqueueEvent: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *webhookRepository) ClaimDue(ctx context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries SET wdl_next_attempt_at = $3, wdl_attempts = wdl_attempts + 1
+		WHERE wdl_id IN (
+			SELECT d.wdl_id FROM webhook_deliveries d
+			JOIN webhook_subscriptions s ON s.whk_id = d.wdl_whk_id
+			WHERE d.wdl_status = 'pending' AND d.wdl_next_attempt_at <= $2 AND s.whk_active
+			ORDER BY d.wdl_next_attempt_at, d.wdl_id
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	deliveries := []*entity.WebhookDelivery{}
+	if err := r.db.SelectContext(ctx, &deliveries, query, limit, now, leaseUntil); err != nil {
+		r.logger.Error("WebhookRepository.ClaimDue: %v", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepository) MarkSucceeded(ctx context.Context, delivery *entity.WebhookDelivery, responseStatus int, now time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("WebhookRepository.MarkSucceeded: failed to start transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET wdl_status = $1, wdl_response_status = $2, wdl_last_error = NULL, wdl_delivered_at = $3
+		WHERE wdl_id = $4
+	`
+	if _, err := tx.ExecContext(ctx, query, entity.WebhookDeliverySucceeded, responseStatus, now, delivery.ID); err != nil {
+		r.logger.Error("WebhookRepository.MarkSucceeded: %v", err)
+		return err
+	}
+
+	query = `UPDATE webhook_subscriptions SET whk_consecutive_failures = 0 WHERE whk_id = $1 AND whk_consecutive_failures > 0`
+	if _, err := tx.ExecContext(ctx, query, delivery.WebhookID); err != nil {
+		r.logger.Error("WebhookRepository.MarkSucceeded: failed to reset failures: %v", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("WebhookRepository.MarkSucceeded: failed to commit transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *webhookRepository) MarkFailed(ctx context.Context, delivery *entity.WebhookDelivery, retryAt *time.Time, responseStatus *int, lastError string, disableAfter int, now time.Time) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Error("WebhookRepository.MarkFailed: failed to start transaction: %v", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	status := entity.WebhookDeliveryPending
+	if retryAt == nil {
+		status = entity.WebhookDeliveryFailed
+	}
+	query := `
+		UPDATE webhook_deliveries
+		SET wdl_status = $1, wdl_next_attempt_at = COALESCE($2, wdl_next_attempt_at), wdl_response_status = $3, wdl_last_error = $4
+		WHERE wdl_id = $5
+	`
+	if _, err := tx.ExecContext(ctx, query, status, retryAt, responseStatus, lastError, delivery.ID); err != nil {
+		r.logger.Error("WebhookRepository.MarkFailed: %v", err)
+		return false, err
+	}
+
+	var failures int
+	var active bool
+	query = `
+		UPDATE webhook_subscriptions SET whk_consecutive_failures = whk_consecutive_failures + 1
+		WHERE whk_id = $1
+		RETURNING whk_consecutive_failures, whk_active
+	`
+	if err := tx.QueryRowxContext(ctx, query, delivery.WebhookID).Scan(&failures, &active); err != nil {
+		r.logger.Error("WebhookRepository.MarkFailed: failed to count failure: %v", err)
+		return false, err
+	}
+
+	disabled := active && disableAfter > 0 && failures >= disableAfter
+	if disabled {
+		query = `
+			UPDATE webhook_subscriptions
+			SET whk_active = FALSE, whk_disabled_at = $1, whk_disabled_reason = $2, whk_updated_at = NOW()
+			WHERE whk_id = $3
+		`
+		if _, err := tx.ExecContext(ctx, query, now, lastError, delivery.WebhookID); err != nil {
+			r.logger.Error("WebhookRepository.MarkFailed: failed to disable webhook: %v", err)
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("WebhookRepository.MarkFailed: failed to commit transaction: %v", err)
+		return false, err
+	}
+	return disabled, nil
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, webhookID int64, status string, query *model.PaginationQuery) ([]*entity.WebhookDelivery, int64, error) {
+	args := queryArgs{}
+	where := "WHERE wdl_whk_id = " + args.add(webhookID)
+	if status != "" {
+		where = appendCondition(where, "wdl_status = "+args.add(status))
+	}
+
+	var total int64
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM webhook_deliveries `+where, args...); err != nil {
+		r.logger.Error("WebhookRepository.ListDeliveries: %v", err)
+		return nil, 0, err
+	}
+
+	deliveries := []*entity.WebhookDelivery{}
+	listQuery := `SELECT * FROM webhook_deliveries ` + where +
+		` ORDER BY wdl_created_at DESC, wdl_id DESC LIMIT ` + args.add(query.Limit) + ` OFFSET ` + args.add(query.Offset)
+	if err := r.db.SelectContext(ctx, &deliveries, listQuery, args...); err != nil {
+		r.logger.Error("WebhookRepository.ListDeliveries: %v", err)
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (r *webhookRepository) Redeliver(ctx context.Context, webhookID int64, deliveryID int64, now time.Time) (*entity.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET wdl_status = $1, wdl_attempts = 0, wdl_next_attempt_at = $2, wdl_last_error = NULL
+		WHERE wdl_id = $3 AND wdl_whk_id = $4 AND NOT (wdl_status = $1 AND wdl_next_attempt_at > $2)
+		RETURNING *
+	`
+	delivery := &entity.WebhookDelivery{}
+	err := r.db.GetContext(ctx, delivery, query, entity.WebhookDeliveryPending, now, deliveryID, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		query = `SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE wdl_id = $1 AND wdl_whk_id = $2)`
+		if err := r.db.GetContext(ctx, &exists, query, deliveryID, webhookID); err != nil {
+			r.logger.Error("WebhookRepository.Redeliver: %v", err)
+			return nil, err
+		}
+		if exists {
+			return nil, ErrWebhookDeliveryInFlight
+		}
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		r.logger.Error("WebhookRepository.Redeliver: %v", err)
+		return nil, err
+	}
+	return delivery, nil
+}
@@ -1,43 +1,276 @@
 package router
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/config"
+	"github.com/Rafli-Dewanto/go-template/internal/events"
 	"github.com/Rafli-Dewanto/go-template/internal/handler"
+	"github.com/Rafli-Dewanto/go-template/internal/mailer"
+	customMiddleware "github.com/Rafli-Dewanto/go-template/internal/middleware"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
 	"github.com/Rafli-Dewanto/go-template/internal/repository"
 	"github.com/Rafli-Dewanto/go-template/internal/service"
+	"github.com/Rafli-Dewanto/go-template/internal/storage"
 	"github.com/Rafli-Dewanto/go-template/internal/utils"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	customMiddleware "github.com/Rafli-Dewanto/go-template/internal/middleware"
 	"github.com/jmoiron/sqlx"
 )
 
 type Router struct {
-	userHandler *handler.UserHandler
+	userHandler        *handler.UserHandler
+	authHandler        *handler.AuthHandler
+	dataExportHandler  *handler.DataExportHandler
+	avatarHandler      *handler.AvatarHandler
+	userImportHandler  *handler.UserImportHandler
+	emailChangeHandler *handler.EmailChangeHandler
+	dataExportService  service.DataExportService
+	exportConfig       config.ExportConfig
+	userStatusHandler  *handler.UserStatusHandler
+	userStatusService  service.UserStatusService
+	loginEventHandler  *handler.LoginEventHandler
+	auditLogHandler    *handler.AuditLogHandler
+	webhookHandler     *handler.WebhookHandler
+	webhookService     service.WebhookService
+	webhookConfig      config.WebhookConfig
+	userEventsHandler  *handler.UserEventsHandler
+	eventBroker        *events.Broker
+	userChangeFeed     *events.UserChangeFeed
+	loadOutboxEvent    func(ctx context.Context, id int64) (events.Event, error)
+	loginEventService  service.LoginEventService
+	loginEventConfig   config.LoginEventConfig
+	idempotency        service.IdempotencyService
+	idempotencyConfig  config.IdempotencyConfig
+	outboxRelay        service.OutboxRelay
+	outboxConfig       config.OutboxConfig
+	logger             *utils.Logger
+	tokenManager       *auth.TokenManager
+	accessPolicy       *auth.AccessPolicy
+	expanders          map[string]handler.Expander
+	cache              config.CacheConfig
+	serveBlobs         bool
 }
 
-func NewRouter(db *sqlx.DB) *Router {
+func NewRouter(db *sqlx.DB, dbConfig *config.DatabaseConfig, appConfig *config.AppConfig) *Router {
 	// logger
 	logger, err := utils.NewLogger("files/log/app.log")
 	if err != nil {
 		panic(err)
 	}
 
+	// Auth
+	tokenManager := auth.NewTokenManager(appConfig.Auth.SecretKey)
+	accessPolicy := auth.NewAccessPolicy(appConfig.Auth.AdminUserIDs)
+
+	// Blob storage
+	blobStore, err := newBlobStore(appConfig.Storage)
+	if err != nil {
+		panic(err)
+	}
+
+	// Custom user attributes
+	attributeSchema, err := utils.LoadJSONSchema(appConfig.Attributes.SchemaFile)
+	if err != nil {
+		panic(err)
+	}
+
 	// Initialize repositories
+	transactor := repository.NewTransactor(db, logger)
 	userRepo := repository.NewUserRepository(db, logger)
+	dataExportRepo := repository.NewDataExportRepository(db, logger)
+	emailChangeRepo := repository.NewEmailChangeRepository(db, logger)
+	usernameHistoryRepo := repository.NewUsernameHistoryRepository(db, logger)
+	userStatusRepo := repository.NewUserStatusRepository(db, logger)
+	loginEventRepo := repository.NewLoginEventRepository(db, logger)
+	idempotencyRepo := repository.NewIdempotencyRepository(db, logger)
+	auditRepo := repository.NewAuditRepository(db, logger)
+	outboxRepo := repository.NewOutboxRepository(db, logger)
+	webhookRepo := repository.NewWebhookRepository(db, logger)
+
+	// Mail
+	mail := mailer.NewLogMailer(appConfig.Mail.From, logger)
 
 	// Initialize services
-	userService := service.NewUserService(userRepo, logger)
+	usernameRules := service.UsernameRules{
+		Reserved:        appConfig.Usernames.Reserved,
+		ReleaseCooldown: appConfig.Usernames.ReleaseCooldown,
+	}
+	auditService := service.NewAuditService(auditRepo, logger)
+	userService := service.NewUserService(userRepo, usernameHistoryRepo, transactor, auditService, usernameRules, appConfig.Users.SignupRequiresActivation, logger)
+	userStatusService := service.NewUserStatusService(userStatusRepo, userRepo, transactor, auditService, logger)
+	loginEventService := service.NewLoginEventService(loginEventRepo, appConfig.LoginEvents.Retention, logger)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, service.IdempotencyOptions{
+		TTL:         appConfig.Idempotency.TTL,
+		LockTimeout: appConfig.Idempotency.LockTimeout,
+		WaitTimeout: appConfig.Idempotency.WaitTimeout,
+	}, logger)
+	emailChangeService := service.NewEmailChangeService(emailChangeRepo, userRepo, transactor, auditService, mail, appConfig.Mail.LinkBaseURL, logger)
+	dataExportService := service.NewDataExportService(dataExportRepo, userRepo, blobStore, appConfig.Export.Retention, logger,
+		service.ExportSection{Name: "email_changes", Collect: func(ctx context.Context, userID int64) (any, error) {
+			return emailChangeService.ListByUser(ctx, userID)
+		}},
+		service.ExportSection{Name: "username_history", Collect: func(ctx context.Context, userID int64) (any, error) {
+			return userService.UsernameHistory(ctx, userID)
+		}},
+		service.ExportSection{Name: "status_transitions", Collect: func(ctx context.Context, userID int64) (any, error) {
+			return userStatusService.ListTransitions(ctx, userID)
+		}},
+		service.ExportSection{Name: "login_events", Collect: func(ctx context.Context, userID int64) (any, error) {
+			return loginEventService.ListByUser(ctx, userID)
+		}},
+		service.ExportSection{Name: "audit_log", Collect: func(ctx context.Context, userID int64) (any, error) {
+			return auditService.ListByUser(ctx, userID)
+		}},
+	)
+	avatarService := service.NewAvatarService(userRepo, transactor, auditService, blobStore, service.AvatarLimits{
+		MaxBytes:       appConfig.Avatar.MaxBytes,
+		MaxWidth:       appConfig.Avatar.MaxWidth,
+		MaxHeight:      appConfig.Avatar.MaxHeight,
+		ThumbnailSizes: appConfig.Avatar.ThumbnailSizes,
+	}, logger)
+	userImportService := service.NewUserImportService(userRepo, usernameHistoryRepo, transactor, auditService, usernameRules, attributeSchema, logger)
+
+	webhookService := service.NewWebhookService(webhookRepo, &http.Client{Timeout: appConfig.Webhooks.Timeout}, service.WebhookOptions{
+		BatchSize:    appConfig.Webhooks.BatchSize,
+		Lease:        appConfig.Webhooks.Lease,
+		MaxAttempts:  appConfig.Webhooks.MaxAttempts,
+		RetryBase:    appConfig.Webhooks.RetryBase,
+		RetryMax:     appConfig.Webhooks.RetryMax,
+		DisableAfter: appConfig.Webhooks.DisableAfter,
+	}, logger)
+
+	// Events recorded in the outbox go to the configured publisher and to
+	// webhooks. The event streams of every instance follow them through the user
+	// change feed instead, as the relay claiming an event may run elsewhere.
+	eventBroker := events.NewBroker(appConfig.Events.BufferSize, appConfig.Events.ClientQueueSize)
+	publisher, err := newPublisher(appConfig.Outbox, logger)
+	if err != nil {
+		panic(err)
+	}
+	outboxRelay := service.NewOutboxRelay(outboxRepo, events.NewFanoutPublisher(publisher, webhookService), service.OutboxOptions{
+		BatchSize: appConfig.Outbox.BatchSize,
+		Lease:     appConfig.Outbox.Lease,
+		RetryBase: appConfig.Outbox.RetryBase,
+		RetryMax:  appConfig.Outbox.RetryMax,
+		Retention: appConfig.Outbox.Retention,
+	}, logger)
+
+	// Writes to users and user events by any instance, for components keeping
+	// state about users
+	userChangeFeed := events.NewUserChangeFeed(dbConfig.GetDSN(), events.UserChangeFeedOptions{
+		MinReconnect: appConfig.ChangeFeed.MinReconnect,
+		MaxReconnect: appConfig.ChangeFeed.MaxReconnect,
+		PingInterval: appConfig.ChangeFeed.PingInterval,
+	}, logger)
 
 	// Initialize handlers
-	userHandler := handler.NewUserHandler(userService, logger)
+	userHandler := handler.NewUserHandler(userService, attributeSchema, accessPolicy, appConfig.Users.BatchMaxIDs, logger)
+	authHandler := handler.NewAuthHandler(userService, loginEventService, tokenManager, attributeSchema, logger)
+	dataExportHandler := handler.NewDataExportHandler(dataExportService, accessPolicy, logger)
+	avatarHandler := handler.NewAvatarHandler(avatarService, blobStore, accessPolicy, appConfig.Avatar.MaxBytes, logger)
+	userImportHandler := handler.NewUserImportHandler(userImportService, logger)
+	emailChangeHandler := handler.NewEmailChangeHandler(emailChangeService, accessPolicy, logger)
+	userStatusHandler := handler.NewUserStatusHandler(userStatusService, userService, logger)
+	loginEventHandler := handler.NewLoginEventHandler(loginEventService, accessPolicy, logger)
+	auditLogHandler := handler.NewAuditLogHandler(auditService, logger)
+	webhookHandler := handler.NewWebhookHandler(webhookService, logger)
+	userEventsHandler := handler.NewUserEventsHandler(eventBroker, appConfig.Events.Heartbeat, logger)
 
 	return &Router{
-		userHandler: userHandler,
+		userHandler:        userHandler,
+		authHandler:        authHandler,
+		dataExportHandler:  dataExportHandler,
+		avatarHandler:      avatarHandler,
+		userImportHandler:  userImportHandler,
+		emailChangeHandler: emailChangeHandler,
+		dataExportService:  dataExportService,
+		exportConfig:       appConfig.Export,
+		userStatusHandler:  userStatusHandler,
+		userStatusService:  userStatusService,
+		loginEventHandler:  loginEventHandler,
+		auditLogHandler:    auditLogHandler,
+		webhookHandler:     webhookHandler,
+		webhookService:     webhookService,
+		webhookConfig:      appConfig.Webhooks,
+		userEventsHandler:  userEventsHandler,
+		eventBroker:        eventBroker,
+		userChangeFeed:     userChangeFeed,
+		loadOutboxEvent:    service.LoadOutboxEvent(outboxRepo),
+		loginEventService:  loginEventService,
+		loginEventConfig:   appConfig.LoginEvents,
+		idempotency:        idempotencyService,
+		idempotencyConfig:  appConfig.Idempotency,
+		outboxRelay:        outboxRelay,
+		outboxConfig:       appConfig.Outbox,
+		logger:             logger,
+		tokenManager:       tokenManager,
+		accessPolicy:       accessPolicy,
+		expanders: map[string]handler.Expander{
+			"avatar": handler.NewAvatarExpander(avatarService),
+		},
+		cache:      appConfig.Cache,
+		serveBlobs: appConfig.Storage.Driver == "local",
+	}
+}
+
+func newBlobStore(storageConfig config.StorageConfig) (storage.BlobStore, error) {
+	switch storageConfig.Driver {
+	case "local":
+		return storage.NewLocalStore(storageConfig.LocalDirectory, storageConfig.PublicBaseURL)
+	case "s3":
+		if storageConfig.S3Endpoint == "" || storageConfig.S3Bucket == "" {
+			return nil, fmt.Errorf("storage.s3_endpoint and storage.s3_bucket must be set for the s3 driver")
+		}
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:      storageConfig.S3Endpoint,
+			Region:        storageConfig.S3Region,
+			Bucket:        storageConfig.S3Bucket,
+			AccessKey:     storageConfig.S3AccessKey,
+			SecretKey:     storageConfig.S3SecretKey,
+			PublicBaseURL: storageConfig.PublicBaseURL,
+		}, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %q", storageConfig.Driver)
+	}
+}
+
+func newPublisher(outboxConfig config.OutboxConfig, logger *utils.Logger) (events.Publisher, error) {
+	switch outboxConfig.Publisher {
+	case "log":
+		return events.NewLogPublisher(logger), nil
+	case "http":
+		if outboxConfig.HTTPURL == "" {
+			return nil, fmt.Errorf("outbox.http_url must be set for the http publisher")
+		}
+		return events.NewHTTPPublisher(outboxConfig.HTTPURL, &http.Client{Timeout: outboxConfig.HTTPTimeout}), nil
+	case "memory":
+		return events.NewMemoryPublisher(), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher: %q", outboxConfig.Publisher)
 	}
 }
 
+// StartWorkers runs the background jobs until ctx is done
+func (r *Router) StartWorkers(ctx context.Context) {
+	go r.dataExportService.RunGeneration(ctx, r.exportConfig.PollInterval)
+	go r.loginEventService.RunRetention(ctx, r.loginEventConfig.PurgeInterval)
+	go r.idempotency.RunPurge(ctx, r.idempotencyConfig.PurgeInterval)
+	go r.outboxRelay.Run(ctx, r.outboxConfig.PollInterval)
+	go r.webhookService.RunDeliveries(ctx, r.webhookConfig.PollInterval)
+	r.eventBroker.Follow(ctx, r.userChangeFeed, r.loadOutboxEvent, r.logger)
+	go r.userChangeFeed.Run(ctx)
+
+	// Ending the event streams lets the server shut down without waiting on them
+	go func() {
+		<-ctx.Done()
+		r.eventBroker.Close()
+	}()
+}
+
 func (r *Router) SetupRoutes() http.Handler {
 	router := chi.NewRouter()
 
@@ -49,14 +282,86 @@ func (r *Router) SetupRoutes() http.Handler {
 	router.Use(customMiddleware.APIID())
 	router.Use(customMiddleware.CORS())
 
+	// POSTs clients may safely retry with an Idempotency-Key
+	idempotent := customMiddleware.Idempotency(r.idempotency, r.logger)
+
+	// Auth routes
+	router.Route("/auth", func(route chi.Router) {
+		route.Post("/login", r.authHandler.Login)
+		route.With(idempotent).Post("/signup", r.authHandler.SignUp)
+	})
+
 	// User routes
 	router.Route("/users", func(route chi.Router) {
-		route.Get("/", r.userHandler.List)
-		route.Post("/", r.userHandler.Create)
-		route.Get("/{id}", r.userHandler.GetByID)
-		route.Put("/{id}", r.userHandler.Update)
-		route.Patch("/{id}", r.userHandler.SoftDelete)
+		// ?fields= and ?expand= on the routes responding with users
+		users := handler.ShapeResponses(&model.UserResponse{}, r.expanders)
+		searchResults := handler.ShapeResponses(&model.UserSearchResult{}, r.expanders)
+
+		// Admins may also list deleted users
+		route.With(users, customMiddleware.OptionalAuth(r.tokenManager, r.userStatusService), customMiddleware.CacheControl(r.cache.UserList)).Get("/", r.userHandler.List)
+		route.With(searchResults, customMiddleware.CacheControl(r.cache.UserSearch)).Get("/search", r.userHandler.Search)
+		route.With(users, customMiddleware.CacheControl(r.cache.UserList)).Get("/batch", r.userHandler.GetBatch)
+		// The mailed links only show the change, acting on it takes a POST of the token
+		route.Get("/email-changes/confirm", r.emailChangeHandler.ShowConfirm)
+		route.Post("/email-changes/confirm", r.emailChangeHandler.Confirm)
+		route.Get("/email-changes/revert", r.emailChangeHandler.ShowRevert)
+		route.Post("/email-changes/revert", r.emailChangeHandler.Revert)
+		route.With(users, customMiddleware.CacheControl(r.cache.UserGet)).Get("/by-username/{username}", r.userHandler.GetByUsername)
+		route.With(users, customMiddleware.CacheControl(r.cache.UserGet)).Get("/{id}", r.userHandler.GetByID)
+
+		// Self-service and admin routes, {id} may be "me"
+		route.Group(func(route chi.Router) {
+			route.Use(customMiddleware.AuthMiddleware(r.tokenManager, r.userStatusService))
+			route.With(users).Put("/{id}", r.userHandler.Update)
+			route.With(users).Patch("/{id}", r.userHandler.Patch)
+			route.Delete("/{id}", r.userHandler.SoftDelete)
+			route.With(idempotent).Post("/{id}/exports", r.dataExportHandler.Create)
+			route.Get("/{id}/exports/{exportID}", r.dataExportHandler.GetByID)
+			route.Get("/{id}/exports/{exportID}/download", r.dataExportHandler.Download)
+			route.Put("/{id}/avatar", r.avatarHandler.Upload)
+			route.Delete("/{id}/avatar", r.avatarHandler.Delete)
+			route.With(idempotent).Post("/{id}/email", r.emailChangeHandler.Request)
+			route.Get("/{id}/logins", r.loginEventHandler.History)
+		})
+
+		// Admin routes
+		route.Group(func(route chi.Router) {
+			route.Use(customMiddleware.AuthMiddleware(r.tokenManager, r.userStatusService))
+			route.Use(customMiddleware.RequireAdmin(r.accessPolicy))
+			// Users register themselves through /auth/signup
+			route.With(users, idempotent).Post("/", r.userHandler.Create)
+			route.Post("/import", r.userImportHandler.Import)
+			route.Get("/export", r.userHandler.Export)
+			route.Get("/events", r.userEventsHandler.Stream)
+			route.Get("/{id}/status-transitions", r.userStatusHandler.ListTransitions)
+			route.With(idempotent).Post("/{id}/status-transitions", r.userStatusHandler.Transition)
+		})
+	})
+
+	// Audit log of user changes, admins only
+	router.Route("/audit-log", func(route chi.Router) {
+		route.Use(customMiddleware.AuthMiddleware(r.tokenManager, r.userStatusService))
+		route.Use(customMiddleware.RequireAdmin(r.accessPolicy))
+		route.Get("/", r.auditLogHandler.List)
+	})
+
+	// Webhook endpoints and their delivery log, admins only
+	router.Route("/webhooks", func(route chi.Router) {
+		route.Use(customMiddleware.AuthMiddleware(r.tokenManager, r.userStatusService))
+		route.Use(customMiddleware.RequireAdmin(r.accessPolicy))
+		route.Get("/", r.webhookHandler.List)
+		route.Post("/", r.webhookHandler.Create)
+		route.Get("/{id}", r.webhookHandler.GetByID)
+		route.Patch("/{id}", r.webhookHandler.Update)
+		route.Delete("/{id}", r.webhookHandler.Delete)
+		route.Get("/{id}/deliveries", r.webhookHandler.ListDeliveries)
+		route.Post("/{id}/deliveries/{deliveryID}/redeliver", r.webhookHandler.Redeliver)
 	})
 
+	// Public URLs of the local blob store
+	if r.serveBlobs {
+		router.Get("/uploads/*", r.avatarHandler.Serve)
+	}
+
 	return router
 }
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	appcontext "github.com/Rafli-Dewanto/go-template/internal/context"
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const auditRedacted = "[REDACTED]"
+
+// auditRedactedFields are recorded as changed without ever storing their values
+var auditRedactedFields = map[string]bool{
+	"password": true,
+}
+
+// auditIgnoredFields change with every write and would only add noise to a diff
+var auditIgnoredFields = map[string]bool{
+	"version":    true,
+	"updated_at": true,
+}
+
+// AuditService records who changed which user and how. Record must be called
+// with the context of the transaction making the change, so the entry is only
+// kept if the change is.
+type AuditService interface {
+	Record(ctx context.Context, action string, targetID *int64, before any, after any) error
+	List(ctx context.Context, filter *model.AuditLogFilter, query *model.PaginationQuery) (*model.Response, error)
+	ListByUser(ctx context.Context, userID int64) ([]*model.AuditLogResponse, error)
+}
+
+type auditService struct {
+	repo   repository.AuditRepository
+	logger *utils.Logger
+}
+
+func NewAuditService(repo repository.AuditRepository, logger *utils.Logger) AuditService {
+	return &auditService{repo: repo, logger: logger}
+}
+
+// Record stores the fields that differ between before and after, either of which
+// may be nil. Both are entities whose fields are named by their db tags, or
+// maps for changes that are not a single row such as imports. The actor is the
+// signed in user and the API ID is the one of the request, both taken from ctx.
+func (s *auditService) Record(ctx context.Context, action string, targetID *int64, before any, after any) error {
+	changes, err := json.Marshal(auditDiff(before, after))
+	if err != nil {
+		return err
+	}
+
+	entry := &entity.AuditLog{
+		Action:     action,
+		TargetType: entity.AuditTargetUser,
+		TargetID:   targetID,
+		APIID:      appcontext.GetAPIID(ctx),
+		Changes:    types.JSONText(changes),
+	}
+	if claims, ok := auth.GetUserClaims(ctx); ok {
+		entry.ActorID = &claims.UserID
+	}
+
+	if err := s.repo.Create(ctx, entry); err != nil {
+		s.logger.Error("Failed to record %s audit entry: %v", action, err)
+		return err
+	}
+	return nil
+}
+
+func (s *auditService) List(ctx context.Context, filter *model.AuditLogFilter, query *model.PaginationQuery) (*model.Response, error) {
+	if query.Limit <= 0 {
+		query.Limit = 10
+	}
+
+	entries, total, err := s.repo.List(ctx, filter, query)
+	if err != nil {
+		s.logger.Warning("Failed to list audit log: %v", err)
+		return nil, err
+	}
+
+	responses, err := converter.ToAuditLogResponses(entries)
+	if err != nil {
+		s.logger.Error("Failed to list audit log: %v", err)
+		return nil, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(query.Limit)))
+	return &model.Response{
+		Message: "Audit log retrieved successfully",
+		Data:    responses,
+		Meta: &model.PaginatedMeta{
+			Total:       total,
+			CurrentPage: int64(query.Page),
+			PerPage:     int64(query.Limit),
+			LastPage:    totalPages,
+			HasNextPage: int64(query.Page) < int64(totalPages),
+			HasPrevPage: int64(query.Page) > 1,
+		},
+	}, nil
+}
+
+// ListByUser returns the entries about a user, not those the user made about
+// others, for the user's own data export
+func (s *auditService) ListByUser(ctx context.Context, userID int64) ([]*model.AuditLogResponse, error) {
+	entries, err := s.repo.ListByTarget(ctx, entity.AuditTargetUser, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := converter.ToAuditLogResponses(entries)
+	if err != nil {
+		s.logger.Error("Failed to export audit log of user %d: %v", userID, err)
+		return nil, err
+	}
+	return responses, nil
+}
+
+// auditDiff returns the changed fields, redacting secrets
+func auditDiff(before any, after any) map[string]model.FieldChange {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := map[string]model.FieldChange{}
+	for _, name := range names {
+		if auditIgnoredFields[name] {
+			continue
+		}
+		oldValue, newValue := beforeFields[name], afterFields[name]
+		if auditEqual(oldValue, newValue) {
+			continue
+		}
+		if auditRedactedFields[name] {
+			change := model.FieldChange{}
+			if oldValue != nil {
+				change.Before = auditRedacted
+			}
+			if newValue != nil {
+				change.After = auditRedacted
+			}
+			changes[name] = change
+			continue
+		}
+		changes[name] = model.FieldChange{Before: oldValue, After: newValue}
+	}
+	return changes
+}
+
+// auditFields flattens a struct into its db columns with the table prefix
+// stripped, so usr_display_name becomes display_name. Nil pointers and empty
+// JSON become nil.
+func auditFields(value any) map[string]any {
+	fields := map[string]any{}
+	if value == nil {
+		return fields
+	}
+	if m, ok := value.(map[string]any); ok {
+		for name, v := range m {
+			fields[name] = v
+		}
+		return fields
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return fields
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("db")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if _, name, ok := strings.Cut(tag, "_"); ok {
+			tag = name
+		}
+		fields[tag] = auditValue(v.Field(i))
+	}
+	return fields
+}
+
+func auditValue(v reflect.Value) any {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case types.JSONText:
+		if len(value) == 0 {
+			return nil
+		}
+		return json.RawMessage(value)
+	case time.Time:
+		return value.UTC()
+	default:
+		return value
+	}
+}
+
+// auditEqual compares values by their decoded JSON form, which is how they are
+// stored, so attributes differing only in key order or spacing are equal
+func auditEqual(a any, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	var decodedA, decodedB any
+	json.Unmarshal(encodedA, &decodedA)
+	json.Unmarshal(encodedB, &decodedB)
+	return reflect.DeepEqual(decodedA, decodedB)
+}
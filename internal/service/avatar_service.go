@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/storage"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAvatarTooLarge       = errors.New("avatar file is too large")
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+	ErrInvalidImageSize     = errors.New("image dimensions out of range")
+)
+
+// allowedAvatarTypes are the sniffed content types we can decode with the standard library
+var allowedAvatarTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+type AvatarLimits struct {
+	MaxBytes       int64
+	MaxWidth       int
+	MaxHeight      int
+	ThumbnailSizes []int
+}
+
+type AvatarService interface {
+	Upload(ctx context.Context, userID int64, file io.Reader) (*model.AvatarResponse, error)
+	Delete(ctx context.Context, userID int64) error
+	Variants(avatarURL string, avatarKey *string) *model.AvatarResponse
+}
+
+type avatarService struct {
+	userRepo   repository.UserRepository
+	transactor repository.Transactor
+	auditor    AuditService
+	store      storage.BlobStore
+	limits     AvatarLimits
+	logger     *utils.Logger
+}
+
+func NewAvatarService(userRepo repository.UserRepository, transactor repository.Transactor, auditor AuditService, store storage.BlobStore, limits AvatarLimits, logger *utils.Logger) AvatarService {
+	return &avatarService{userRepo: userRepo, transactor: transactor, auditor: auditor, store: store, limits: limits, logger: logger}
+}
+
+func (s *avatarService) Upload(ctx context.Context, userID int64, file io.Reader) (*model.AvatarResponse, error) {
+	if userID <= 0 {
+		s.logger.Warning("Invalid input for avatar upload: %v", ErrInvalidInput)
+		return nil, ErrInvalidInput
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, s.limits.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if int64(len(data)) > s.limits.MaxBytes {
+		s.logger.Warning("Avatar upload exceeds %d bytes", s.limits.MaxBytes)
+		return nil, ErrAvatarTooLarge
+	}
+
+	// Never trust the client supplied Content-Type, sniff the bytes instead
+	mime := mimetype.Detect(data)
+	if !mimetype.EqualsAny(mime.String(), allowedAvatarTypes...) {
+		s.logger.Warning("Unsupported avatar type: %s", mime.String())
+		return nil, ErrUnsupportedImageType
+	}
+
+	// Check dimensions from the header before decoding the whole image
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		s.logger.Warning("Failed to read avatar image header: %v", err)
+		return nil, ErrUnsupportedImageType
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > s.limits.MaxWidth || config.Height > s.limits.MaxHeight {
+		s.logger.Warning("Avatar dimensions %dx%d out of range", config.Width, config.Height)
+		return nil, ErrInvalidImageSize
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		s.logger.Warning("Failed to decode avatar image: %v", err)
+		return nil, ErrUnsupportedImageType
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		s.logger.Warning("User not found: %v", ErrUserNotFound)
+		return nil, ErrUserNotFound
+	}
+
+	originalKey := fmt.Sprintf("avatars/%d/%s/original%s", userID, uuid.New().String(), mime.Extension())
+	if err := s.store.Put(ctx, originalKey, bytes.NewReader(data), int64(len(data)), mime.String()); err != nil {
+		s.logger.Error("Failed to store avatar: %v", err)
+		return nil, err
+	}
+
+	written := []string{originalKey}
+	contentType := thumbnailContentType(originalKey)
+	for _, size := range s.limits.ThumbnailSizes {
+		thumbnail, err := encodeThumbnail(utils.ResizeSquare(img, size), contentType)
+		if err == nil {
+			key := thumbnailKey(originalKey, size)
+			err = s.store.Put(ctx, key, bytes.NewReader(thumbnail), int64(len(thumbnail)), contentType)
+			written = append(written, key)
+		}
+		if err != nil {
+			s.logger.Error("Failed to store %dpx avatar thumbnail: %v", size, err)
+			s.deleteBlobs(ctx, written)
+			return nil, err
+		}
+	}
+
+	if err := s.updateAvatar(ctx, entity.AuditActionAvatarUpdate, user, s.store.URL(originalKey), &originalKey); err != nil {
+		s.deleteBlobs(ctx, written)
+		return nil, err
+	}
+
+	if user.AvatarKey != nil {
+		s.deleteBlobs(ctx, s.avatarKeys(*user.AvatarKey))
+	}
+
+	return s.Variants(s.store.URL(originalKey), &originalKey), nil
+}
+
+func (s *avatarService) Delete(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		s.logger.Warning("User not found: %v", ErrUserNotFound)
+		return ErrUserNotFound
+	}
+
+	if err := s.updateAvatar(ctx, entity.AuditActionAvatarDelete, user, "", nil); err != nil {
+		return err
+	}
+
+	if user.AvatarKey != nil {
+		s.deleteBlobs(ctx, s.avatarKeys(*user.AvatarKey))
+	}
+	return nil
+}
+
+// updateAvatar points the user at a new avatar and audits the change in one transaction
+func (s *avatarService) updateAvatar(ctx context.Context, action string, user *entity.User, avatarURL string, avatarKey *string) error {
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdateAvatar(ctx, user.ID, avatarURL, avatarKey); err != nil {
+			return err
+		}
+		updated := *user
+		updated.AvatarURL = avatarURL
+		updated.AvatarKey = avatarKey
+		return s.auditor.Record(ctx, action, &user.ID, user, &updated)
+	})
+}
+
+// Variants describes a user's avatar and its thumbnails. Avatars set by URL
+// rather than uploaded have no thumbnails.
+func (s *avatarService) Variants(avatarURL string, avatarKey *string) *model.AvatarResponse {
+	response := &model.AvatarResponse{URL: avatarURL, Thumbnails: map[string]string{}}
+	if avatarKey == nil || s.store.URL(*avatarKey) != avatarURL {
+		return response
+	}
+
+	for _, size := range s.limits.ThumbnailSizes {
+		response.Thumbnails[strconv.Itoa(size)] = s.store.URL(thumbnailKey(*avatarKey, size))
+	}
+	return response
+}
+
+func (s *avatarService) avatarKeys(originalKey string) []string {
+	keys := []string{originalKey}
+	for _, size := range s.limits.ThumbnailSizes {
+		keys = append(keys, thumbnailKey(originalKey, size))
+	}
+	return keys
+}
+
+// deleteBlobs removes blobs on a best-effort basis, failures only leave orphans behind
+func (s *avatarService) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			s.logger.Warning("Failed to delete avatar blob %s: %v", key, err)
+		}
+	}
+}
+
+// thumbnailKey places thumbnails next to the original, e.g. avatars/1/<uuid>/64.png
+func thumbnailKey(originalKey string, size int) string {
+	ext := ".jpg"
+	if thumbnailContentType(originalKey) == "image/png" {
+		ext = ".png"
+	}
+	return path.Join(path.Dir(originalKey), strconv.Itoa(size)+ext)
+}
+
+// thumbnailContentType keeps transparency for PNG and GIF sources and uses JPEG otherwise
+func thumbnailContentType(originalKey string) string {
+	switch path.Ext(originalKey) {
+	case ".png", ".gif":
+		return "image/png"
+	default:
+		return "image/jpeg"
+	}
+}
+
+func encodeThumbnail(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
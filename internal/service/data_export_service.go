@@ -0,0 +1,370 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/storage"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export not ready")
+	ErrExportExpired  = errors.New("export expired")
+)
+
+// exportTimeout bounds how long a single export may take to generate
+const exportTimeout = 5 * time.Minute
+
+// exportLease is how long a claimed export is reserved for the worker generating
+// it, past the timeout so a slow export is not claimed twice
+const exportLease = 2 * exportTimeout
+
+// exportPurgeBatch is how many expired archives one pass of the worker deletes
+const exportPurgeBatch = 100
+
+// exportContentTypes are the content types archives are stored with, by format
+var exportContentTypes = map[string]string{
+	entity.DataExportFormatJSON: "application/json",
+	entity.DataExportFormatZIP:  "application/zip",
+}
+
+// ExportSection collects one named group of records related to a user,
+// e.g. previous exports or login history, for inclusion in a data export.
+type ExportSection struct {
+	Name    string
+	Collect func(ctx context.Context, userID int64) (any, error)
+}
+
+// ExportFile is the archive of a completed export, the caller closes Body
+type ExportFile struct {
+	Body        io.ReadCloser
+	ContentType string
+	Format      string
+}
+
+type DataExportService interface {
+	Request(ctx context.Context, userID int64, requestedBy int64, format string) (*model.DataExportResponse, error)
+	GetByID(ctx context.Context, userID int64, id string) (*model.DataExportResponse, error)
+	GetFile(ctx context.Context, userID int64, id string) (*ExportFile, error)
+	RunGeneration(ctx context.Context, interval time.Duration)
+}
+
+type dataExportService struct {
+	repo      repository.DataExportRepository
+	userRepo  repository.UserRepository
+	store     storage.BlobStore
+	retention time.Duration
+	sections  []ExportSection
+	wake      chan struct{}
+	logger    *utils.Logger
+}
+
+// NewDataExportService stores archives in store, which every instance shares,
+// and deletes them retention after they were generated
+func NewDataExportService(repo repository.DataExportRepository, userRepo repository.UserRepository, store storage.BlobStore, retention time.Duration, logger *utils.Logger, sections ...ExportSection) DataExportService {
+	s := &dataExportService{
+		repo:      repo,
+		userRepo:  userRepo,
+		store:     store,
+		retention: retention,
+		wake:      make(chan struct{}, 1),
+		logger:    logger,
+	}
+
+	// Previous export requests are themselves personal data
+	s.sections = append([]ExportSection{{
+		Name: "data_exports",
+		Collect: func(ctx context.Context, userID int64) (any, error) {
+			exports, err := repo.ListByUser(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			return converter.ToDataExportsResponse(exports), nil
+		},
+	}}, sections...)
+
+	return s
+}
+
+func (s *dataExportService) Request(ctx context.Context, userID int64, requestedBy int64, format string) (*model.DataExportResponse, error) {
+	if userID <= 0 {
+		s.logger.Warning("Invalid input for data export: %v", ErrInvalidInput)
+		return nil, ErrInvalidInput
+	}
+
+	format = utils.Default(format, entity.DataExportFormatJSON)
+	if format != entity.DataExportFormatJSON && format != entity.DataExportFormatZIP {
+		s.logger.Warning("Unsupported data export format: %s", format)
+		return nil, ErrInvalidInput
+	}
+
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		s.logger.Warning("User not found: %v", ErrUserNotFound)
+		return nil, ErrUserNotFound
+	}
+
+	export := &entity.DataExport{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		RequestedBy: requestedBy,
+		Format:      format,
+		Status:      entity.DataExportStatusPending,
+	}
+
+	if err := s.repo.Create(ctx, export); err != nil {
+		return nil, err
+	}
+
+	// Large accounts can take a while, so the archive is built by the generation
+	// worker and clients poll the status endpoint until it is completed.
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return converter.ToDataExportResponse(export), nil
+}
+
+func (s *dataExportService) GetByID(ctx context.Context, userID int64, id string) (*model.DataExportResponse, error) {
+	export, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		s.logger.Warning("Data export not found: %v", ErrExportNotFound)
+		return nil, ErrExportNotFound
+	}
+
+	return converter.ToDataExportResponse(export), nil
+}
+
+func (s *dataExportService) GetFile(ctx context.Context, userID int64, id string) (*ExportFile, error) {
+	export, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		s.logger.Warning("Data export not found: %v", ErrExportNotFound)
+		return nil, ErrExportNotFound
+	}
+
+	if export.Status == entity.DataExportStatusExpired || (export.ExpiresAt != nil && !time.Now().Before(*export.ExpiresAt)) {
+		return nil, ErrExportExpired
+	}
+	if export.Status != entity.DataExportStatusCompleted || export.FileKey == nil {
+		return nil, ErrExportNotReady
+	}
+
+	body, contentType, err := s.store.Get(ctx, *export.FileKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.logger.Warning("Archive of data export %s is missing", export.ID)
+		return nil, ErrExportExpired
+	}
+	if err != nil {
+		s.logger.Error("Failed to read archive of data export %s: %v", export.ID, err)
+		return nil, err
+	}
+
+	return &ExportFile{Body: body, ContentType: utils.Default(contentType, exportContentTypes[export.Format]), Format: export.Format}, nil
+}
+
+// RunGeneration generates requested exports one at a time until ctx is done. It
+// looks for them every interval and straight away when one is requested here.
+// Exports left running by an instance that stopped are picked up once their
+// lease expires. Every pass also deletes the archives that expired.
+func (s *dataExportService) RunGeneration(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeExpired(ctx)
+
+		for ctx.Err() == nil {
+			now := time.Now()
+			claimed, err := s.repo.ClaimPending(ctx, 1, now, now.Add(exportLease))
+			if err != nil && ctx.Err() == nil {
+				s.logger.Warning("Claiming data exports failed: %v", err)
+			}
+			if err != nil || len(claimed) == 0 {
+				break
+			}
+			s.generate(ctx, claimed[0])
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *dataExportService) generate(ctx context.Context, export *entity.DataExport) {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	key, err := s.buildSafely(ctx, export)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// Shutting down, the export is claimed again once its lease expires
+		return
+	}
+
+	now := time.Now()
+	export.CompletedAt = &now
+	if err != nil {
+		s.logger.Error("Failed to generate data export %s: %v", export.ID, err)
+		message := err.Error()
+		export.Status = entity.DataExportStatusFailed
+		export.Error = &message
+	} else {
+		expiresAt := now.Add(s.retention)
+		export.Status = entity.DataExportStatusCompleted
+		export.FileKey = &key
+		export.ExpiresAt = &expiresAt
+	}
+
+	// The export may have run out of time, recording that must not
+	updateCtx, cancelUpdate := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancelUpdate()
+	if err := s.repo.UpdateStatus(updateCtx, export); err != nil {
+		s.logger.Error("Failed to update data export %s: %v", export.ID, err)
+	}
+}
+
+// purgeExpired deletes the archives of exports past their expiry. An archive
+// whose deletion fails is retried on the next pass.
+func (s *dataExportService) purgeExpired(ctx context.Context) {
+	expired, err := s.repo.ListExpired(ctx, time.Now(), exportPurgeBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warning("Listing expired data exports failed: %v", err)
+		}
+		return
+	}
+
+	for _, export := range expired {
+		if err := s.store.Delete(ctx, *export.FileKey); err != nil {
+			s.logger.Warning("Failed to delete archive of data export %s: %v", export.ID, err)
+			continue
+		}
+		if err := s.repo.MarkExpired(ctx, export.ID); err != nil {
+			s.logger.Warning("Failed to mark data export %s expired: %v", export.ID, err)
+		}
+	}
+}
+
+// buildSafely turns a panic while building into an error, so one broken export
+// fails alone instead of taking down the worker
+func (s *dataExportService) buildSafely(ctx context.Context, export *entity.DataExport) (key string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic while building export: %v", recovered)
+		}
+	}()
+	return s.build(ctx, export)
+}
+
+func (s *dataExportService) build(ctx context.Context, export *entity.DataExport) (string, error) {
+	user, err := s.userRepo.GetByID(ctx, export.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load user: %w", err)
+	}
+
+	document := &model.PersonalDataExport{
+		GeneratedAt: time.Now(),
+		UserID:      user.ID,
+		Profile:     converter.ToPersonalDataProfile(user),
+		Sections:    make(map[string]any, len(s.sections)),
+	}
+
+	for _, section := range s.sections {
+		data, err := section.Collect(ctx, user.ID)
+		if err != nil {
+			return "", fmt.Errorf("failed to collect %s: %w", section.Name, err)
+		}
+		document.Sections[section.Name] = data
+	}
+
+	// The archive is written to a temporary file first, the store needs its size
+	file, err := os.CreateTemp("", "export-*."+export.Format)
+	if err != nil {
+		return "", fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if export.Format == entity.DataExportFormatZIP {
+		err = writeExportZIP(file, document)
+	} else {
+		err = writeExportJSON(file, document)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", fmt.Errorf("failed to size export file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind export file: %w", err)
+	}
+
+	key := exportKey(export)
+	if err := s.store.Put(ctx, key, file, size, exportContentTypes[export.Format]); err != nil {
+		return "", fmt.Errorf("failed to store export: %w", err)
+	}
+
+	return key, nil
+}
+
+// exportKey places archives under exports/, which unlike avatars/ is never
+// served publicly, e.g. exports/1/<uuid>.zip
+func exportKey(export *entity.DataExport) string {
+	return fmt.Sprintf("exports/%d/%s.%s", export.UserID, export.ID, export.Format)
+}
+
+func writeExportJSON(file *os.File, document *model.PersonalDataExport) error {
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+// writeExportZIP writes the profile and every section as separate JSON files
+func writeExportZIP(file *os.File, document *model.PersonalDataExport) error {
+	archive := zip.NewWriter(file)
+
+	entries := map[string]any{
+		"manifest.json": map[string]any{
+			"generated_at": document.GeneratedAt,
+			"user_id":      document.UserID,
+		},
+		"profile.json": document.Profile,
+	}
+	for name, data := range document.Sections {
+		entries[name+".json"] = data
+	}
+
+	for name, data := range entries {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	return archive.Close()
+}
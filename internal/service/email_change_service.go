@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/mailer"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrEmailUnchanged      = errors.New("email is unchanged")
+	ErrEmailAlreadyInUse   = errors.New("email already in use")
+	ErrEmailChangeNotFound = errors.New("email change not found or expired")
+	ErrEmailChangeConflict = errors.New("email changed since the request was made")
+)
+
+const (
+	// emailChangeTTL is how long the new address has to confirm
+	emailChangeTTL = 24 * time.Hour
+	// emailRevertTTL is how long the old address can undo the change
+	emailRevertTTL = 7 * 24 * time.Hour
+
+	emailChangeTokenLength = 43
+)
+
+type EmailChangeService interface {
+	Request(ctx context.Context, userID int64, newEmail string) (*model.EmailChangeResponse, error)
+	GetByConfirmToken(ctx context.Context, token string) (*model.EmailChangeResponse, error)
+	GetByRevertToken(ctx context.Context, token string) (*model.EmailChangeResponse, error)
+	Confirm(ctx context.Context, token string) (*model.EmailChangeResponse, error)
+	Revert(ctx context.Context, token string) (*model.EmailChangeResponse, error)
+	ListByUser(ctx context.Context, userID int64) ([]*model.EmailChangeResponse, error)
+}
+
+type emailChangeService struct {
+	repo        repository.EmailChangeRepository
+	userRepo    repository.UserRepository
+	transactor  repository.Transactor
+	auditor     AuditService
+	mailer      mailer.Mailer
+	linkBaseURL string
+	logger      *utils.Logger
+}
+
+// NewEmailChangeService creates the service, linkBaseURL is the public URL the
+// confirm and revert links in emails point at
+func NewEmailChangeService(repo repository.EmailChangeRepository, userRepo repository.UserRepository, transactor repository.Transactor, auditor AuditService, mailer mailer.Mailer, linkBaseURL string, logger *utils.Logger) EmailChangeService {
+	return &emailChangeService{repo: repo, userRepo: userRepo, transactor: transactor, auditor: auditor, mailer: mailer, linkBaseURL: linkBaseURL, logger: logger}
+}
+
+// Request records a pending change, mails a confirmation link to the new address
+// and a revert link to the current one. The user keeps the current address
+// until the new one is confirmed.
+func (s *emailChangeService) Request(ctx context.Context, userID int64, newEmail string) (*model.EmailChangeResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		s.logger.Warning("User not found: %v", ErrUserNotFound)
+		return nil, ErrUserNotFound
+	}
+
+	newEmail = utils.NormalizeIdentifier(newEmail)
+	if newEmail == utils.NormalizeIdentifier(user.Email) {
+		return nil, ErrEmailUnchanged
+	}
+	if _, err := s.userRepo.GetByEmailOrUsername(ctx, newEmail, ""); err == nil {
+		s.logger.Warning("Email change of user %d to an address in use", userID)
+		return nil, ErrEmailAlreadyInUse
+	}
+
+	confirmToken, err := utils.GenerateRandomString(emailChangeTokenLength)
+	if err != nil {
+		return nil, err
+	}
+	revertToken, err := utils.GenerateRandomString(emailChangeTokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	change := &entity.EmailChange{
+		ID:               uuid.New().String(),
+		UserID:           userID,
+		OldEmail:         user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: utils.HashSHA256(confirmToken),
+		RevertTokenHash:  utils.HashSHA256(revertToken),
+		Status:           entity.EmailChangeStatusPending,
+		ExpiresAt:        now.Add(emailChangeTTL),
+		RevertExpiresAt:  now.Add(emailRevertTTL),
+	}
+	if err := s.repo.Create(ctx, change); err != nil {
+		return nil, err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm this address for your account by opening the link below within %d hours:\n\n%s\n",
+			user.Username, int(emailChangeTTL.Hours()), s.link("confirm", confirmToken)),
+	})
+	if err != nil {
+		s.logger.Error("Failed to send email change confirmation to user %d: %v", userID, err)
+		return nil, err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nA change of your account email to %s was requested. If this was not you, "+
+			"undo it with one click within %d days:\n\n%s\n",
+			user.Username, newEmail, int(emailRevertTTL.Hours()/24), s.link("revert", revertToken)),
+	})
+	if err != nil {
+		// The change is harmless until confirmed, do not fail the request over the notice
+		s.logger.Warning("Failed to send email change notice to user %d: %v", userID, err)
+	}
+
+	s.logger.Info("Email change %s requested for user %d", change.ID, userID)
+	return converter.ToEmailChangeResponse(change), nil
+}
+
+// GetByConfirmToken returns the change a confirmation link would apply, without applying it
+func (s *emailChangeService) GetByConfirmToken(ctx context.Context, token string) (*model.EmailChangeResponse, error) {
+	change, err := s.confirmable(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToEmailChangeResponse(change), nil
+}
+
+// GetByRevertToken returns the change a revert link would undo, without undoing it
+func (s *emailChangeService) GetByRevertToken(ctx context.Context, token string) (*model.EmailChangeResponse, error) {
+	change, err := s.revertable(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToEmailChangeResponse(change), nil
+}
+
+func (s *emailChangeService) Confirm(ctx context.Context, token string) (*model.EmailChangeResponse, error) {
+	change, err := s.confirmable(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Confirm(ctx, change); err != nil {
+			return err
+		}
+		return s.auditor.Record(ctx, entity.AuditActionEmailChange, &change.UserID,
+			map[string]any{"email": change.OldEmail}, map[string]any{"email": change.NewEmail})
+	})
+	if err != nil {
+		return nil, s.mapRepositoryError(err)
+	}
+
+	s.logger.Info("Email change %s confirmed for user %d", change.ID, change.UserID)
+	return converter.ToEmailChangeResponse(change), nil
+}
+
+// Revert undoes a change from the old address, whether or not it was confirmed yet
+func (s *emailChangeService) Revert(ctx context.Context, token string) (*model.EmailChangeResponse, error) {
+	change, err := s.revertable(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reverting a pending change leaves the user as it was, there is nothing to audit
+	confirmed := change.Status == entity.EmailChangeStatusConfirmed
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Revert(ctx, change); err != nil || !confirmed {
+			return err
+		}
+		return s.auditor.Record(ctx, entity.AuditActionEmailChangeRevert, &change.UserID,
+			map[string]any{"email": change.NewEmail}, map[string]any{"email": change.OldEmail})
+	})
+	if err != nil {
+		return nil, s.mapRepositoryError(err)
+	}
+
+	s.logger.Info("Email change %s reverted for user %d", change.ID, change.UserID)
+	return converter.ToEmailChangeResponse(change), nil
+}
+
+func (s *emailChangeService) ListByUser(ctx context.Context, userID int64) ([]*model.EmailChangeResponse, error) {
+	changes, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToEmailChangesResponse(changes), nil
+}
+
+// confirmable looks up the pending change a confirm token belongs to
+func (s *emailChangeService) confirmable(ctx context.Context, token string) (*entity.EmailChange, error) {
+	change, err := s.repo.GetByConfirmTokenHash(ctx, utils.HashSHA256(token))
+	if err != nil || change.Status != entity.EmailChangeStatusPending || time.Now().After(change.ExpiresAt) {
+		s.logger.Warning("Email change confirmation rejected: %v", ErrEmailChangeNotFound)
+		return nil, ErrEmailChangeNotFound
+	}
+	return change, nil
+}
+
+// revertable looks up the pending or confirmed change a revert token belongs to
+func (s *emailChangeService) revertable(ctx context.Context, token string) (*entity.EmailChange, error) {
+	change, err := s.repo.GetByRevertTokenHash(ctx, utils.HashSHA256(token))
+	if err != nil || time.Now().After(change.RevertExpiresAt) ||
+		(change.Status != entity.EmailChangeStatusPending && change.Status != entity.EmailChangeStatusConfirmed) {
+		s.logger.Warning("Email change revert rejected: %v", ErrEmailChangeNotFound)
+		return nil, ErrEmailChangeNotFound
+	}
+	return change, nil
+}
+
+func (s *emailChangeService) link(action string, token string) string {
+	return fmt.Sprintf("%s/users/email-changes/%s?token=%s", s.linkBaseURL, action, url.QueryEscape(token))
+}
+
+func (s *emailChangeService) mapRepositoryError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		return ErrEmailAlreadyInUse
+	case errors.Is(err, repository.ErrEmailChangeConflict):
+		return ErrEmailChangeConflict
+	default:
+		return err
+	}
+}
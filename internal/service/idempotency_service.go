@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// idempotencyPollInterval is how often a retry checks on the request holding its key
+const idempotencyPollInterval = 100 * time.Millisecond
+
+// IdempotencyOptions control how long keys live and how long requests wait on each other
+type IdempotencyOptions struct {
+	// TTL is how long a response is replayed for
+	TTL time.Duration
+	// LockTimeout is how long a request may hold a key before retries may take it over
+	LockTimeout time.Duration
+	// WaitTimeout is how long a retry waits for the request holding its key
+	WaitTimeout time.Duration
+}
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, scope string, key string, fingerprint string) (*model.IdempotentResponse, error)
+	Complete(ctx context.Context, scope string, key string, fingerprint string, response *model.IdempotentResponse) error
+	Release(ctx context.Context, scope string, key string, fingerprint string) error
+	RunPurge(ctx context.Context, interval time.Duration)
+}
+
+type idempotencyService struct {
+	repo    repository.IdempotencyRepository
+	options IdempotencyOptions
+	logger  *utils.Logger
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository, options IdempotencyOptions, logger *utils.Logger) IdempotencyService {
+	return &idempotencyService{repo: repo, options: options, logger: logger}
+}
+
+// Begin claims key for the request identified by fingerprint and returns nil, the
+// caller must then Complete or Release it. If an earlier request with the same
+// fingerprint already completed, its response is returned for replay. Requests
+// sharing a key run one at a time: Begin waits for the holder to finish.
+func (s *idempotencyService) Begin(ctx context.Context, scope string, key string, fingerprint string) (*model.IdempotentResponse, error) {
+	deadline := time.Now().Add(s.options.WaitTimeout)
+
+	for {
+		now := time.Now()
+		claimed, err := s.repo.Claim(ctx, &entity.IdempotencyKey{
+			Scope:       scope,
+			Key:         key,
+			Fingerprint: fingerprint,
+			LockedUntil: now.Add(s.options.LockTimeout),
+			ExpiresAt:   now.Add(s.options.TTL),
+		}, now)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		existing, err := s.repo.Get(ctx, scope, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Released between the claim and the read, claim it again
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if existing.Fingerprint != fingerprint {
+			s.logger.Warning("Idempotency key %s reused with a different request", key)
+			return nil, ErrIdempotencyKeyReused
+		}
+		if existing.Status == entity.IdempotencyStatusCompleted {
+			return toIdempotentResponse(existing)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrIdempotencyKeyInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, scope string, key string, fingerprint string, response *model.IdempotentResponse) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Complete(ctx, &entity.IdempotencyKey{
+		Scope:           scope,
+		Key:             key,
+		Fingerprint:     fingerprint,
+		ResponseStatus:  &response.StatusCode,
+		ResponseHeaders: header,
+		ResponseBody:    response.Body,
+	})
+}
+
+func (s *idempotencyService) Release(ctx context.Context, scope string, key string, fingerprint string) error {
+	return s.repo.Release(ctx, scope, key, fingerprint)
+}
+
+// RunPurge deletes expired keys every interval until ctx is done
+func (s *idempotencyService) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.repo.PurgeExpired(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			s.logger.Warning("Idempotency key purge failed: %v", err)
+		} else if purged > 0 {
+			s.logger.Info("Purged %d expired idempotency keys", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func toIdempotentResponse(key *entity.IdempotencyKey) (*model.IdempotentResponse, error) {
+	response := &model.IdempotentResponse{Body: key.ResponseBody}
+	if key.ResponseStatus != nil {
+		response.StatusCode = *key.ResponseStatus
+	}
+	if len(key.ResponseHeaders) > 0 {
+		if err := json.Unmarshal(key.ResponseHeaders, &response.Header); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
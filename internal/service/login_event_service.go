@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+const (
+	maxLoginUserAgentLength = 512
+	// maxExportedLoginEvents caps the login history included in a data export
+	maxExportedLoginEvents = 10000
+)
+
+type LoginEventService interface {
+	Record(ctx context.Context, attempt model.LoginAttempt) error
+	History(ctx context.Context, userID int64, query *model.PaginationQuery) (*model.Response, error)
+	ListByUser(ctx context.Context, userID int64) ([]*model.LoginEventResponse, error)
+	Purge(ctx context.Context) (int64, error)
+	RunRetention(ctx context.Context, interval time.Duration)
+}
+
+type loginEventService struct {
+	repo      repository.LoginEventRepository
+	retention time.Duration
+	logger    *utils.Logger
+}
+
+// NewLoginEventService creates the service, events older than retention are purged
+func NewLoginEventService(repo repository.LoginEventRepository, retention time.Duration, logger *utils.Logger) LoginEventService {
+	return &loginEventService{repo: repo, retention: retention, logger: logger}
+}
+
+func (s *loginEventService) Record(ctx context.Context, attempt model.LoginAttempt) error {
+	event := &entity.LoginEvent{
+		UserID:    attempt.UserID,
+		Email:     utils.NormalizeIdentifier(attempt.Email),
+		Success:   attempt.Success,
+		Method:    attempt.Method,
+		IP:        attempt.IP,
+		UserAgent: truncateRunes(attempt.UserAgent, maxLoginUserAgentLength),
+	}
+	if attempt.FailureReason != "" {
+		event.FailureReason = &attempt.FailureReason
+	}
+
+	if err := s.repo.Create(ctx, event); err != nil {
+		s.logger.Error("Failed to record login attempt for %s: %v", event.Email, err)
+		return err
+	}
+	return nil
+}
+
+func (s *loginEventService) History(ctx context.Context, userID int64, query *model.PaginationQuery) (*model.Response, error) {
+	events, total, err := s.repo.ListByUser(ctx, userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(query.Limit)))
+	return &model.Response{
+		Message: "Login history retrieved successfully",
+		Data:    converter.ToLoginEventResponses(events),
+		Meta: &model.PaginatedMeta{
+			Total:       total,
+			CurrentPage: int64(query.Page),
+			PerPage:     int64(query.Limit),
+			LastPage:    totalPages,
+			HasNextPage: query.Page < totalPages,
+			HasPrevPage: query.Page > 1,
+		},
+	}, nil
+}
+
+func (s *loginEventService) ListByUser(ctx context.Context, userID int64) ([]*model.LoginEventResponse, error) {
+	events, _, err := s.repo.ListByUser(ctx, userID, &model.PaginationQuery{Page: 1, Limit: maxExportedLoginEvents})
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToLoginEventResponses(events), nil
+}
+
+// Purge deletes the events that fell out of the retention period
+func (s *loginEventService) Purge(ctx context.Context) (int64, error) {
+	purged, err := s.repo.PurgeBefore(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		return purged, err
+	}
+	if purged > 0 {
+		s.logger.Info("Purged %d login events older than %s", purged, s.retention)
+	}
+	return purged, nil
+}
+
+// RunRetention purges expired events every interval until ctx is done
+func (s *loginEventService) RunRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Purge(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warning("Login event purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
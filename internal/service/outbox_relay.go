@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/events"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+// maxOutboxErrorLength bounds the publisher error kept with a failed event
+const maxOutboxErrorLength = 1000
+
+type OutboxOptions struct {
+	// BatchSize is how many events one relay pass claims at most
+	BatchSize int
+	// Lease is how long a claimed event is reserved for the relay publishing it
+	Lease time.Duration
+	// RetryBase is the delay before the first retry, doubling with every failure up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// Retention is how long published events are kept
+	Retention time.Duration
+}
+
+// OutboxRelay publishes the events recorded in the outbox. Delivery is at least
+// once: an event is marked published only after the publisher accepted it, so a
+// crash in between publishes it again. Events of one aggregate are published in
+// the order they were recorded, a failing event holds back the ones after it.
+type OutboxRelay interface {
+	RelayPending(ctx context.Context) (int, error)
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type outboxRelay struct {
+	repo      repository.OutboxRepository
+	publisher events.Publisher
+	options   OutboxOptions
+	logger    *utils.Logger
+}
+
+func NewOutboxRelay(repo repository.OutboxRepository, publisher events.Publisher, options OutboxOptions, logger *utils.Logger) OutboxRelay {
+	return &outboxRelay{repo: repo, publisher: publisher, options: options, logger: logger}
+}
+
+// RelayPending publishes one batch of due events and returns how many were published
+func (r *outboxRelay) RelayPending(ctx context.Context) (int, error) {
+	now := time.Now()
+	claimed, err := r.repo.ClaimPending(ctx, r.options.BatchSize, now, now.Add(r.options.Lease))
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range claimed {
+		if err := r.publisher.Publish(ctx, toEvent(event)); err != nil {
+			retryAt := time.Now().Add(r.retryDelay(event.Attempts))
+			r.logger.Warning("Publishing event %d %s failed on attempt %d, retrying at %s: %v",
+				event.ID, event.EventType, event.Attempts, retryAt.Format(time.RFC3339), err)
+			if err := r.repo.MarkFailed(ctx, event.ID, retryAt, truncateRunes(err.Error(), maxOutboxErrorLength)); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := r.repo.MarkPublished(ctx, event.ID, time.Now()); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// Run relays events every interval until ctx is done. A full batch is followed
+// by another pass straight away, so a backlog drains without waiting.
+func (r *outboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		for ctx.Err() == nil {
+			published, err := r.RelayPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Warning("Outbox relay failed: %v", err)
+			}
+			if err != nil || published < r.options.BatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPurge) >= time.Hour {
+			purged, err := r.repo.PurgePublished(ctx, time.Now().Add(-r.options.Retention))
+			if err != nil && ctx.Err() == nil {
+				r.logger.Warning("Outbox purge failed: %v", err)
+			} else if purged > 0 {
+				r.logger.Info("Purged %d published outbox events", purged)
+			}
+			lastPurge = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// retryDelay backs off exponentially with the number of attempts made so far
+func (r *outboxRelay) retryDelay(attempts int) time.Duration {
+	delay := r.options.RetryBase
+	for i := 1; i < attempts && delay < r.options.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, r.options.RetryMax)
+}
+
+// LoadOutboxEvent returns a function reading a recorded event by ID, for
+// instances following the outbox through notifications instead of claiming
+func LoadOutboxEvent(repo repository.OutboxRepository) func(ctx context.Context, id int64) (events.Event, error) {
+	return func(ctx context.Context, id int64) (events.Event, error) {
+		event, err := repo.GetByID(ctx, id)
+		if err != nil {
+			return events.Event{}, err
+		}
+		return toEvent(event), nil
+	}
+}
+
+func toEvent(event *entity.OutboxEvent) events.Event {
+	return events.Event{
+		ID:            event.ID,
+		Type:          event.EventType,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Payload:       json.RawMessage(event.Payload),
+		OccurredAt:    event.CreatedAt,
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/events"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+func newTestLogger(t *testing.T) *utils.Logger {
+	t.Helper()
+	logger, err := utils.NewLogger(filepath.Join(t.TempDir(), "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(logger.Close)
+	return logger
+}
+
+// fakeOutboxRepository keeps events in memory and claims them the way the SQL
+// does: due, unpublished and only the oldest unpublished event of an aggregate
+type fakeOutboxRepository struct {
+	mu     sync.Mutex
+	events []*entity.OutboxEvent
+}
+
+func (r *fakeOutboxRepository) add(aggregateID int64, eventType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, &entity.OutboxEvent{
+		ID:            int64(len(r.events) + 1),
+		AggregateType: entity.AggregateUser,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       []byte(`{}`),
+		CreatedAt:     time.Now(),
+	})
+}
+
+func (r *fakeOutboxRepository) ClaimPending(_ context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	claimed := []*entity.OutboxEvent{}
+	blocked := map[int64]bool{}
+	for _, event := range r.events {
+		if event.PublishedAt != nil {
+			continue
+		}
+		if blocked[event.AggregateID] {
+			continue
+		}
+		blocked[event.AggregateID] = true
+		if event.AvailableAt.After(now) || len(claimed) == limit {
+			continue
+		}
+		event.AvailableAt = leaseUntil
+		event.Attempts++
+		copied := *event
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (r *fakeOutboxRepository) GetByID(_ context.Context, id int64) (*entity.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > int64(len(r.events)) {
+		return nil, sql.ErrNoRows
+	}
+	copied := *r.events[id-1]
+	return &copied, nil
+}
+
+func (r *fakeOutboxRepository) MarkPublished(_ context.Context, id int64, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].PublishedAt = &now
+	return nil
+}
+
+func (r *fakeOutboxRepository) MarkFailed(_ context.Context, id int64, retryAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].AvailableAt = retryAt
+	r.events[id-1].LastError = &lastError
+	return nil
+}
+
+func (r *fakeOutboxRepository) PurgePublished(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// makeDue lets events waiting for a retry be claimed again
+func (r *fakeOutboxRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range r.events {
+		event.AvailableAt = time.Time{}
+	}
+}
+
+// flakyPublisher fails the events in failing, then hands the rest to a MemoryPublisher
+type flakyPublisher struct {
+	*events.MemoryPublisher
+	failing map[int64]bool
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event events.Event) error {
+	if p.failing[event.ID] {
+		return errors.New("endpoint unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, event)
+}
+
+func TestOutboxRelayPublishesEachAggregateInOrder(t *testing.T) {
+	repo := &fakeOutboxRepository{}
+	repo.add(1, entity.EventUserCreated) // 1
+	repo.add(2, entity.EventUserCreated) // 2
+	repo.add(1, entity.EventUserUpdated) // 3
+	repo.add(2, entity.EventUserUpdated) // 4
+	repo.add(1, entity.EventUserDeleted) // 5
+
+	publisher := &flakyPublisher{MemoryPublisher: events.NewMemoryPublisher(), failing: map[int64]bool{3: true}}
+	relay := NewOutboxRelay(repo, publisher, OutboxOptions{BatchSize: 10, Lease: time.Minute, RetryBase: time.Second, RetryMax: time.Minute}, newTestLogger(t))
+	ctx := context.Background()
+
+	relayUntilIdle := func() {
+		for i := 0; i < 10; i++ {
+			repo.makeDue()
+			published, err := relay.RelayPending(ctx)
+			if err != nil {
+				t.Fatalf("RelayPending() = %v", err)
+			}
+			if published == 0 {
+				return
+			}
+		}
+	}
+
+	// Event 3 fails, so event 5 of the same user is held back while user 2 proceeds
+	relayUntilIdle()
+	if got := publishedIDs(publisher.Events()); fmt.Sprint(got) != "[1 2 4]" {
+		t.Fatalf("published %v while event 3 fails, want [1 2 4]", got)
+	}
+
+	delete(publisher.failing, 3)
+	relayUntilIdle()
+
+	perAggregate := map[int64][]int64{}
+	for _, event := range publisher.Events() {
+		perAggregate[event.AggregateID] = append(perAggregate[event.AggregateID], event.ID)
+	}
+	if got := fmt.Sprint(perAggregate[1]); got != "[1 3 5]" {
+		t.Errorf("user 1 events published as %s, want [1 3 5]", got)
+	}
+	if got := fmt.Sprint(perAggregate[2]); got != "[2 4]" {
+		t.Errorf("user 2 events published as %s, want [2 4]", got)
+	}
+}
+
+func TestOutboxRelayRetriesFailedEventsWithCappedBackoff(t *testing.T) {
+	repo := &fakeOutboxRepository{}
+	repo.add(1, entity.EventUserCreated)
+
+	options := OutboxOptions{BatchSize: 10, Lease: time.Minute, RetryBase: time.Second, RetryMax: 10 * time.Second}
+	publisher := &flakyPublisher{MemoryPublisher: events.NewMemoryPublisher(), failing: map[int64]bool{1: true}}
+	relay := NewOutboxRelay(repo, publisher, options, newTestLogger(t))
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for attempt, delay := range want {
+		repo.makeDue()
+		before := time.Now()
+		if _, err := relay.RelayPending(context.Background()); err != nil {
+			t.Fatalf("RelayPending() = %v", err)
+		}
+		after := time.Now()
+
+		event := repo.events[0]
+		if event.Attempts != attempt+1 || event.LastError == nil {
+			t.Fatalf("attempt %d: event has %d attempts, last error %v", attempt+1, event.Attempts, event.LastError)
+		}
+		if event.AvailableAt.Before(before.Add(delay)) || event.AvailableAt.After(after.Add(delay)) {
+			t.Errorf("attempt %d: retry scheduled %s after the attempt, want %s", attempt+1, event.AvailableAt.Sub(before), delay)
+		}
+	}
+	if len(publisher.Events()) != 0 {
+		t.Errorf("a failing event was recorded as published")
+	}
+}
+
+func TestOutboxRetryDelayNeverExceedsRetryMax(t *testing.T) {
+	relay := &outboxRelay{options: OutboxOptions{RetryBase: 3 * time.Second, RetryMax: time.Minute}}
+	for _, attempts := range []int{0, 1, 5, 6, 64, 1000} {
+		if delay := relay.retryDelay(attempts); delay <= 0 || delay > time.Minute {
+			t.Errorf("retryDelay(%d) = %s, want within (0, 1m]", attempts, delay)
+		}
+	}
+}
+
+func publishedIDs(published []events.Event) []int64 {
+	ids := make([]int64, len(published))
+	for i, event := range published {
+		ids[i] = event.ID
+	}
+	return ids
+}
@@ -0,0 +1,453 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Rafli-Dewanto/go-template/internal/auth"
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+var (
+	ErrUnsupportedImportFormat = errors.New("unsupported import format")
+	ErrInvalidImportMode       = errors.New("invalid import mode")
+	ErrInvalidImportHeader     = errors.New("csv header must contain username, email and password columns")
+)
+
+// errImportAborted rolls back an atomic import without being reported as a failure
+var errImportAborted = errors.New("import aborted")
+
+const (
+	defaultImportBatchSize  = 500
+	maxReportedImportErrors = 1000
+)
+
+type UserImportService interface {
+	Import(ctx context.Context, body io.Reader, options model.ImportOptions) (*model.ImportReport, error)
+}
+
+type userImportService struct {
+	repo        repository.UserRepository
+	historyRepo repository.UsernameHistoryRepository
+	transactor  repository.Transactor
+	auditor     AuditService
+	rules       UsernameRules
+	attributes  *utils.JSONSchema
+	logger      *utils.Logger
+}
+
+// NewUserImportService creates the service, attributes is the schema custom attributes of imported rows must match
+func NewUserImportService(repo repository.UserRepository, historyRepo repository.UsernameHistoryRepository, transactor repository.Transactor, auditor AuditService, rules UsernameRules, attributes *utils.JSONSchema, logger *utils.Logger) UserImportService {
+	return &userImportService{repo: repo, historyRepo: historyRepo, transactor: transactor, auditor: auditor, rules: rules, attributes: attributes, logger: logger}
+}
+
+type importRow struct {
+	line int
+	req  model.CreateUserRequest
+	user *entity.User
+}
+
+// importSeen remembers identifiers already used earlier in the same file
+type importSeen struct {
+	usernames map[string]int
+	emails    map[string]int
+}
+
+func (s *userImportService) Import(ctx context.Context, body io.Reader, options model.ImportOptions) (*model.ImportReport, error) {
+	options.Mode = utils.Default(options.Mode, model.ImportModeBestEffort)
+	if options.Mode != model.ImportModeAtomic && options.Mode != model.ImportModeBestEffort {
+		return nil, ErrInvalidImportMode
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultImportBatchSize
+	}
+
+	rows, err := newImportReader(body, options.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ImportReport{
+		Mode:   options.Mode,
+		DryRun: options.DryRun,
+		Errors: []model.ImportRowError{},
+	}
+	seen := &importSeen{usernames: map[string]int{}, emails: map[string]int{}}
+
+	run := func(ctx context.Context) error {
+		batch := make([]*importRow, 0, options.BatchSize)
+		for {
+			row, rowErr, err := rows.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			report.Total++
+			if rowErr != nil {
+				s.addRowError(report, *rowErr)
+				continue
+			}
+
+			batch = append(batch, row)
+			if len(batch) == options.BatchSize {
+				if err := s.processBatch(ctx, batch, seen, report, options); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+
+		if len(batch) > 0 {
+			if err := s.processBatch(ctx, batch, seen, report, options); err != nil {
+				return err
+			}
+		}
+
+		if options.Mode == model.ImportModeAtomic && report.Failed > 0 {
+			return errImportAborted
+		}
+		return nil
+	}
+
+	if options.Mode == model.ImportModeAtomic && !options.DryRun {
+		err = s.transactor.WithinTransaction(ctx, run)
+	} else {
+		err = run(ctx)
+	}
+
+	switch {
+	case errors.Is(err, errImportAborted):
+		report.Imported = 0
+	case err != nil:
+		s.logger.Error("User import failed after %d rows: %v", report.Total, err)
+		return nil, err
+	default:
+		report.Committed = !options.DryRun
+	}
+
+	slices.SortStableFunc(report.Errors, func(a, b model.ImportRowError) int {
+		return a.Line - b.Line
+	})
+
+	s.logger.Info("User import finished: mode=%s dry_run=%t total=%d imported=%d failed=%d",
+		report.Mode, report.DryRun, report.Total, report.Imported, report.Failed)
+	return report, nil
+}
+
+// processBatch validates a batch, checks it against earlier rows and existing users,
+// then hashes passwords and inserts whatever is left.
+func (s *userImportService) processBatch(ctx context.Context, batch []*importRow, seen *importSeen, report *model.ImportReport, options model.ImportOptions) error {
+	valid := make([]*importRow, 0, len(batch))
+	for _, row := range batch {
+		row.req.Username = utils.NormalizeIdentifier(row.req.Username)
+		row.req.Email = utils.NormalizeIdentifier(row.req.Email)
+		validationErrors := append(utils.ValidateStruct(row.req), s.attributes.Validate("attributes", utils.AttributesOrEmpty(row.req.Attributes))...)
+		if validationErrors != nil {
+			s.addRowError(report, model.ImportRowError{Line: row.line, Username: row.req.Username, Errors: validationErrors})
+			continue
+		}
+		if line, ok := seen.usernames[row.req.Username]; ok {
+			s.addRowError(report, rowError(row, "username", fmt.Sprintf("Duplicate of line %d", line)))
+			continue
+		}
+		if line, ok := seen.emails[row.req.Email]; ok {
+			s.addRowError(report, rowError(row, "email", fmt.Sprintf("Duplicate of line %d", line)))
+			continue
+		}
+		seen.usernames[row.req.Username] = row.line
+		seen.emails[row.req.Email] = row.line
+		valid = append(valid, row)
+	}
+
+	valid, err := s.withoutExisting(ctx, valid, report)
+	if err != nil {
+		return err
+	}
+
+	// Nothing will be written: dry runs only report, atomic imports are already doomed
+	if options.DryRun || (options.Mode == model.ImportModeAtomic && report.Failed > 0) {
+		report.Imported += len(valid)
+		return nil
+	}
+
+	if err := hashImportPasswords(valid); err != nil {
+		return err
+	}
+
+	users := make([]*entity.User, len(valid))
+	usernames := make([]string, len(valid))
+	for i, row := range valid {
+		users[i] = row.user
+		usernames[i] = row.user.Username
+	}
+
+	// COPY does not return the new IDs, so the batch is audited as a whole
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.CreateBatch(ctx, users); err != nil {
+			return err
+		}
+		return s.auditor.Record(ctx, entity.AuditActionUserImport, nil, nil, map[string]any{"usernames": usernames})
+	})
+	if err == nil {
+		report.Imported += len(users)
+		return nil
+	}
+	if options.Mode == model.ImportModeAtomic {
+		return err
+	}
+
+	// A concurrent signup can still make COPY hit a unique constraint,
+	// so retry the batch row by row to pin down the offending rows.
+	s.logger.Warning("User import batch failed, retrying row by row: %v", err)
+	for _, row := range valid {
+		err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := s.repo.Create(ctx, row.user); err != nil {
+				return err
+			}
+			return s.auditor.Record(ctx, entity.AuditActionUserImport, &row.user.ID, nil, row.user)
+		})
+		if errors.Is(err, repository.ErrUserExists) {
+			s.addRowError(report, rowError(row, "row", "Username or email already exists"))
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			s.logger.Error("Failed to import user %s: %v", row.user.Username, err)
+			s.addRowError(report, rowError(row, "row", "Internal error, the row was not imported"))
+			continue
+		}
+		report.Imported++
+	}
+	return nil
+}
+
+// withoutExisting drops rows whose username or email is already taken in the
+// database, and rows claiming a reserved or recently released username
+func (s *userImportService) withoutExisting(ctx context.Context, rows []*importRow, report *model.ImportReport) ([]*importRow, error) {
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	usernames := make([]string, len(rows))
+	emails := make([]string, len(rows))
+	for i, row := range rows {
+		usernames[i] = row.req.Username
+		emails[i] = row.req.Email
+	}
+
+	existing, err := s.repo.FindByUsernamesOrEmails(ctx, usernames, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	holds, err := s.historyRepo.FindHolds(ctx, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	takenUsernames := make(map[string]bool, len(existing))
+	takenEmails := make(map[string]bool, len(existing))
+	for _, user := range existing {
+		takenUsernames[utils.NormalizeIdentifier(user.Username)] = true
+		takenEmails[utils.NormalizeIdentifier(user.Email)] = true
+	}
+	heldUsernames := make(map[string]bool, len(holds))
+	for _, hold := range holds {
+		heldUsernames[utils.NormalizeIdentifier(hold.Username)] = true
+	}
+
+	remaining := rows[:0]
+	for _, row := range rows {
+		switch {
+		case s.rules.IsReserved(row.req.Username):
+			s.addRowError(report, rowError(row, "username", "Username is reserved"))
+		case takenUsernames[row.req.Username]:
+			s.addRowError(report, rowError(row, "username", "Username already exists"))
+		case heldUsernames[row.req.Username]:
+			s.addRowError(report, rowError(row, "username", "Username was recently released and cannot be claimed yet"))
+		case takenEmails[row.req.Email]:
+			s.addRowError(report, rowError(row, "email", "Email already exists"))
+		default:
+			remaining = append(remaining, row)
+		}
+	}
+	return remaining, nil
+}
+
+func (s *userImportService) addRowError(report *model.ImportReport, rowErr model.ImportRowError) {
+	report.Failed++
+	if len(report.Errors) >= maxReportedImportErrors {
+		report.ErrorsTruncated = true
+		return
+	}
+	report.Errors = append(report.Errors, rowErr)
+}
+
+func rowError(row *importRow, field string, message string) model.ImportRowError {
+	return model.ImportRowError{
+		Line:     row.line,
+		Username: row.req.Username,
+		Errors:   []utils.ValidationError{{Field: field, Error: message}},
+	}
+}
+
+// hashImportPasswords hashes passwords on all cores, bcrypt dominates import time
+func hashImportPasswords(rows []*importRow) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, runtime.NumCPU())
+
+	for _, row := range rows {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(row *importRow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			hashed, err := auth.HashPassword(row.req.Password)
+			if err != nil {
+				once.Do(func() { firstErr = fmt.Errorf("failed to hash password on line %d: %w", row.line, err) })
+				return
+			}
+			attributes, err := converter.FromAttributes(row.req.Attributes)
+			if err != nil {
+				once.Do(func() { firstErr = fmt.Errorf("failed to encode attributes on line %d: %w", row.line, err) })
+				return
+			}
+			row.user = &entity.User{
+				Username:   row.req.Username,
+				Email:      row.req.Email,
+				Password:   hashed,
+				Attributes: attributes,
+			}
+		}(row)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// importReader yields rows one at a time. A malformed row is returned as a row
+// error, io.EOF marks the end and any other error aborts the import.
+type importReader interface {
+	next() (*importRow, *model.ImportRowError, error)
+}
+
+func newImportReader(body io.Reader, format string) (importReader, error) {
+	switch format {
+	case model.ImportFormatCSV:
+		return newCSVImportReader(body)
+	case model.ImportFormatJSONL:
+		return &jsonlImportReader{reader: bufio.NewReader(body)}, nil
+	default:
+		return nil, ErrUnsupportedImportFormat
+	}
+}
+
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVImportReader(body io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrInvalidImportHeader
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"username", "email", "password"} {
+		if _, ok := columns[required]; !ok {
+			return nil, ErrInvalidImportHeader
+		}
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvImportReader) next() (*importRow, *model.ImportRowError, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &model.ImportRowError{
+				Line:   parseErr.StartLine,
+				Errors: []utils.ValidationError{{Field: "row", Error: parseErr.Err.Error()}},
+			}, nil
+		}
+		return nil, nil, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	field := func(name string) string {
+		if i := r.columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	return &importRow{
+		line: line,
+		req: model.CreateUserRequest{
+			Username: field("username"),
+			Email:    field("email"),
+			Password: field("password"),
+		},
+	}, nil, nil
+}
+
+type jsonlImportReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (r *jsonlImportReader) next() (*importRow, *model.ImportRowError, error) {
+	for {
+		data, err := r.reader.ReadBytes('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && len(data) > 0) {
+			return nil, nil, err
+		}
+		r.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		row := &importRow{line: r.line}
+		if err := json.Unmarshal(data, &row.req); err != nil {
+			return nil, &model.ImportRowError{
+				Line:   r.line,
+				Errors: []utils.ValidationError{{Field: "row", Error: "Invalid JSON object"}},
+			}, nil
+		}
+		return row, nil, nil
+	}
+}
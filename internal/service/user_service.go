@@ -20,33 +20,88 @@ var (
 	ErrRequestTimeout       = errors.New("request timeout")
 	ErrUsernameAlreadyTaken = errors.New("username already taken")
 	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrVersionMismatch      = errors.New("user has been modified since it was read")
+
+	ErrEmailChangeRequiresConfirmation = errors.New("email changes must be confirmed by the new address")
+	ErrUsernameReserved                = errors.New("username is reserved")
+	ErrUsernameOnHold                  = errors.New("username was recently released and cannot be claimed yet")
 )
 
+// UsernameRules restricts which usernames can be claimed
+type UsernameRules struct {
+	Reserved []string
+	// ReleaseCooldown is how long a username given up by a rename stays held for its former owner
+	ReleaseCooldown time.Duration
+}
+
+func (r UsernameRules) IsReserved(username string) bool {
+	username = utils.NormalizeIdentifier(username)
+	for _, reserved := range r.Reserved {
+		if utils.NormalizeIdentifier(reserved) == username {
+			return true
+		}
+	}
+	return false
+}
+
 type UserService interface {
 	Create(ctx context.Context, user *model.CreateUserRequest) error
+	SignUp(ctx context.Context, user *model.CreateUserRequest) error
 	GetByID(ctx context.Context, id int64) (*model.UserResponse, error)
+	GetByIDs(ctx context.Context, ids []int64) (*model.UserBatchResponse, error)
 	GetByEmail(ctx context.Context, email string) (*entity.User, error)
-	List(ctx context.Context, query *model.PaginationQuery) (*model.Response, error)
-	Update(ctx context.Context, user model.UpdateUserRequest) error
+	List(ctx context.Context, query *model.PaginationQuery, filter *model.UserFilter) (*model.Response, error)
+	ListByCursor(ctx context.Context, query *model.CursorQuery, filter *model.UserFilter) (*model.Response, error)
+	Search(ctx context.Context, query *model.UserSearchQuery) ([]*model.UserSearchResult, error)
+	Export(ctx context.Context, filter *model.UserFilter, fn func(user *model.UserResponse) error) error
+	Update(ctx context.Context, user model.UpdateUserRequest) (*model.UserResponse, error)
 	SoftDelete(ctx context.Context, id int64) error
+	IdentifierReport(ctx context.Context) (*model.IdentifierReport, error)
+	ResolveUsername(ctx context.Context, username string) (*model.UserResponse, bool, error)
+	UsernameHistory(ctx context.Context, userID int64) ([]*model.UsernameHistoryResponse, error)
 }
 
 type userService struct {
-	repo   repository.UserRepository
-	logger *utils.Logger
+	repo              repository.UserRepository
+	historyRepo       repository.UsernameHistoryRepository
+	transactor        repository.Transactor
+	auditor           AuditService
+	rules             UsernameRules
+	requireActivation bool
+	logger            *utils.Logger
 }
 
-func NewUserService(repo repository.UserRepository, logger *utils.Logger) UserService {
-	return &userService{repo: repo, logger: logger}
+// NewUserService creates self-registered users pending when requireActivation
+// is set, otherwise active like users created by an administrator
+func NewUserService(repo repository.UserRepository, historyRepo repository.UsernameHistoryRepository, transactor repository.Transactor, auditor AuditService, rules UsernameRules, requireActivation bool, logger *utils.Logger) UserService {
+	return &userService{repo: repo, historyRepo: historyRepo, transactor: transactor, auditor: auditor, rules: rules, requireActivation: requireActivation, logger: logger}
 }
 
 func (s *userService) Create(ctx context.Context, user *model.CreateUserRequest) error {
+	return s.create(ctx, user, entity.UserStatusActive)
+}
+
+// SignUp creates a user registering themselves. With activation required the
+// account stays pending, and cannot sign in, until an administrator activates it.
+func (s *userService) SignUp(ctx context.Context, user *model.CreateUserRequest) error {
+	if s.requireActivation {
+		return s.create(ctx, user, entity.UserStatusPending)
+	}
+	return s.create(ctx, user, entity.UserStatusActive)
+}
+
+func (s *userService) create(ctx context.Context, user *model.CreateUserRequest, status string) error {
 	if ctx.Err() != nil {
 		s.logger.Warning("Request timeout: operation took longer than 10 seconds")
 		return ErrRequestTimeout
 	}
 
-	if user.Username == "" || user.Email == "" {
+	// Identifiers are stored normalized so lookups and uniqueness ignore case and width
+	user.Username = utils.NormalizeIdentifier(user.Username)
+	user.Email = utils.NormalizeIdentifier(user.Email)
+
+	// Checked here as well as by the request validation, so no write path skips it
+	if user.Username == "" || user.Email == "" || !utils.IsSafeUsername(user.Username) {
 		s.logger.Warning("Invalid input for user creation: %v", ErrInvalidInput)
 		return ErrInvalidInput
 	}
@@ -63,20 +118,40 @@ func (s *userService) Create(ctx context.Context, user *model.CreateUserRequest)
 		return ErrUserAlreadyExists
 	}
 
+	if err := s.checkUsernameAvailable(ctx, user.Username, 0); err != nil {
+		return err
+	}
+
+	attributes, err := converter.FromAttributes(user.Attributes)
+	if err != nil {
+		return err
+	}
+
 	newUser := &entity.User{
-		Username:  user.Username,
-		Email:     user.Email,
-		Password:  user.Password,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Username:   user.Username,
+		Email:      user.Email,
+		Password:   user.Password,
+		Attributes: attributes,
+		Status:     status,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
 	}
 
 	// Insert user into DB
-	err = s.repo.Create(ctx, newUser)
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, newUser); err != nil {
+			return err
+		}
+		return s.auditor.Record(ctx, entity.AuditActionUserCreate, &newUser.ID, nil, newUser)
+	})
 	if err == context.DeadlineExceeded || err == context.Canceled {
 		s.logger.Warning("Database insert timed out")
 		return ErrRequestTimeout
 	}
+	// A concurrent signup may have taken the identifiers since they were checked
+	if errors.Is(err, repository.ErrUserExists) {
+		return ErrUserAlreadyExists
+	}
 	if err != nil {
 		return err
 	}
@@ -90,7 +165,7 @@ func (s *userService) GetByEmail(ctx context.Context, email string) (*entity.Use
 		return nil, ErrInvalidInput
 	}
 
-	user, err := s.repo.GetByEmailOrUsername(ctx, email, "")
+	user, err := s.repo.GetByEmailOrUsername(ctx, utils.NormalizeIdentifier(email), "")
 	if err != nil {
 		s.logger.Warning("User not found: %v", ErrUserNotFound)
 		return nil, ErrInvalidCredentials
@@ -113,12 +188,49 @@ func (s *userService) GetByID(ctx context.Context, id int64) (*model.UserRespons
 	return converter.ToUserResponse(user), nil
 }
 
-func (s *userService) List(ctx context.Context, query *model.PaginationQuery) (*model.Response, error) {
+// GetByIDs looks up many users in one query. Users come back in the order their
+// IDs were first requested, IDs that matched no user are listed as missing.
+func (s *userService) GetByIDs(ctx context.Context, ids []int64) (*model.UserBatchResponse, error) {
+	unique := make([]int64, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	users, err := s.repo.GetByIDs(ctx, unique)
+	if err != nil {
+		s.logger.Warning("Failed to get users by IDs: %v", err)
+		return nil, err
+	}
+
+	byID := make(map[int64]*entity.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	response := &model.UserBatchResponse{
+		Users:   make([]*model.UserResponse, 0, len(users)),
+		Missing: []int64{},
+	}
+	for _, id := range unique {
+		if user, ok := byID[id]; ok {
+			response.Users = append(response.Users, converter.ToUserResponse(user))
+		} else {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+	return response, nil
+}
+
+func (s *userService) List(ctx context.Context, query *model.PaginationQuery, filter *model.UserFilter) (*model.Response, error) {
 	if query.Limit <= 0 {
 		query.Limit = 10
 	}
 
-	users, total, err := s.repo.List(ctx, query)
+	users, total, err := s.repo.List(ctx, query, filter)
 	if err != nil {
 		s.logger.Warning("Failed to list users: %v", err)
 		return nil, err
@@ -144,45 +256,209 @@ func (s *userService) List(ctx context.Context, query *model.PaginationQuery) (*
 	}, nil
 }
 
-func (s *userService) Update(ctx context.Context, user model.UpdateUserRequest) error {
+func (s *userService) ListByCursor(ctx context.Context, query *model.CursorQuery, filter *model.UserFilter) (*model.Response, error) {
+	if query.Limit <= 0 {
+		query.Limit = 10
+	}
+
+	var cursor *model.Cursor
+	if query.Cursor != "" {
+		decoded, err := model.DecodeCursor(query.Cursor)
+		if err != nil || decoded.Field != query.Sort.Field || decoded.Desc != query.Sort.Desc {
+			s.logger.Warning("Invalid cursor for user list: %v", model.ErrInvalidCursor)
+			return nil, model.ErrInvalidCursor
+		}
+		cursor = decoded
+	}
+
+	users, total, err := s.repo.ListByCursor(ctx, filter, cursor, query.Sort, query.Limit, query.WithTotal)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidCursor) {
+			return nil, err
+		}
+		s.logger.Warning("Failed to list users: %v", err)
+		return nil, err
+	}
+
+	// The repository reads one row past the page to learn whether more exist
+	backward := cursor != nil && cursor.Backward
+	hasMore := len(users) > query.Limit
+	if hasMore {
+		if backward {
+			users = users[1:]
+		} else {
+			users = users[:query.Limit]
+		}
+	}
+
+	meta := &model.CursorMeta{PerPage: int64(query.Limit), Total: total}
+	if len(users) > 0 {
+		// Moving forward there is a next page if we over-read and a previous one if we
+		// started from a cursor, and the other way round when moving backward.
+		if backward || hasMore {
+			next := newUserCursor(users[len(users)-1], query.Sort, false).Encode()
+			meta.NextCursor = &next
+		}
+		if (backward && hasMore) || (!backward && cursor != nil) {
+			prev := newUserCursor(users[0], query.Sort, true).Encode()
+			meta.PrevCursor = &prev
+		}
+	}
+
+	userResponses := make([]*model.UserResponse, len(users))
+	for i, user := range users {
+		userResponses[i] = converter.ToUserResponse(user)
+	}
+
+	return &model.Response{
+		Message: "Users retrieved successfully",
+		Data:    userResponses,
+		Meta:    meta,
+	}, nil
+}
+
+func newUserCursor(user *entity.User, sort model.SortField, backward bool) *model.Cursor {
+	cursor := &model.Cursor{Field: sort.Field, Desc: sort.Desc, ID: user.ID, Backward: backward}
+	switch sort.Field {
+	case "username":
+		cursor.Value = user.Username
+	case "email":
+		cursor.Value = user.Email
+	case "created_at":
+		cursor.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = user.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+func (s *userService) Search(ctx context.Context, query *model.UserSearchQuery) ([]*model.UserSearchResult, error) {
+	if query.Query == "" {
+		s.logger.Warning("Invalid input for user search: %v", ErrInvalidInput)
+		return nil, ErrInvalidInput
+	}
+
+	results, err := s.repo.Search(ctx, query.Query, query.Limit)
+	if err != nil {
+		s.logger.Warning("Failed to search users: %v", err)
+		return nil, err
+	}
+
+	return converter.ToUserSearchResults(results), nil
+}
+
+func (s *userService) Export(ctx context.Context, filter *model.UserFilter, fn func(user *model.UserResponse) error) error {
+	err := s.repo.Stream(ctx, filter, func(user *entity.User) error {
+		return fn(converter.ToUserResponse(user))
+	})
+	if err != nil {
+		s.logger.Warning("Failed to export users: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *userService) Update(ctx context.Context, user model.UpdateUserRequest) (*model.UserResponse, error) {
 	if user.ID <= 0 {
 		s.logger.Warning("Invalid input for user update: %v", ErrInvalidInput)
-		return ErrInvalidInput
+		return nil, ErrInvalidInput
 	}
 
 	existingUser, err := s.repo.GetByID(ctx, user.ID)
 	if err != nil {
 		s.logger.Warning("User not found: %v", ErrUserNotFound)
-		return err
+		return nil, err
 	}
 
-	updatedUser := &entity.User{
-		ID:       user.ID,
-		Username: existingUser.Username,
-		Email:    existingUser.Email,
+	if user.Version != 0 && user.Version != existingUser.Version {
+		s.logger.Warning("Stale update of user %d: have version %d, current is %d", user.ID, user.Version, existingUser.Version)
+		return nil, ErrVersionMismatch
 	}
 
+	// Start from the stored row so fields the request cannot change, like
+	// the password and status, are kept and not audited as changes
+	updated := *existingUser
+	updatedUser := &updated
+
 	// Update username if provided
+	renamed := false
 	if user.Username != nil {
-		// Check if new username is already taken
-		_, err := s.repo.GetByUsername(ctx, *user.Username)
-		if err == nil {
+		username := utils.NormalizeIdentifier(*user.Username)
+		if !utils.IsSafeUsername(username) {
+			s.logger.Warning("Invalid input for user update: %v", ErrInvalidInput)
+			return nil, ErrInvalidInput
+		}
+		// Check if new username is already taken, changing only its case is not a clash
+		owner, err := s.repo.GetByUsername(ctx, username)
+		if err == nil && owner.ID != user.ID {
 			s.logger.Warning("Username is already taken: %v", ErrUsernameAlreadyTaken)
-			return ErrUsernameAlreadyTaken
+			return nil, ErrUsernameAlreadyTaken
+		}
+		renamed = username != utils.NormalizeIdentifier(existingUser.Username)
+		if renamed {
+			if err := s.checkUsernameAvailable(ctx, username, user.ID); err != nil {
+				return nil, err
+			}
 		}
-		updatedUser.Username = *user.Username
+		updatedUser.Username = username
+	}
+
+	// Email changes go through EmailChangeService so the new address gets confirmed
+	if user.Email != nil && utils.NormalizeIdentifier(*user.Email) != utils.NormalizeIdentifier(existingUser.Email) {
+		s.logger.Warning("Unconfirmed email change rejected for user %d", user.ID)
+		return nil, ErrEmailChangeRequiresConfirmation
 	}
 
-	// Update email if provided
-	if user.Email != nil {
-		updatedUser.Email = *user.Email
+	// Update profile fields if provided
+	if user.DisplayName != nil {
+		updatedUser.DisplayName = *user.DisplayName
+	}
+	if user.Bio != nil {
+		updatedUser.Bio = *user.Bio
+	}
+	if user.Locale != nil {
+		updatedUser.Locale = *user.Locale
+	}
+	if user.Timezone != nil {
+		updatedUser.Timezone = *user.Timezone
+	}
+	if user.AvatarURL != nil {
+		updatedUser.AvatarURL = *user.AvatarURL
+	}
+	if user.Attributes != nil {
+		if updatedUser.Attributes, err = converter.FromAttributes(user.Attributes); err != nil {
+			return nil, err
+		}
 	}
 
-	err = s.repo.Update(ctx, updatedUser)
+	// The old username is recorded with the rename so it is held from that moment on
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, updatedUser); err != nil {
+			return err
+		}
+		if renamed {
+			err := s.historyRepo.Create(ctx, &entity.UsernameHistory{
+				UserID:        user.ID,
+				Username:      existingUser.Username,
+				ReleasedUntil: time.Now().Add(s.rules.ReleaseCooldown),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return s.auditor.Record(ctx, entity.AuditActionUserUpdate, &user.ID, existingUser, updatedUser)
+	})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, ErrVersionMismatch
+	}
+	// The email cannot change here, so a concurrent rename took the username
+	if errors.Is(err, repository.ErrUserExists) {
+		return nil, ErrUsernameAlreadyTaken
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return converter.ToUserResponse(updatedUser), nil
 }
 
 func (s *userService) SoftDelete(ctx context.Context, id int64) error {
@@ -190,11 +466,124 @@ func (s *userService) SoftDelete(ctx context.Context, id int64) error {
 		return ErrInvalidInput
 	}
 
-	_, err := s.repo.GetByID(ctx, id)
+	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		s.logger.Warning("User not found: %v", ErrUserNotFound)
 		return err
 	}
 
-	return s.repo.SoftDelete(ctx, id)
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.SoftDelete(ctx, id); err != nil {
+			return err
+		}
+		deleted := *user
+		now := time.Now()
+		deleted.DeletedAt = &now
+		return s.auditor.Record(ctx, entity.AuditActionUserDelete, &id, user, &deleted)
+	})
+}
+
+// checkUsernameAvailable rejects reserved usernames and names another user gave
+// up within the cooldown. Former owners, identified by userID, may take theirs back.
+func (s *userService) checkUsernameAvailable(ctx context.Context, username string, userID int64) error {
+	if s.rules.IsReserved(username) {
+		s.logger.Warning("Reserved username rejected: %s", username)
+		return ErrUsernameReserved
+	}
+
+	holds, err := s.historyRepo.FindHolds(ctx, []string{username})
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if hold.UserID != userID {
+			s.logger.Warning("Username %s is held for user %d until %s", username, hold.UserID, hold.ReleasedUntil)
+			return ErrUsernameOnHold
+		}
+	}
+	return nil
+}
+
+// ResolveUsername finds the user currently holding username or, failing that, the
+// last user to give it up. The boolean reports whether the user was found by a
+// former username.
+func (s *userService) ResolveUsername(ctx context.Context, username string) (*model.UserResponse, bool, error) {
+	username = utils.NormalizeIdentifier(username)
+	user, err := s.repo.GetByUsername(ctx, username)
+	if err == nil && user.DeletedAt == nil {
+		return converter.ToUserResponse(user), false, nil
+	}
+
+	entry, err := s.historyRepo.GetLatestByUsername(ctx, username)
+	if err != nil {
+		return nil, false, err
+	}
+	if entry == nil {
+		return nil, false, ErrUserNotFound
+	}
+
+	user, err = s.repo.GetByID(ctx, entry.UserID)
+	if err != nil || user.DeletedAt != nil {
+		return nil, false, ErrUserNotFound
+	}
+	return converter.ToUserResponse(user), true, nil
+}
+
+func (s *userService) UsernameHistory(ctx context.Context, userID int64) ([]*model.UsernameHistoryResponse, error) {
+	entries, err := s.historyRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToUsernameHistoryResponses(entries), nil
+}
+
+// IdentifierReport scans every user, deleted ones included, for usernames and
+// emails that collide once normalized and for usernames IsSafeUsername rejects.
+// Conflicts must be resolved before the case-insensitive unique indexes can be built.
+func (s *userService) IdentifierReport(ctx context.Context) (*model.IdentifierReport, error) {
+	report := &model.IdentifierReport{
+		Conflicts:           []*model.IdentifierConflict{},
+		ConfusableUsernames: []*model.UserResponse{},
+	}
+	usernames := map[string][]*model.UserResponse{}
+	emails := map[string][]*model.UserResponse{}
+	var usernameKeys, emailKeys []string
+
+	filter := &model.UserFilter{Deleted: model.DeletedInclude}
+	err := s.repo.Stream(ctx, filter, func(user *entity.User) error {
+		response := converter.ToUserResponse(user)
+
+		username := utils.NormalizeIdentifier(user.Username)
+		if _, ok := usernames[username]; !ok {
+			usernameKeys = append(usernameKeys, username)
+		}
+		usernames[username] = append(usernames[username], response)
+
+		email := utils.NormalizeIdentifier(user.Email)
+		if _, ok := emails[email]; !ok {
+			emailKeys = append(emailKeys, email)
+		}
+		emails[email] = append(emails[email], response)
+
+		if !utils.IsSafeUsername(username) {
+			report.ConfusableUsernames = append(report.ConfusableUsernames, response)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to scan users for identifier conflicts: %v", err)
+		return nil, err
+	}
+
+	for _, key := range usernameKeys {
+		if len(usernames[key]) > 1 {
+			report.Conflicts = append(report.Conflicts, &model.IdentifierConflict{Field: "username", Value: key, Users: usernames[key]})
+		}
+	}
+	for _, key := range emailKeys {
+		if len(emails[key]) > 1 {
+			report.Conflicts = append(report.Conflicts, &model.IdentifierConflict{Field: "email", Value: key, Users: emails[key]})
+		}
+	}
+	return report, nil
 }
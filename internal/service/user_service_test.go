@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+)
+
+// updateUserRepository serves a single stored user and bumps its version on update
+type updateUserRepository struct {
+	repository.UserRepository
+	user *entity.User
+}
+
+func (r *updateUserRepository) GetByID(_ context.Context, id int64) (*entity.User, error) {
+	if id != r.user.ID {
+		return nil, sql.ErrNoRows
+	}
+	stored := *r.user
+	return &stored, nil
+}
+
+func (r *updateUserRepository) Update(_ context.Context, user *entity.User) error {
+	user.Version++
+	user.UpdatedAt = time.Now()
+	stored := *user
+	r.user = &stored
+	return nil
+}
+
+type inlineTransactor struct{}
+
+func (inlineTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// capturingAuditRepository keeps the entries it is asked to store
+type capturingAuditRepository struct {
+	repository.AuditRepository
+	entries []*entity.AuditLog
+}
+
+func (r *capturingAuditRepository) Create(_ context.Context, entry *entity.AuditLog) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestUpdateAuditsOnlyTheChangedFields(t *testing.T) {
+	lastLogin := time.Now().Add(-time.Hour)
+	avatarKey := "avatars/1.png"
+	repo := &updateUserRepository{user: &entity.User{
+		ID:          1,
+		Username:    "alice",
+		Email:       "alice@example.com",
+		Password:    "hashed",
+		Bio:         "before",
+		AvatarKey:   &avatarKey,
+		Status:      entity.UserStatusActive,
+		Version:     3,
+		LastLoginAt: &lastLogin,
+		CreatedAt:   time.Now().Add(-24 * time.Hour),
+	}}
+	audits := &capturingAuditRepository{}
+	logger := newTestLogger(t)
+	svc := NewUserService(repo, nil, inlineTransactor{}, NewAuditService(audits, logger), UsernameRules{}, false, logger)
+
+	bio := "after"
+	resp, err := svc.Update(context.Background(), model.UpdateUserRequest{ID: 1, Bio: &bio})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(audits.entries) != 1 {
+		t.Fatalf("recorded %d audit entries, want 1", len(audits.entries))
+	}
+	var changes map[string]model.FieldChange
+	if err := json.Unmarshal(audits.entries[0].Changes, &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes["bio"].Before != "before" || changes["bio"].After != "after" {
+		t.Errorf("audited changes %s, want only the bio", audits.entries[0].Changes)
+	}
+
+	if resp.Status != entity.UserStatusActive || resp.Bio != "after" {
+		t.Errorf("response status %q bio %q, want the stored status and the new bio", resp.Status, resp.Bio)
+	}
+	if repo.user.Password != "hashed" || repo.user.AvatarKey == nil || repo.user.LastLoginAt == nil {
+		t.Errorf("update cleared fields it was not asked to change: %+v", repo.user)
+	}
+}
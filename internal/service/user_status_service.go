@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+var (
+	ErrInvalidStatusTransition = errors.New("status transition is not allowed")
+	ErrStatusConflict          = errors.New("user status changed since it was read")
+	ErrAccountSuspended        = errors.New("account is suspended")
+	ErrAccountBanned           = errors.New("account is banned")
+	ErrAccountPending          = errors.New("account is awaiting activation")
+)
+
+type UserStatusService interface {
+	Transition(ctx context.Context, userID int64, actorID *int64, req *model.UserStatusTransitionRequest) (*model.UserStatusTransitionResponse, error)
+	ListTransitions(ctx context.Context, userID int64) ([]*model.UserStatusTransitionResponse, error)
+	CheckCanAuthenticate(ctx context.Context, userID int64) error
+}
+
+type userStatusService struct {
+	repo       repository.UserStatusRepository
+	userRepo   repository.UserRepository
+	transactor repository.Transactor
+	auditor    AuditService
+	logger     *utils.Logger
+}
+
+func NewUserStatusService(repo repository.UserStatusRepository, userRepo repository.UserRepository, transactor repository.Transactor, auditor AuditService, logger *utils.Logger) UserStatusService {
+	return &userStatusService{repo: repo, userRepo: userRepo, transactor: transactor, auditor: auditor, logger: logger}
+}
+
+// AccountStatusError returns the error refusing authentication to a user in status, or nil
+func AccountStatusError(status string) error {
+	switch status {
+	case entity.UserStatusSuspended:
+		return ErrAccountSuspended
+	case entity.UserStatusBanned:
+		return ErrAccountBanned
+	case entity.UserStatusPending:
+		return ErrAccountPending
+	default:
+		return nil
+	}
+}
+
+// Transition moves a user to another status if the lifecycle allows it. actorID
+// is the user making the change, nil when the system makes it.
+func (s *userStatusService) Transition(ctx context.Context, userID int64, actorID *int64, req *model.UserStatusTransitionRequest) (*model.UserStatusTransitionResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil || user.DeletedAt != nil {
+		s.logger.Warning("User not found: %v", ErrUserNotFound)
+		return nil, ErrUserNotFound
+	}
+
+	if !entity.CanTransitionUserStatus(user.Status, req.Status) {
+		s.logger.Warning("Status transition of user %d from %s to %s rejected", userID, user.Status, req.Status)
+		return nil, ErrInvalidStatusTransition
+	}
+
+	transition := &entity.UserStatusTransition{
+		UserID:     userID,
+		FromStatus: user.Status,
+		ToStatus:   req.Status,
+		Reason:     req.Reason,
+		ActorID:    actorID,
+	}
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Transition(ctx, transition); err != nil {
+			return err
+		}
+		updated := *user
+		updated.Status = transition.ToStatus
+		return s.auditor.Record(ctx, entity.AuditActionStatusChange, &userID, user, &updated)
+	})
+	if errors.Is(err, repository.ErrStatusConflict) {
+		return nil, ErrStatusConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("User %d moved from %s to %s", userID, transition.FromStatus, transition.ToStatus)
+	return converter.ToUserStatusTransitionResponse(transition), nil
+}
+
+func (s *userStatusService) ListTransitions(ctx context.Context, userID int64) ([]*model.UserStatusTransitionResponse, error) {
+	transitions, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToUserStatusTransitionResponses(transitions), nil
+}
+
+// CheckCanAuthenticate refuses users whose status does not allow them to sign in
+// or use a token issued earlier. Only a missing or deleted user is ErrUserNotFound,
+// other errors are the repository's and do not say anything about the token.
+func (s *userStatusService) CheckCanAuthenticate(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		s.logger.Error("Failed to load user %d to authenticate: %v", userID, err)
+		return err
+	}
+	if user.DeletedAt != nil {
+		return ErrUserNotFound
+	}
+	return AccountStatusError(user.Status)
+}
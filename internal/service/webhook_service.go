@@ -0,0 +1,394 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/events"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/model/converter"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+	"github.com/Rafli-Dewanto/go-template/internal/webhook"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	// maxWebhookErrorLength bounds the error kept with a failed delivery
+	maxWebhookErrorLength = 1000
+	webhookSecretPrefix   = "whsec_"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrWebhookInactive         = errors.New("webhook is not active")
+	ErrWebhookDeliveryInFlight = errors.New("webhook delivery is already scheduled")
+)
+
+type WebhookOptions struct {
+	// BatchSize is how many deliveries one pass sends at most, concurrently
+	BatchSize int
+	// Lease is how long a claimed delivery is reserved for the worker sending it
+	Lease time.Duration
+	// MaxAttempts is how often a delivery is tried before it is given up
+	MaxAttempts int
+	// RetryBase is the delay before the first retry, doubling with every failure
+	// up to RetryMax. Each delay is jittered down by up to half.
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// DisableAfter consecutive failed attempts disable an endpoint, 0 never does
+	DisableAfter int
+}
+
+// WebhookService manages webhook subscriptions and delivers events to them. It
+// is an events.Publisher: publishing an event queues a delivery per matching
+// subscription, which DeliverDue then sends signed with the subscription secret.
+type WebhookService interface {
+	events.Publisher
+
+	Create(ctx context.Context, req *model.CreateWebhookRequest, actorID *int64) (*model.WebhookCreatedResponse, error)
+	GetByID(ctx context.Context, id int64) (*model.WebhookResponse, error)
+	List(ctx context.Context) ([]*model.WebhookResponse, error)
+	Update(ctx context.Context, id int64, req *model.UpdateWebhookRequest) (*model.WebhookResponse, error)
+	Delete(ctx context.Context, id int64) error
+	ListDeliveries(ctx context.Context, id int64, status string, query *model.PaginationQuery) (*model.Response, error)
+	Redeliver(ctx context.Context, id int64, deliveryID int64) (*model.WebhookDeliveryResponse, error)
+
+	DeliverDue(ctx context.Context) (int, error)
+	RunDeliveries(ctx context.Context, interval time.Duration)
+}
+
+type webhookService struct {
+	repo    repository.WebhookRepository
+	client  *http.Client
+	options WebhookOptions
+	logger  *utils.Logger
+}
+
+// NewWebhookService creates the service. Redirects are not followed, an endpoint
+// answering with one has failed the delivery.
+func NewWebhookService(repo repository.WebhookRepository, client *http.Client, options WebhookOptions, logger *utils.Logger) WebhookService {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &webhookService{repo: repo, client: &noRedirects, options: options, logger: logger}
+}
+
+func (s *webhookService) Create(ctx context.Context, req *model.CreateWebhookRequest, actorID *int64) (*model.WebhookCreatedResponse, error) {
+	secret := req.Secret
+	if secret == "" {
+		key, err := utils.GenerateAPIKey()
+		if err != nil {
+			return nil, err
+		}
+		secret = webhookSecretPrefix + key
+	}
+
+	subscription := &entity.WebhookSubscription{
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    uniqueStrings(req.Events),
+		CreatedBy: actorID,
+	}
+	if err := s.repo.Create(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Webhook %d created for %s", subscription.ID, subscription.URL)
+	return &model.WebhookCreatedResponse{
+		WebhookResponse: *converter.ToWebhookResponse(subscription),
+		Secret:          secret,
+	}, nil
+}
+
+func (s *webhookService) GetByID(ctx context.Context, id int64) (*model.WebhookResponse, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapWebhookError(err)
+	}
+	return converter.ToWebhookResponse(subscription), nil
+}
+
+func (s *webhookService) List(ctx context.Context) ([]*model.WebhookResponse, error) {
+	subscriptions, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return converter.ToWebhookResponses(subscriptions), nil
+}
+
+func (s *webhookService) Update(ctx context.Context, id int64, req *model.UpdateWebhookRequest) (*model.WebhookResponse, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapWebhookError(err)
+	}
+
+	if req.URL != nil {
+		subscription.URL = *req.URL
+	}
+	if req.Secret != nil {
+		subscription.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		subscription.Events = uniqueStrings(*req.Events)
+	}
+	if req.Active != nil {
+		if *req.Active && !subscription.Active {
+			subscription.ConsecutiveFailures = 0
+			subscription.DisabledAt = nil
+			subscription.DisabledReason = nil
+		}
+		subscription.Active = *req.Active
+	}
+
+	if err := s.repo.Update(ctx, subscription); err != nil {
+		return nil, mapWebhookError(err)
+	}
+	return converter.ToWebhookResponse(subscription), nil
+}
+
+func (s *webhookService) Delete(ctx context.Context, id int64) error {
+	return mapWebhookError(s.repo.Delete(ctx, id))
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, id int64, status string, query *model.PaginationQuery) (*model.Response, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, mapWebhookError(err)
+	}
+
+	deliveries, total, err := s.repo.ListDeliveries(ctx, id, status, query)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(query.Limit)))
+	return &model.Response{
+		Message: "Webhook deliveries retrieved successfully",
+		Data:    converter.ToWebhookDeliveryResponses(deliveries),
+		Meta: &model.PaginatedMeta{
+			Total:       total,
+			CurrentPage: int64(query.Page),
+			PerPage:     int64(query.Limit),
+			LastPage:    totalPages,
+			HasNextPage: int64(query.Page) < int64(totalPages),
+			HasPrevPage: int64(query.Page) > 1,
+		},
+	}, nil
+}
+
+// Redeliver sends a delivery again. Inactive webhooks are never delivered to, so
+// they must be activated first, and deliveries still scheduled are left alone.
+func (s *webhookService) Redeliver(ctx context.Context, id int64, deliveryID int64) (*model.WebhookDeliveryResponse, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapWebhookError(err)
+	}
+	if !subscription.Active {
+		return nil, ErrWebhookInactive
+	}
+
+	delivery, err := s.repo.Redeliver(ctx, id, deliveryID, time.Now())
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if errors.Is(err, repository.ErrWebhookDeliveryInFlight) {
+		return nil, ErrWebhookDeliveryInFlight
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Webhook delivery %d of event %d queued for redelivery", delivery.ID, delivery.EventID)
+	return converter.ToWebhookDeliveryResponse(delivery), nil
+}
+
+// Publish queues the event for every active subscription wanting it. The outbox
+// relay may publish an event more than once, it is still delivered once.
+func (s *webhookService) Publish(ctx context.Context, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	queued, err := s.repo.EnqueueEvent(ctx, event.ID, event.Type, types.JSONText(payload))
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		s.logger.Info("Event %d %s queued for %d webhooks", event.ID, event.Type, queued)
+	}
+	return nil
+}
+
+// DeliverDue sends one batch of due deliveries and returns how many were claimed
+func (s *webhookService) DeliverDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	deliveries, err := s.repo.ClaimDue(ctx, s.options.BatchSize, now, now.Add(s.options.Lease))
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	// Secrets and URLs are read once per batch, several deliveries usually share a subscription
+	subscriptions := map[int64]*entity.WebhookSubscription{}
+	for _, delivery := range deliveries {
+		if _, ok := subscriptions[delivery.WebhookID]; ok {
+			continue
+		}
+		subscription, err := s.repo.GetByID(ctx, delivery.WebhookID)
+		if err != nil {
+			return 0, err
+		}
+		subscriptions[delivery.WebhookID] = subscription
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *entity.WebhookDelivery) {
+			defer wg.Done()
+			s.deliver(ctx, subscriptions[delivery.WebhookID], delivery)
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// RunDeliveries sends due deliveries every interval until ctx is done, a full
+// batch is followed by another pass straight away
+func (s *webhookService) RunDeliveries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			claimed, err := s.DeliverDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				s.logger.Warning("Webhook delivery pass failed: %v", err)
+			}
+			if err != nil || claimed < s.options.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *webhookService) deliver(ctx context.Context, subscription *entity.WebhookSubscription, delivery *entity.WebhookDelivery) {
+	statusCode, err := s.send(ctx, subscription, delivery)
+	if err == nil {
+		if err := s.repo.MarkSucceeded(ctx, delivery, statusCode, time.Now()); err != nil {
+			s.logger.Error("Webhook delivery %d succeeded but could not be recorded: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if delivery.Attempts < s.options.MaxAttempts {
+		next := time.Now().Add(s.retryDelay(delivery.Attempts))
+		retryAt = &next
+	}
+	var responseStatus *int
+	if statusCode != 0 {
+		responseStatus = &statusCode
+	}
+
+	disabled, markErr := s.repo.MarkFailed(ctx, delivery, retryAt, responseStatus,
+		truncateRunes(err.Error(), maxWebhookErrorLength), s.options.DisableAfter, time.Now())
+	if markErr != nil {
+		s.logger.Error("Webhook delivery %d failed and could not be recorded: %v", delivery.ID, markErr)
+		return
+	}
+
+	if retryAt == nil {
+		s.logger.Warning("Webhook delivery %d to %s given up after %d attempts: %v", delivery.ID, subscription.URL, delivery.Attempts, err)
+	} else {
+		s.logger.Warning("Webhook delivery %d to %s failed on attempt %d, retrying at %s: %v",
+			delivery.ID, subscription.URL, delivery.Attempts, retryAt.Format(time.RFC3339), err)
+	}
+	if disabled {
+		s.logger.Warning("Webhook %d disabled after %d consecutive failures", subscription.ID, s.options.DisableAfter)
+	}
+}
+
+// send POSTs the delivery and returns the response status, if a response came
+func (s *webhookService) send(ctx context.Context, subscription *entity.WebhookSubscription, delivery *entity.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.HeaderDeliveryID, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(webhook.HeaderEvent, delivery.EventType)
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(subscription.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay backs off exponentially with the attempts made so far, with jitter
+// so endpoints coming back up are not hit by every retry at once
+func (s *webhookService) retryDelay(attempts int) time.Duration {
+	delay := s.options.RetryBase
+	for i := 1; i < attempts && delay < s.options.RetryMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, s.options.RetryMax)
+	if delay < 2 {
+		return delay
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+func mapWebhookError(err error) error {
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func uniqueStrings(values []string) []string {
+	unique := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,481 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/entity"
+	"github.com/Rafli-Dewanto/go-template/internal/events"
+	"github.com/Rafli-Dewanto/go-template/internal/model"
+	"github.com/Rafli-Dewanto/go-template/internal/repository"
+	"github.com/Rafli-Dewanto/go-template/internal/webhook"
+	"github.com/Rafli-Dewanto/go-template/internal/webhook/webhooktest"
+	"github.com/jmoiron/sqlx/types"
+)
+
+// fakeWebhookRepository keeps subscriptions and deliveries in memory, following
+// the contract WebhookRepository documents for the SQL implementation
+type fakeWebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions []*entity.WebhookSubscription
+	deliveries    []*entity.WebhookDelivery
+}
+
+func (r *fakeWebhookRepository) Create(_ context.Context, subscription *entity.WebhookSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscription.ID = int64(len(r.subscriptions) + 1)
+	subscription.Active = true
+	copied := *subscription
+	r.subscriptions = append(r.subscriptions, &copied)
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetByID(_ context.Context, id int64) (*entity.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > int64(len(r.subscriptions)) {
+		return nil, repository.ErrWebhookNotFound
+	}
+	copied := *r.subscriptions[id-1]
+	return &copied, nil
+}
+
+func (r *fakeWebhookRepository) List(context.Context) ([]*entity.WebhookSubscription, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) Update(context.Context, *entity.WebhookSubscription) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) Delete(context.Context, int64) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) EnqueueEvent(_ context.Context, eventID int64, eventType string, payload types.JSONText) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var queued int64
+	for _, subscription := range r.subscriptions {
+		if !subscription.Active || (len(subscription.Events) > 0 && !slices.Contains(subscription.Events, eventType)) {
+			continue
+		}
+		if r.findDelivery(subscription.ID, eventID) != nil {
+			continue
+		}
+		r.deliveries = append(r.deliveries, &entity.WebhookDelivery{
+			ID:            int64(len(r.deliveries) + 1),
+			WebhookID:     subscription.ID,
+			EventID:       eventID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        entity.WebhookDeliveryPending,
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+		})
+		queued++
+	}
+	return queued, nil
+}
+
+func (r *fakeWebhookRepository) ClaimDue(_ context.Context, limit int, now time.Time, leaseUntil time.Time) ([]*entity.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := []*entity.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.Status == entity.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) &&
+			r.subscriptions[delivery.WebhookID-1].Active {
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*entity.WebhookDelivery, len(due))
+	for i, delivery := range due {
+		delivery.NextAttemptAt = leaseUntil
+		delivery.Attempts++
+		copied := *delivery
+		claimed[i] = &copied
+	}
+	return claimed, nil
+}
+
+func (r *fakeWebhookRepository) MarkSucceeded(_ context.Context, delivery *entity.WebhookDelivery, responseStatus int, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.deliveries[delivery.ID-1]
+	stored.Status = entity.WebhookDeliverySucceeded
+	stored.ResponseStatus = &responseStatus
+	stored.LastError = nil
+	stored.DeliveredAt = &now
+	r.subscriptions[delivery.WebhookID-1].ConsecutiveFailures = 0
+	return nil
+}
+
+func (r *fakeWebhookRepository) MarkFailed(_ context.Context, delivery *entity.WebhookDelivery, retryAt *time.Time, responseStatus *int, lastError string, disableAfter int, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.deliveries[delivery.ID-1]
+	stored.Status = entity.WebhookDeliveryPending
+	if retryAt == nil {
+		stored.Status = entity.WebhookDeliveryFailed
+	} else {
+		stored.NextAttemptAt = *retryAt
+	}
+	stored.ResponseStatus = responseStatus
+	stored.LastError = &lastError
+
+	subscription := r.subscriptions[delivery.WebhookID-1]
+	subscription.ConsecutiveFailures++
+	disabled := subscription.Active && disableAfter > 0 && subscription.ConsecutiveFailures >= disableAfter
+	if disabled {
+		subscription.Active = false
+		subscription.DisabledAt = &now
+		subscription.DisabledReason = &lastError
+	}
+	return disabled, nil
+}
+
+func (r *fakeWebhookRepository) ListDeliveries(context.Context, int64, string, *model.PaginationQuery) ([]*entity.WebhookDelivery, int64, error) {
+	return nil, 0, errors.New("not implemented")
+}
+
+func (r *fakeWebhookRepository) Redeliver(_ context.Context, webhookID int64, deliveryID int64, now time.Time) (*entity.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if deliveryID < 1 || deliveryID > int64(len(r.deliveries)) || r.deliveries[deliveryID-1].WebhookID != webhookID {
+		return nil, repository.ErrWebhookNotFound
+	}
+	stored := r.deliveries[deliveryID-1]
+	if stored.Status == entity.WebhookDeliveryPending && stored.NextAttemptAt.After(now) {
+		return nil, repository.ErrWebhookDeliveryInFlight
+	}
+	stored.Status = entity.WebhookDeliveryPending
+	stored.Attempts = 0
+	stored.NextAttemptAt = now
+	stored.LastError = nil
+	copied := *stored
+	return &copied, nil
+}
+
+func (r *fakeWebhookRepository) findDelivery(webhookID int64, eventID int64) *entity.WebhookDelivery {
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID && delivery.EventID == eventID {
+			return delivery
+		}
+	}
+	return nil
+}
+
+// delivery returns a copy of a stored delivery
+func (r *fakeWebhookRepository) delivery(id int64) entity.WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.deliveries[id-1]
+}
+
+// makeDue lets deliveries waiting for a retry be claimed again
+func (r *fakeWebhookRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		delivery.NextAttemptAt = time.Time{}
+	}
+}
+
+var testWebhookOptions = WebhookOptions{
+	BatchSize:    10,
+	Lease:        time.Minute,
+	MaxAttempts:  5,
+	RetryBase:    10 * time.Second,
+	RetryMax:     time.Hour,
+	DisableAfter: 0,
+}
+
+func newTestWebhookService(t *testing.T, url string, secret string, options WebhookOptions) (WebhookService, *fakeWebhookRepository) {
+	t.Helper()
+	repo := &fakeWebhookRepository{}
+	s := NewWebhookService(repo, nil, options, newTestLogger(t))
+	if _, err := s.Create(context.Background(), &model.CreateWebhookRequest{URL: url, Secret: secret}, nil); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	return s, repo
+}
+
+func testEvent(id int64) events.Event {
+	return events.Event{
+		ID:            id,
+		Type:          entity.EventUserCreated,
+		AggregateType: entity.AggregateUser,
+		AggregateID:   7,
+		Payload:       []byte(`{"id":7,"username":"john"}`),
+		OccurredAt:    time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func deliverDue(t *testing.T, s WebhookService) int {
+	t.Helper()
+	claimed, err := s.DeliverDue(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverDue() = %v", err)
+	}
+	return claimed
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	s, repo := newTestWebhookService(t, receiver.URL, receiver.Secret, testWebhookOptions)
+
+	if err := s.Publish(context.Background(), testEvent(42)); err != nil {
+		t.Fatalf("Publish() = %v", err)
+	}
+	if claimed := deliverDue(t, s); claimed != 1 {
+		t.Fatalf("DeliverDue() claimed %d deliveries, want 1", claimed)
+	}
+
+	deliveries := receiver.Deliveries()
+	if len(deliveries) != 1 || receiver.Rejected() != 0 {
+		t.Fatalf("receiver accepted %d and rejected %d deliveries, want 1 and 0", len(deliveries), receiver.Rejected())
+	}
+	received := deliveries[0]
+	if received.Event.ID != 42 || received.Event.Type != entity.EventUserCreated || string(received.Event.Payload) != `{"id":7,"username":"john"}` {
+		t.Errorf("received event %+v", received.Event)
+	}
+
+	header := received.Header
+	if header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", header.Get("Content-Type"))
+	}
+	if header.Get(webhook.HeaderDeliveryID) != "1" || header.Get(webhook.HeaderEvent) != entity.EventUserCreated {
+		t.Errorf("delivery headers = %q %q", header.Get(webhook.HeaderDeliveryID), header.Get(webhook.HeaderEvent))
+	}
+	timestamp, err := strconv.ParseInt(header.Get(webhook.HeaderTimestamp), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Errorf("timestamp header = %q", header.Get(webhook.HeaderTimestamp))
+	}
+	err = webhook.Verify("whsec_test", header.Get(webhook.HeaderTimestamp), header.Get(webhook.HeaderSignature), received.Body, time.Now(), time.Minute)
+	if err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	if delivery := repo.delivery(1); delivery.Status != entity.WebhookDeliverySucceeded || delivery.DeliveredAt == nil {
+		t.Errorf("delivery recorded as %s", delivery.Status)
+	}
+}
+
+func TestWebhookWithTheWrongSecretIsRejectedByTheReceiver(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_receiver")
+	defer receiver.Close()
+	s, repo := newTestWebhookService(t, receiver.URL, "whsec_sender", testWebhookOptions)
+
+	s.Publish(context.Background(), testEvent(1))
+	deliverDue(t, s)
+
+	if receiver.Rejected() != 1 || len(receiver.Deliveries()) != 0 {
+		t.Fatalf("receiver rejected %d deliveries, want 1", receiver.Rejected())
+	}
+	if delivery := repo.delivery(1); delivery.Status != entity.WebhookDeliveryPending || *delivery.ResponseStatus != http.StatusUnauthorized {
+		t.Errorf("delivery recorded as %s %v, want a pending retry after a 401", delivery.Status, delivery.ResponseStatus)
+	}
+}
+
+func TestPublishingAnEventTwiceQueuesOneDelivery(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	s, repo := newTestWebhookService(t, receiver.URL, receiver.Secret, testWebhookOptions)
+
+	for i := 0; i < 2; i++ {
+		if err := s.Publish(context.Background(), testEvent(42)); err != nil {
+			t.Fatalf("Publish() = %v", err)
+		}
+	}
+	deliverDue(t, s)
+	repo.makeDue()
+	deliverDue(t, s)
+
+	if len(repo.deliveries) != 1 || len(receiver.Deliveries()) != 1 {
+		t.Errorf("queued %d and delivered %d, want one each", len(repo.deliveries), len(receiver.Deliveries()))
+	}
+}
+
+func TestFailedWebhookDeliveryIsRetried(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	s, repo := newTestWebhookService(t, receiver.URL, receiver.Secret, testWebhookOptions)
+
+	receiver.FailNext(1, http.StatusInternalServerError)
+	s.Publish(context.Background(), testEvent(1))
+	before := time.Now()
+	deliverDue(t, s)
+	after := time.Now()
+
+	delivery := repo.delivery(1)
+	if delivery.Status != entity.WebhookDeliveryPending || delivery.Attempts != 1 {
+		t.Fatalf("delivery is %s after %d attempts, want pending after 1", delivery.Status, delivery.Attempts)
+	}
+	if delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusInternalServerError || delivery.LastError == nil {
+		t.Errorf("failure not recorded: status %v, error %v", delivery.ResponseStatus, delivery.LastError)
+	}
+	// The first retry waits RetryBase, jittered down by up to half
+	base := testWebhookOptions.RetryBase
+	if delivery.NextAttemptAt.Before(before.Add(base/2)) || !delivery.NextAttemptAt.Before(after.Add(base)) {
+		t.Errorf("retry scheduled %s after the attempt, want within [%s, %s)", delivery.NextAttemptAt.Sub(before), base/2, base)
+	}
+
+	// Not due yet, nothing is sent
+	if claimed := deliverDue(t, s); claimed != 0 {
+		t.Errorf("DeliverDue() claimed %d deliveries before the retry was due", claimed)
+	}
+
+	repo.makeDue()
+	deliverDue(t, s)
+	if delivery := repo.delivery(1); delivery.Status != entity.WebhookDeliverySucceeded || delivery.Attempts != 2 {
+		t.Errorf("delivery is %s after %d attempts, want succeeded after 2", delivery.Status, delivery.Attempts)
+	}
+	if len(receiver.Deliveries()) != 1 {
+		t.Errorf("receiver accepted %d deliveries, want 1", len(receiver.Deliveries()))
+	}
+}
+
+func TestWebhookRetryDelayStaysWithinJitterBounds(t *testing.T) {
+	s := &webhookService{options: WebhookOptions{RetryBase: 10 * time.Second, RetryMax: 5 * time.Minute}}
+
+	for attempts := 1; attempts <= 20; attempts++ {
+		d := s.options.RetryBase
+		for i := 1; i < attempts && d < s.options.RetryMax; i++ {
+			d *= 2
+		}
+		d = min(d, s.options.RetryMax)
+
+		for i := 0; i < 100; i++ {
+			if delay := s.retryDelay(attempts); delay < d/2 || delay >= d {
+				t.Fatalf("retryDelay(%d) = %s, want within [%s, %s)", attempts, delay, d/2, d)
+			}
+		}
+	}
+}
+
+func TestWebhookDeliveryIsGivenUpAfterMaxAttempts(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	options := testWebhookOptions
+	options.MaxAttempts = 3
+	s, repo := newTestWebhookService(t, receiver.URL, receiver.Secret, options)
+
+	receiver.FailNext(10, http.StatusServiceUnavailable)
+	s.Publish(context.Background(), testEvent(1))
+	for i := 0; i < 5; i++ {
+		repo.makeDue()
+		deliverDue(t, s)
+	}
+
+	delivery := repo.delivery(1)
+	if delivery.Status != entity.WebhookDeliveryFailed || delivery.Attempts != 3 {
+		t.Errorf("delivery is %s after %d attempts, want failed after 3", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestWebhookIsDisabledAfterConsecutiveFailures(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	options := testWebhookOptions
+	options.DisableAfter = 3
+	s, repo := newTestWebhookService(t, receiver.URL, receiver.Secret, options)
+
+	receiver.FailNext(10, http.StatusBadGateway)
+	s.Publish(context.Background(), testEvent(1))
+	s.Publish(context.Background(), testEvent(2))
+	deliverDue(t, s) // two failures
+	repo.makeDue()
+	deliverDue(t, s) // the third disables the webhook, whichever delivery it is
+
+	subscription, _ := repo.GetByID(context.Background(), 1)
+	if subscription.Active || subscription.DisabledAt == nil || subscription.DisabledReason == nil {
+		t.Fatalf("webhook active=%v after %d consecutive failures", subscription.Active, subscription.ConsecutiveFailures)
+	}
+
+	// A disabled webhook gets no new events and its pending deliveries are not sent
+	s.Publish(context.Background(), testEvent(3))
+	repo.makeDue()
+	if claimed := deliverDue(t, s); claimed != 0 {
+		t.Errorf("DeliverDue() claimed %d deliveries of a disabled webhook", claimed)
+	}
+	if len(repo.deliveries) != 2 {
+		t.Errorf("%d deliveries queued, want none for the disabled webhook", len(repo.deliveries))
+	}
+
+	if _, err := s.Redeliver(context.Background(), 1, 1); !errors.Is(err, ErrWebhookInactive) {
+		t.Errorf("Redeliver() to a disabled webhook = %v, want ErrWebhookInactive", err)
+	}
+}
+
+func TestWebhookRedirectIsAFailure(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+	s, repo := newTestWebhookService(t, redirect.URL, receiver.Secret, testWebhookOptions)
+
+	s.Publish(context.Background(), testEvent(1))
+	deliverDue(t, s)
+
+	delivery := repo.delivery(1)
+	if delivery.Status != entity.WebhookDeliveryPending || delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusTemporaryRedirect {
+		t.Errorf("delivery is %s with response %v, want a pending retry after a 307", delivery.Status, delivery.ResponseStatus)
+	}
+	if len(receiver.Deliveries()) != 0 {
+		t.Error("the redirect was followed")
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	receiver := webhooktest.NewReceiver("whsec_test")
+	defer receiver.Close()
+	s, repo := newTestWebhookService(t, receiver.URL, receiver.Secret, testWebhookOptions)
+	ctx := context.Background()
+
+	receiver.FailNext(1, http.StatusInternalServerError)
+	s.Publish(ctx, testEvent(1))
+	deliverDue(t, s)
+
+	// Waiting for its retry, the delivery may be claimed at any moment
+	if _, err := s.Redeliver(ctx, 1, 1); !errors.Is(err, ErrWebhookDeliveryInFlight) {
+		t.Errorf("Redeliver() of a scheduled delivery = %v, want ErrWebhookDeliveryInFlight", err)
+	}
+
+	repo.makeDue()
+	deliverDue(t, s)
+	redelivered, err := s.Redeliver(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("Redeliver() of a succeeded delivery = %v", err)
+	}
+	if redelivered.Status != entity.WebhookDeliveryPending || redelivered.Attempts != 0 {
+		t.Errorf("redelivered delivery is %s after %d attempts", redelivered.Status, redelivered.Attempts)
+	}
+	deliverDue(t, s)
+	if len(receiver.Deliveries()) != 2 {
+		t.Errorf("receiver accepted %d deliveries, want the original and the redelivery", len(receiver.Deliveries()))
+	}
+
+	if _, err := s.Redeliver(ctx, 1, 99); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+		t.Errorf("Redeliver() of an unknown delivery = %v, want ErrWebhookDeliveryNotFound", err)
+	}
+	if _, err := s.Redeliver(ctx, 99, 1); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Redeliver() to an unknown webhook = %v, want ErrWebhookNotFound", err)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Rafli-Dewanto/go-template/internal/storage/s3test"
+)
+
+func newTestS3Store(server *s3test.Server, secretKey string) *S3Store {
+	return NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Region:    s3test.Region,
+		Bucket:    "avatars",
+		AccessKey: server.Credentials.AccessKey,
+		SecretKey: secretKey,
+	}, server.Client())
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	server := s3test.NewServer("access", "secret")
+	defer server.Close()
+	store := newTestS3Store(server, "secret")
+	ctx := context.Background()
+
+	const key = "users/1/avatar 256.png"
+	if err := store.Put(ctx, key, strings.NewReader("image bytes"), int64(len("image bytes")), "image/png"); err != nil {
+		t.Fatalf("Put() = %v", err)
+	}
+
+	if data, ok := server.Object("avatars", key); !ok || string(data) != "image bytes" {
+		t.Fatalf("stored object = %q, %v", data, ok)
+	}
+
+	body, contentType, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "image bytes" || contentType != "image/png" {
+		t.Errorf("Get() = %q %q, want %q %q", data, contentType, "image bytes", "image/png")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() of a missing object = %v, want nil", err)
+	}
+}
+
+func TestS3StoreRejectsBadCredentials(t *testing.T) {
+	server := s3test.NewServer("access", "secret")
+	defer server.Close()
+	store := newTestS3Store(server, "wrong")
+
+	err := store.Put(context.Background(), "a.png", strings.NewReader("x"), 1, "image/png")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Put() with a wrong secret = %v, want a 403 error", err)
+	}
+	if _, ok := server.Object("avatars", "a.png"); ok {
+		t.Error("object stored despite the bad signature")
+	}
+}
+
+func TestS3StoreRejectsInvalidKeys(t *testing.T) {
+	server := s3test.NewServer("access", "secret")
+	defer server.Close()
+	store := newTestS3Store(server, "secret")
+
+	for _, key := range []string{"", "/absolute.png"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestS3StoreURL(t *testing.T) {
+	store := NewS3Store(S3Config{Endpoint: "http://minio:9000/", Bucket: "avatars"}, nil)
+	if got := store.URL("a/b.png"); got != "http://minio:9000/avatars/a/b.png" {
+		t.Errorf("URL() = %q", got)
+	}
+
+	store = NewS3Store(S3Config{Endpoint: "http://minio:9000", Bucket: "avatars", PublicBaseURL: "https://cdn.example.com/"}, nil)
+	if got := store.URL("a/b.png"); got != "https://cdn.example.com/a/b.png" {
+		t.Errorf("URL() with a public base = %q", got)
+	}
+}
@@ -0,0 +1,94 @@
+// Package s3test provides an in-process fake of the S3 object API for
+// exercising storage.S3Store without a real object store.
+package s3test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/Rafli-Dewanto/go-template/internal/storage/sigv4"
+)
+
+const Region = "us-east-1"
+
+type object struct {
+	data        []byte
+	contentType string
+}
+
+// Server is a fake S3 endpoint that keeps objects in memory and checks
+// every request's SigV4 signature against its credentials.
+type Server struct {
+	*httptest.Server
+	Credentials sigv4.Credentials
+
+	mu      sync.RWMutex
+	objects map[string]object
+}
+
+// NewServer starts a fake S3 endpoint. Callers must Close it when done.
+func NewServer(accessKey, secretKey string) *Server {
+	s := &Server{
+		Credentials: sigv4.Credentials{AccessKey: accessKey, SecretKey: secretKey},
+		objects:     make(map[string]object),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Object returns the stored bytes for bucket/key.
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[bucket+"/"+key]
+	return obj.data, ok
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if err := sigv4.Verify(r, s.Credentials, Region, "s3"); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(name, "/") {
+		http.Error(w, "bucket and key required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.objects[name] = object{data: data, contentType: r.Header.Get("Content-Type")}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		s.mu.RLock()
+		obj, ok := s.objects[name]
+		s.mu.RUnlock()
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, name)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
@@ -301,6 +302,18 @@ func SecureCompareString(a, b string) bool {
 	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
 
+// SignHMACSHA256 returns the hex encoded HMAC-SHA256 of message under key
+func SignHMACSHA256(key, message []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHMACSHA256 checks a hex encoded HMAC-SHA256 signature in constant time
+func VerifyHMACSHA256(key, message []byte, signature string) bool {
+	return SecureCompareString(SignHMACSHA256(key, message), signature)
+}
+
 // GenerateAPIKey generates a secure API key
 func GenerateAPIKey() (string, error) {
 	key, err := GenerateRandomKey(32)
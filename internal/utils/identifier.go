@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeIdentifier folds a username or email into the form it is stored and
+// compared in: NFKC normalized, trimmed and lowercased. NFKC maps compatibility
+// characters such as fullwidth "Ａ" or the "ﬁ" ligature onto their plain forms.
+func NormalizeIdentifier(s string) string {
+	s = strings.ToLower(strings.TrimSpace(norm.NFKC.String(s)))
+	return norm.NFKC.String(s)
+}
+
+// compatibleScripts may be mixed within one username, they are written together
+var compatibleScripts = [][]string{
+	{"Han", "Hiragana", "Katakana"},
+	{"Han", "Hangul"},
+}
+
+// latinLookalikes maps Cyrillic and Greek letters to the Latin letter they imitate
+var latinLookalikes = map[rune]rune{
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'к': 'k', 'ӏ': 'l', 'м': 'm', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't',
+	'у': 'y', 'ԝ': 'w', 'х': 'x',
+	'α': 'a', 'ϲ': 'c', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+}
+
+// IsSafeUsername reports whether a normalized username uses only letters, digits,
+// marks and ".", "_" or "-", draws its letters from a single script and is not
+// made entirely of letters that imitate Latin ones. This rejects homoglyph
+// look-alikes such as a Cyrillic "а" inside "pаypal" or an all-Cyrillic "асе".
+func IsSafeUsername(username string) bool {
+	scripts := map[string]bool{}
+	imitatesLatin := true
+	for _, r := range username {
+		switch {
+		case r == '.' || r == '_' || r == '-':
+			continue
+		case unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			continue
+		case !unicode.IsLetter(r):
+			return false
+		}
+
+		scripts[scriptOf(r)] = true
+		if _, ok := latinLookalikes[r]; !ok {
+			imitatesLatin = false
+		}
+	}
+
+	if len(scripts) > 1 && !areCompatibleScripts(scripts) {
+		return false
+	}
+	if (scripts["Cyrillic"] || scripts["Greek"]) && imitatesLatin {
+		return false
+	}
+	return true
+}
+
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return "Unknown"
+}
+
+func areCompatibleScripts(scripts map[string]bool) bool {
+	for _, group := range compatibleScripts {
+		compatible := true
+		for script := range scripts {
+			if !slices.Contains(group, script) {
+				compatible = false
+				break
+			}
+		}
+		if compatible {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black = color.RGBA{A: 255}
+)
+
+// newImage paints rows of pixels, rows[y][x], into an image starting at origin
+func newImage(origin image.Point, rows ...[]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)).Add(origin))
+	for y, row := range rows {
+		for x, c := range row {
+			img.SetRGBA(origin.X+x, origin.Y+y, c)
+		}
+	}
+	return img
+}
+
+func TestResizeSquare(t *testing.T) {
+	type pixel struct {
+		x, y int
+		want color.RGBA
+	}
+
+	tests := []struct {
+		name   string
+		img    image.Image
+		size   int
+		pixels []pixel
+	}{
+		{
+			name: "wide image is cropped to its center",
+			img:  newImage(image.Point{}, []color.RGBA{red, green, blue, white}, []color.RGBA{red, green, blue, white}),
+			size: 2,
+			pixels: []pixel{
+				{0, 0, green}, {1, 0, blue}, {0, 1, green}, {1, 1, blue},
+			},
+		},
+		{
+			name: "tall image is cropped to its center",
+			img:  newImage(image.Point{}, []color.RGBA{red}, []color.RGBA{green}, []color.RGBA{blue}),
+			size: 1,
+			pixels: []pixel{
+				{0, 0, green},
+			},
+		},
+		{
+			name: "downscaling averages the covered pixels",
+			img:  newImage(image.Point{}, []color.RGBA{green, blue}, []color.RGBA{green, blue}),
+			size: 1,
+			pixels: []pixel{
+				{0, 0, color.RGBA{G: 127, B: 127, A: 255}},
+			},
+		},
+		{
+			name: "checkerboard averages to grey",
+			img: newImage(image.Point{},
+				[]color.RGBA{black, white, black, white},
+				[]color.RGBA{white, black, white, black},
+				[]color.RGBA{black, white, black, white},
+				[]color.RGBA{white, black, white, black},
+			),
+			size: 2,
+			pixels: []pixel{
+				{0, 0, color.RGBA{R: 127, G: 127, B: 127, A: 255}}, {1, 1, color.RGBA{R: 127, G: 127, B: 127, A: 255}},
+			},
+		},
+		{
+			name: "upscaling repeats source pixels",
+			img:  newImage(image.Point{}, []color.RGBA{red, green}, []color.RGBA{blue, white}),
+			size: 4,
+			pixels: []pixel{
+				{0, 0, red}, {1, 1, red}, {3, 0, green}, {0, 3, blue}, {2, 2, white}, {3, 3, white},
+			},
+		},
+		{
+			name: "a single pixel fills the thumbnail",
+			img:  newImage(image.Point{}, []color.RGBA{blue}),
+			size: 3,
+			pixels: []pixel{
+				{0, 0, blue}, {1, 1, blue}, {2, 2, blue},
+			},
+		},
+		{
+			name: "bounds not starting at the origin",
+			img:  newImage(image.Point{X: 10, Y: -5}, []color.RGBA{white, red, green, white}, []color.RGBA{white, red, green, white}),
+			size: 1,
+			pixels: []pixel{
+				{0, 0, color.RGBA{R: 127, G: 127, A: 255}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResizeSquare(tt.img, tt.size)
+			if want := image.Rect(0, 0, tt.size, tt.size); got.Bounds() != want {
+				t.Fatalf("ResizeSquare() bounds = %v, want %v", got.Bounds(), want)
+			}
+			for _, p := range tt.pixels {
+				if c := got.RGBAAt(p.x, p.y); c != p.want {
+					t.Errorf("pixel (%d, %d) = %v, want %v", p.x, p.y, c, p.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("result is not JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("expectation is not JSON: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Cases follow the examples of RFC 6902 appendix A
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "add object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "add array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "add to the end of an array with -",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:  "add replaces an existing member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/foo","value":1}]`,
+			want:  `{"foo":1}`,
+		},
+		{
+			name:  "add a nested member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:  `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:  "remove object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "replace a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "replace the last array element",
+			doc:   `{"foo":["a","b"]}`,
+			patch: `[{"op":"replace","path":"/foo/1","value":"c"}]`,
+			want:  `{"foo":["a","c"]}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"replace","path":"","value":{"baz":1}}]`,
+			want:  `{"baz":1}`,
+		},
+		{
+			name:  "move a value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "move an array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "copy a value",
+			doc:   `{"foo":{"bar":[1]}}`,
+			patch: `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"add","path":"/baz/bar/-","value":2}]`,
+			want:  `{"foo":{"bar":[1]},"baz":{"bar":[1,2]}}`,
+		},
+		{
+			name:  "test passes",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:  "escaped tokens",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10},{"op":"replace","path":"/~1","value":11}]`,
+			want:  `{"/":11,"~1":10}`,
+		},
+		{
+			name:  "add a null value",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":null}]`,
+			want:  `{"baz":null,"foo":"bar"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ApplyJSONPatch() = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  error
+	}{
+		{name: "test fails", doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, want: ErrPatchTestFailed},
+		{name: "test on a string compared with a number", doc: `{"foo":"1"}`, patch: `[{"op":"test","path":"/foo","value":1}]`, want: ErrPatchTestFailed},
+		{name: "add to a missing parent", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, want: ErrInvalidPatch},
+		{name: "array index out of bounds", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/2","value":"x"}]`, want: ErrInvalidPatch},
+		{name: "array index with leading zero", doc: `{"foo":["a","b"]}`, patch: `[{"op":"remove","path":"/foo/01"}]`, want: ErrInvalidPatch},
+		{name: "- is not an index to remove", doc: `{"foo":["a"]}`, patch: `[{"op":"remove","path":"/foo/-"}]`, want: ErrInvalidPatch},
+		{name: "remove a missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, want: ErrInvalidPatch},
+		{name: "replace a missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":1}]`, want: ErrInvalidPatch},
+		{name: "move into itself", doc: `{"foo":{"bar":1}}`, patch: `[{"op":"move","from":"/foo","path":"/foo/bar"}]`, want: ErrInvalidPatch},
+		{name: "missing value", doc: `{}`, patch: `[{"op":"add","path":"/foo"}]`, want: ErrInvalidPatch},
+		{name: "unknown op", doc: `{}`, patch: `[{"op":"frobnicate","path":"/foo"}]`, want: ErrInvalidPatch},
+		{name: "pointer without leading slash", doc: `{"foo":1}`, patch: `[{"op":"remove","path":"foo"}]`, want: ErrInvalidPatch},
+		{name: "patch is not an array", doc: `{}`, patch: `{"op":"add"}`, want: ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ApplyJSONPatch() = %s, %v, want %v", got, err, tt.want)
+			}
+			if got != nil {
+				t.Errorf("ApplyJSONPatch() returned a document along with the error: %s", got)
+			}
+		})
+	}
+}
+
+// A failing operation discards the ones before it, nothing of the patch applies
+func TestApplyJSONPatchIsAtomic(t *testing.T) {
+	doc := []byte(`{"display_name":"John","bio":"old"}`)
+	patch := []byte(`[
+		{"op":"replace","path":"/display_name","value":"Jane"},
+		{"op":"remove","path":"/bio"},
+		{"op":"test","path":"/display_name","value":"John"}
+	]`)
+
+	got, err := ApplyJSONPatch(doc, patch)
+	if !errors.Is(err, ErrPatchTestFailed) {
+		t.Fatalf("ApplyJSONPatch() = %v, want ErrPatchTestFailed", err)
+	}
+	if got != nil {
+		t.Errorf("ApplyJSONPatch() returned %s for a failed patch", got)
+	}
+	if string(doc) != `{"display_name":"John","bio":"old"}` {
+		t.Errorf("input document was modified: %s", doc)
+	}
+}
+
+// Cases follow the examples of RFC 7396 appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{doc: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("MergePatch(%s, %s) = %v", tt.doc, tt.patch, err)
+		}
+		assertJSONEqual(t, got, tt.want)
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("MergePatch() of malformed JSON = %v, want ErrInvalidPatch", err)
+	}
+}
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSONSchema is the subset of JSON Schema used to describe custom attributes:
+// type, properties, required, additionalProperties, items, enum, minLength,
+// maxLength, pattern, minimum, maximum and maxItems. Schemas using any other
+// keyword are rejected when parsed rather than silently under-enforced.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+var jsonSchemaTypes = []string{"", "object", "array", "string", "integer", "number", "boolean"}
+
+// ParseJSONSchema parses and checks a schema document
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	schema := &JSONSchema{}
+	if err := decoder.Decode(schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	if err := schema.compile("$"); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// LoadJSONSchema reads a schema from a file, an empty path yields a schema that
+// only accepts an empty object
+func LoadJSONSchema(path string) (*JSONSchema, error) {
+	if path == "" {
+		closed := false
+		return &JSONSchema{Type: "object", AdditionalProperties: &closed}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON schema: %w", err)
+	}
+	return ParseJSONSchema(data)
+}
+
+func (s *JSONSchema) compile(path string) error {
+	if !slices.Contains(jsonSchemaTypes, s.Type) {
+		return fmt.Errorf("unsupported type %q at %s", s.Type, path)
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern at %s: %w", path, err)
+		}
+		s.pattern = pattern
+	}
+	for name, property := range s.Properties {
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// Validate checks value, as decoded by encoding/json, against the schema. Errors
+// name the offending location starting at field, e.g. "attributes.department".
+func (s *JSONSchema) Validate(field string, value any) []ValidationError {
+	var errors []ValidationError
+	s.validate(field, value, &errors)
+	return errors
+}
+
+func (s *JSONSchema) validate(field string, value any, errors *[]ValidationError) {
+	fail := func(format string, args ...any) {
+		*errors = append(*errors, ValidationError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasJSONType(value, s.Type) {
+		fail("Must be of type %s", s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return jsonEqual(allowed, value) }) {
+		fail("Must be one of: %s", formatEnum(s.Enum))
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("Minimum length is %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("Maximum length is %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("Must match pattern %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("Minimum value is %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("Maximum value is %v", *s.Maximum)
+		}
+	case []any:
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("At most %d items are allowed", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item, errors)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errors = append(*errors, ValidationError{Field: field + "." + name, Error: "This field is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			switch {
+			case ok:
+				property.validate(field+"."+name, v[name], errors)
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				*errors = append(*errors, ValidationError{Field: field + "." + name, Error: "Unknown field"})
+			}
+		}
+	}
+}
+
+// AttributesOrEmpty returns attributes, or an empty object in place of nil, so a
+// new user without attributes is still checked for required ones
+func AttributesOrEmpty(attributes map[string]any) map[string]any {
+	if attributes == nil {
+		return map[string]any{}
+	}
+	return attributes
+}
+
+// Property returns the schema of a top level property, or nil if it is not declared
+func (s *JSONSchema) Property(name string) *JSONSchema {
+	return s.Properties[name]
+}
+
+// ParseScalar converts a query string value into the scalar type the schema
+// declares, so "42" becomes a number for an integer property
+func (s *JSONSchema) ParseScalar(raw string) (any, error) {
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return float64(n), nil
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	case "string", "":
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("cannot filter on %s attributes", s.Type)
+	}
+}
+
+func hasJSONType(value any, jsonType string) bool {
+	switch jsonType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	default:
+		return true
+	}
+}
+
+func jsonEqual(a any, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+func formatEnum(values []any) string {
+	var buf bytes.Buffer
+	for i, value := range values {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		encoded, _ := json.Marshal(value)
+		buf.Write(encoded)
+	}
+	return buf.String()
+}
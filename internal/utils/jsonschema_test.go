@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const attributeSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"required": ["department"],
+	"properties": {
+		"department": {"type": "string", "enum": ["Sales", "Engineering"]},
+		"employee_id": {"type": "string", "minLength": 3, "maxLength": 5, "pattern": "^E[0-9]+$"},
+		"level": {"type": "integer", "minimum": 1, "maximum": 10},
+		"score": {"type": "number"},
+		"remote": {"type": "boolean"},
+		"skills": {"type": "array", "maxItems": 2, "items": {"type": "string", "maxLength": 4}},
+		"address": {"type": "object", "required": ["city"], "properties": {"city": {"type": "string"}}}
+	}
+}`
+
+func mustParseSchema(t *testing.T, data string) *JSONSchema {
+	t.Helper()
+	schema, err := ParseJSONSchema([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema() = %v", err)
+	}
+	return schema
+}
+
+// decode mirrors how request bodies reach the schema, through encoding/json
+func decode(t *testing.T, data string) any {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema := mustParseSchema(t, attributeSchema)
+
+	tests := []struct {
+		name  string
+		value string
+		want  []ValidationError
+	}{
+		{
+			name:  "valid",
+			value: `{"department":"Sales","employee_id":"E12","level":3,"score":1.5,"remote":true,"skills":["go"],"address":{"city":"Oslo"}}`,
+		},
+		{
+			name:  "missing required",
+			value: `{}`,
+			want:  []ValidationError{{Field: "attributes.department", Error: "This field is required"}},
+		},
+		{
+			name:  "unknown field",
+			value: `{"department":"Sales","shoe_size":44}`,
+			want:  []ValidationError{{Field: "attributes.shoe_size", Error: "Unknown field"}},
+		},
+		{
+			name:  "not an object",
+			value: `["Sales"]`,
+			want:  []ValidationError{{Field: "attributes", Error: "Must be of type object"}},
+		},
+		{
+			name:  "enum",
+			value: `{"department":"Legal"}`,
+			want:  []ValidationError{{Field: "attributes.department", Error: `Must be one of: "Sales", "Engineering"`}},
+		},
+		{
+			name:  "string too short and off pattern",
+			value: `{"department":"Sales","employee_id":"X1"}`,
+			want: []ValidationError{
+				{Field: "attributes.employee_id", Error: "Minimum length is 3"},
+				{Field: "attributes.employee_id", Error: "Must match pattern ^E[0-9]+$"},
+			},
+		},
+		{
+			name:  "string too long",
+			value: `{"department":"Sales","employee_id":"E12345"}`,
+			want:  []ValidationError{{Field: "attributes.employee_id", Error: "Maximum length is 5"}},
+		},
+		{
+			name:  "length counts characters, not bytes",
+			value: `{"department":"Sales","skills":["ääää"]}`,
+		},
+		{
+			name:  "integer with a fraction",
+			value: `{"department":"Sales","level":2.5}`,
+			want:  []ValidationError{{Field: "attributes.level", Error: "Must be of type integer"}},
+		},
+		{
+			name:  "number out of range",
+			value: `{"department":"Sales","level":11}`,
+			want:  []ValidationError{{Field: "attributes.level", Error: "Maximum value is 10"}},
+		},
+		{
+			name:  "number below minimum",
+			value: `{"department":"Sales","level":0}`,
+			want:  []ValidationError{{Field: "attributes.level", Error: "Minimum value is 1"}},
+		},
+		{
+			name:  "wrong scalar type",
+			value: `{"department":"Sales","remote":"yes","score":"high"}`,
+			want: []ValidationError{
+				{Field: "attributes.remote", Error: "Must be of type boolean"},
+				{Field: "attributes.score", Error: "Must be of type number"},
+			},
+		},
+		{
+			name:  "array items and size",
+			value: `{"department":"Sales","skills":["go","rust","elixir"]}`,
+			want: []ValidationError{
+				{Field: "attributes.skills", Error: "At most 2 items are allowed"},
+				{Field: "attributes.skills[2]", Error: "Maximum length is 4"},
+			},
+		},
+		{
+			name:  "nested object",
+			value: `{"department":"Sales","address":{}}`,
+			want:  []ValidationError{{Field: "attributes.address.city", Error: "This field is required"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schema.Validate("attributes", decode(t, tt.value))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%s) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// A user created without attributes is checked as an empty object
+func TestJSONSchemaValidateMissingAttributes(t *testing.T) {
+	schema := mustParseSchema(t, attributeSchema)
+
+	got := schema.Validate("attributes", AttributesOrEmpty(nil))
+	want := []ValidationError{{Field: "attributes.department", Error: "This field is required"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate(AttributesOrEmpty(nil)) = %v, want %v", got, want)
+	}
+
+	attributes := map[string]any{"department": "Sales"}
+	if got := AttributesOrEmpty(attributes); !reflect.DeepEqual(got, attributes) {
+		t.Errorf("AttributesOrEmpty() = %v, want the attributes unchanged", got)
+	}
+}
+
+func TestParseJSONSchemaRejectsUnsupportedSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{name: "unknown keyword", schema: `{"type":"object","oneOf":[]}`, want: "oneOf"},
+		{name: "unknown type", schema: `{"type":"object","properties":{"a":{"type":"date"}}}`, want: `unsupported type "date" at $.a`},
+		{name: "bad pattern", schema: `{"type":"object","properties":{"a":{"type":"string","pattern":"("}}}`, want: "invalid pattern at $.a"},
+		{name: "bad items", schema: `{"type":"array","items":{"type":"tuple"}}`, want: `unsupported type "tuple" at $[]`},
+		{name: "not JSON", schema: `{`, want: "invalid JSON schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJSONSchema([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseJSONSchema() = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJSONSchemaWithoutPathOnlyAcceptsAnEmptyObject(t *testing.T) {
+	schema, err := LoadJSONSchema("")
+	if err != nil {
+		t.Fatalf("LoadJSONSchema() = %v", err)
+	}
+	if got := schema.Validate("attributes", map[string]any{}); got != nil {
+		t.Errorf("Validate({}) = %v, want no errors", got)
+	}
+	if got := schema.Validate("attributes", map[string]any{"a": 1.0}); len(got) != 1 {
+		t.Errorf("Validate({a:1}) = %v, want one error", got)
+	}
+}
+
+func TestJSONSchemaParseScalar(t *testing.T) {
+	schema := mustParseSchema(t, attributeSchema)
+
+	tests := []struct {
+		property string
+		raw      string
+		want     any
+		wantErr  bool
+	}{
+		{property: "level", raw: "42", want: 42.0},
+		{property: "level", raw: "4.2", wantErr: true},
+		{property: "score", raw: "4.2", want: 4.2},
+		{property: "score", raw: "high", wantErr: true},
+		{property: "remote", raw: "true", want: true},
+		{property: "remote", raw: "maybe", wantErr: true},
+		{property: "department", raw: "Sales", want: "Sales"},
+		{property: "skills", raw: "go", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := schema.Property(tt.property).ParseScalar(tt.raw)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseScalar(%s, %q) = %v, %v, want %v (error %v)", tt.property, tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if schema.Property("missing") != nil {
+		t.Error("Property() of an undeclared name is not nil")
+	}
+}
@@ -3,8 +3,10 @@ package utils
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
 )
 
 type ValidationError struct {
@@ -16,6 +18,31 @@ var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
+	validate.RegisterValidation("locale", validateLocale)
+	validate.RegisterValidation("iana_timezone", validateIANATimezone)
+	validate.RegisterValidation("username", validateUsername)
+}
+
+// validateLocale checks that the field is a well-formed BCP 47 language tag, e.g. "en" or "id-ID"
+func validateLocale(fl validator.FieldLevel) bool {
+	tag, err := language.Parse(fl.Field().String())
+	return err == nil && tag != language.Und
+}
+
+// validateIANATimezone checks that the field names a zone in the IANA time zone database, e.g. "Asia/Jakarta"
+func validateIANATimezone(fl validator.FieldLevel) bool {
+	name := fl.Field().String()
+	// time.LoadLocation maps "" to UTC and "Local" to the server zone, neither is a client value
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// validateUsername checks the username as it will be stored, see IsSafeUsername
+func validateUsername(fl validator.FieldLevel) bool {
+	return IsSafeUsername(NormalizeIdentifier(fl.Field().String()))
 }
 
 // ValidateStruct validates a struct and returns a map of validation errors
@@ -47,6 +74,18 @@ func getErrorMsg(err validator.FieldError) string {
 		return fmt.Sprintf("Minimum length is %s", err.Param())
 	case "max":
 		return fmt.Sprintf("Maximum length is %s", err.Param())
+	case "url":
+		return "Invalid URL format"
+	case "http_url":
+		return "Invalid URL, expected an http or https URL"
+	case "locale":
+		return "Invalid locale, expected a BCP 47 language tag such as en-US"
+	case "iana_timezone":
+		return "Invalid timezone, expected an IANA time zone such as Asia/Jakarta"
+	case "username":
+		return "Username may only use letters from one script, digits, '.', '_' and '-'"
+	case "oneof":
+		return fmt.Sprintf("Must be one of: %s", strings.ReplaceAll(err.Param(), " ", ", "))
 	default:
 		return fmt.Sprintf("Invalid value for %s", err.Field())
 	}
@@ -0,0 +1,61 @@
+// Package webhook holds the wire format shared by the webhook sender and receivers.
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/utils"
+)
+
+const (
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderEvent      = "X-Webhook-Event"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	ErrMissingSignature = errors.New("webhook signature is missing")
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+	ErrStaleTimestamp   = errors.New("webhook timestamp is outside the tolerance")
+)
+
+// Sign returns the X-Webhook-Signature value for body sent at timestamp. The
+// timestamp is signed along with the body so a captured request cannot be
+// replayed later with a new timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	return signaturePrefix + utils.SignHMACSHA256([]byte(secret), signedMessage(timestamp, body))
+}
+
+// Verify checks the signature and timestamp headers of a received webhook.
+// Requests signed more than tolerance away from now are rejected.
+func Verify(secret string, timestampHeader string, signatureHeader string, body []byte, now time.Time, tolerance time.Duration) error {
+	if timestampHeader == "" || !strings.HasPrefix(signatureHeader, signaturePrefix) {
+		return ErrMissingSignature
+	}
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+
+	signedAt := time.Unix(timestamp, 0)
+	if now.Sub(signedAt) > tolerance || signedAt.Sub(now) > tolerance {
+		return ErrStaleTimestamp
+	}
+
+	signature := strings.TrimPrefix(signatureHeader, signaturePrefix)
+	if !utils.VerifyHMACSHA256([]byte(secret), signedMessage(timestamp, body), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func signedMessage(timestamp int64, body []byte) []byte {
+	return append([]byte(fmt.Sprintf("%d.", timestamp)), body...)
+}
@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignThenVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":1,"type":"user.created"}`)
+	now := time.Unix(1_700_000_000, 0)
+	timestamp := now.Unix()
+	signature := Sign(secret, timestamp, body)
+
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Fatalf("Sign() = %q, want a sha256= prefix", signature)
+	}
+	if err := Verify(secret, strconv.FormatInt(timestamp, 10), signature, body, now, 5*time.Minute); err != nil {
+		t.Fatalf("Verify() of a signed body = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+		want      error
+	}{
+		{name: "tampered body", body: []byte(`{"id":1,"type":"user.deleted"}`), want: ErrInvalidSignature},
+		{name: "wrong secret", secret: "whsec_other", want: ErrInvalidSignature},
+		{name: "timestamp changed", timestamp: strconv.FormatInt(timestamp+1, 10), want: ErrInvalidSignature},
+		{name: "stale timestamp", now: now.Add(6 * time.Minute), want: ErrStaleTimestamp},
+		{name: "timestamp from the future", now: now.Add(-6 * time.Minute), want: ErrStaleTimestamp},
+		{name: "missing prefix", signature: strings.TrimPrefix(signature, "sha256="), want: ErrMissingSignature},
+		{name: "missing signature", signature: "-", want: ErrMissingSignature},
+		{name: "missing timestamp", timestamp: "-", want: ErrMissingSignature},
+		{name: "malformed timestamp", timestamp: "yesterday", want: ErrMissingSignature},
+		{name: "malformed signature", signature: "sha256=zz", want: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretUsed, timestampUsed, signatureUsed, bodyUsed, nowUsed := secret, strconv.FormatInt(timestamp, 10), signature, body, now
+			if tt.secret != "" {
+				secretUsed = tt.secret
+			}
+			if tt.timestamp == "-" {
+				timestampUsed = ""
+			} else if tt.timestamp != "" {
+				timestampUsed = tt.timestamp
+			}
+			if tt.signature == "-" {
+				signatureUsed = ""
+			} else if tt.signature != "" {
+				signatureUsed = tt.signature
+			}
+			if tt.body != nil {
+				bodyUsed = tt.body
+			}
+			if !tt.now.IsZero() {
+				nowUsed = tt.now
+			}
+
+			err := Verify(secretUsed, timestampUsed, signatureUsed, bodyUsed, nowUsed, 5*time.Minute)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAcceptsTimestampsWithinTolerance(t *testing.T) {
+	body := []byte(`{}`)
+	now := time.Unix(1_700_000_000, 0)
+	for _, skew := range []time.Duration{-5 * time.Minute, -time.Second, time.Second, 5 * time.Minute} {
+		timestamp := now.Add(skew).Unix()
+		err := Verify("secret", strconv.FormatInt(timestamp, 10), Sign("secret", timestamp, body), body, now, 5*time.Minute)
+		if err != nil {
+			t.Errorf("Verify() with a clock skew of %s = %v", skew, err)
+		}
+	}
+}
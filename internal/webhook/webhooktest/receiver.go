@@ -0,0 +1,101 @@
+// Package webhooktest provides an in-process webhook endpoint for exercising
+// webhook delivery without a real receiver.
+package webhooktest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/Rafli-Dewanto/go-template/internal/events"
+	"github.com/Rafli-Dewanto/go-template/internal/webhook"
+)
+
+// SignatureTolerance is how far a delivery's timestamp may be from the receiver's clock
+const SignatureTolerance = 5 * time.Minute
+
+// Delivery is a request the receiver accepted
+type Delivery struct {
+	Header http.Header
+	Body   []byte
+	Event  events.Event
+}
+
+// Receiver is a webhook endpoint that checks every request's signature against
+// its secret, answering 401 when it does not match, and records the accepted ones.
+type Receiver struct {
+	*httptest.Server
+	Secret string
+
+	mu         sync.Mutex
+	deliveries []Delivery
+	rejected   int
+	failNext   int
+	failStatus int
+}
+
+// NewReceiver starts an endpoint. Callers must Close it when done.
+func NewReceiver(secret string) *Receiver {
+	r := &Receiver{Secret: secret}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.handle))
+	return r
+}
+
+// FailNext makes the next n correctly signed requests fail with status
+func (r *Receiver) FailNext(n int, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failNext = n
+	r.failStatus = status
+}
+
+// Deliveries returns the accepted deliveries, oldest first
+func (r *Receiver) Deliveries() []Delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Delivery(nil), r.deliveries...)
+}
+
+// Rejected counts the requests turned away for a bad signature
+func (r *Receiver) Rejected() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rejected
+}
+
+func (r *Receiver) handle(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = webhook.Verify(r.Secret, req.Header.Get(webhook.HeaderTimestamp), req.Header.Get(webhook.HeaderSignature),
+		body, time.Now(), SignatureTolerance)
+	if err != nil {
+		r.rejected++
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.failNext > 0 {
+		r.failNext--
+		w.WriteHeader(r.failStatus)
+		return
+	}
+
+	var event events.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.deliveries = append(r.deliveries, Delivery{Header: req.Header.Clone(), Body: body, Event: event})
+	w.WriteHeader(http.StatusNoContent)
+}